@@ -0,0 +1,156 @@
+// Command m4315 is a small CLI for testing the Panamax/Furman M4315-PRO
+// telnet protocol used by the erh:verhboat:m4315-pro component.
+//
+// It talks to the device directly using the shared verhboat package, so it
+// exercises exactly the same code the module runs. With -fake it starts an
+// in-process fake device and talks to that instead, and -action serve runs
+// the fake in the foreground for pointing a module config at.
+//
+// Examples:
+//
+//	go run ./cmd/m4315 -host 192.168.1.50 -action status
+//	go run ./cmd/m4315 -host 192.168.1.50 -outlet 2 -action on
+//	go run ./cmd/m4315 -host 192.168.1.50 -outlet 2 -action off -password secret
+//	go run ./cmd/m4315 -fake -outlet 3 -action on
+//	go run ./cmd/m4315 -action serve -port 2323 -password secret
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erh/verhboat"
+)
+
+func run() error {
+	host := flag.String("host", "", "M4315-PRO IP address or hostname")
+	port := flag.Int("port", verhboat.M4315DefaultTCPPort, "telnet port")
+	password := flag.String("password", "", "telnet password, if auth is on")
+	outlet := flag.Int("outlet", 0, "outlet number 1-8; 0 means all outlets for status")
+	action := flag.String("action", "", "action: on, off, status, or serve")
+	timeout := flag.Duration("timeout", 5*time.Second, "dial and I/O timeout")
+	fake := flag.Bool("fake", false, "run against an in-process fake device instead of -host")
+	format := flag.String("format", verhboat.M4315FormatSpacedEquals, "status line format for the fake device")
+	delay := flag.Duration("delay", 0, "reply delay for the fake device")
+
+	flag.Parse()
+
+	act := strings.ToLower(strings.TrimSpace(*action))
+	if act == "" {
+		return errors.New("-action is required")
+	}
+
+	// serve runs the fake device in the foreground until interrupted.
+	if act == "serve" {
+		f, err := verhboat.NewFakeM4315Pro(net.JoinHostPort("0.0.0.0", strconv.Itoa(*port)), *password)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		f.SetStatusFormat(*format)
+		f.SetReplyDelay(*delay)
+
+		fmt.Printf("fake M4315-PRO listening on %s\n", f.Addr())
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		for _, cmd := range f.Commands() {
+			fmt.Printf("received: %s\n", cmd)
+		}
+		return nil
+	}
+
+	if *fake {
+		f, err := verhboat.NewFakeM4315Pro("127.0.0.1:0", *password)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		f.SetStatusFormat(*format)
+		f.SetReplyDelay(*delay)
+		*host = f.Host()
+		*port = f.Port()
+		fmt.Printf("using fake M4315-PRO on %s\n", f.Addr())
+	}
+
+	if strings.TrimSpace(*host) == "" {
+		return errors.New("-host is required (or use -fake)")
+	}
+
+	client, err := verhboat.NewM4315Client(*host, *port, *password, *timeout)
+	if err != nil {
+		return err
+	}
+
+	switch act {
+	case "on", "off":
+		if *outlet == 0 {
+			return errors.New("-outlet is required")
+		}
+		if err := client.Switch(*outlet, act == "on"); err != nil {
+			return err
+		}
+		if !*fake {
+			return nil
+		}
+		// The fake applies the command asynchronously; give it a moment so the
+		// status below reflects it.
+		time.Sleep(100 * time.Millisecond)
+		return printStatus(client, *outlet)
+
+	case "status":
+		return printStatus(client, *outlet)
+
+	default:
+		return fmt.Errorf("unknown action %q", *action)
+	}
+}
+
+func printStatus(client *verhboat.M4315Client, outlet int) error {
+	if outlet != 0 {
+		on, err := client.OutletStatus(outlet)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("outlet %d: %s\n", outlet, onOff(on))
+		return nil
+	}
+
+	all, err := client.AllOutletStatus()
+	if err != nil {
+		return err
+	}
+	outlets := make([]int, 0, len(all))
+	for n := range all {
+		outlets = append(outlets, n)
+	}
+	sort.Ints(outlets)
+	for _, n := range outlets {
+		fmt.Printf("outlet %d: %s\n", n, onOff(all[n]))
+	}
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		fmt.Fprintln(os.Stderr)
+		flag.Usage()
+		os.Exit(1)
+	}
+}
@@ -17,8 +17,14 @@ func main() {
 		resource.APIModel{sensor.API, verhboat.ModbusToTankSensorModel},
 		resource.APIModel{sensor.API, verhboat.CombinedTankSensorModel},
 		resource.APIModel{toggleswitch.API, verhboat.TahomaHackModel},
+		resource.APIModel{toggleswitch.API, verhboat.TahomaShadeModel},
+		resource.APIModel{sensor.API, verhboat.SunShadesModel},
+		resource.APIModel{sensor.API, verhboat.SunModel},
+		resource.APIModel{sensor.API, verhboat.MoonModel},
+		resource.APIModel{toggleswitch.API, verhboat.SunSwitchModel},
 		resource.APIModel{toggleswitch.API, verhboat.M4315ProModel},
 		resource.APIModel{generic.API, verhboat.WebCamModel},
 		resource.APIModel{generic.API, verhboat.NicolaudieStick3Model},
+		resource.APIModel{toggleswitch.API, verhboat.NicolaudieStick3SwitchModel},
 	)
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"go.viam.com/rdk/logging"
 
@@ -11,7 +16,7 @@ import (
 
 	"go.viam.com/rdk/components/switch"
 
-	"verhboat"
+	"github.com/erh/verhboat"
 )
 
 func main() {
@@ -22,30 +27,54 @@ func main() {
 }
 
 func realMain() error {
+	ctx := context.Background()
 	logger := logging.NewLogger("tahoma")
 
 	configFile := flag.String("config", "", "config file")
 	debug := flag.Bool("debug", false, "debugging on")
 	action := flag.String("action", "", "")
 	label := flag.String("label", "", "")
+	fake := flag.Bool("fake", false, "run against an in-process fake gateway instead of a config")
 
 	flag.Parse()
 
-	if *configFile == "" {
-		return fmt.Errorf("need a config file")
-	}
-
 	if *debug {
 		logger.SetLevel(logging.DEBUG)
 	}
 
+	// discover doesn't need a config; it's how you find what to put in one.
+	if *action == "discover" {
+		return discover(ctx, logger)
+	}
+
 	cfg := &verhboat.TahomaConfig{}
-	err := vmodutils.ReadJSONFromFile(*configFile, cfg)
-	if err != nil {
-		return err
+	if *fake || *action == "serve" {
+		f := startFake()
+		defer f.Close()
+
+		if *action == "serve" {
+			fmt.Printf("fake gateway at %s\n", f.Host())
+			fmt.Printf("  api-key:          %s\n", fakeToken)
+			fmt.Printf("  cert-fingerprint: %s\n", f.CertFingerprint())
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			<-sig
+			return nil
+		}
+
+		cfg.Host = f.Host()
+		cfg.ApiKey = fakeToken
+		cfg.CertFingerprint = f.CertFingerprint()
+	} else {
+		if *configFile == "" {
+			return fmt.Errorf("need a config file")
+		}
+		if err := vmodutils.ReadJSONFromFile(*configFile, cfg); err != nil {
+			return err
+		}
 	}
 
-	_, _, err = cfg.Validate("")
+	_, _, err := cfg.Validate("")
 	if err != nil {
 		return err
 	}
@@ -54,6 +83,7 @@ func realMain() error {
 	if err != nil {
 		return err
 	}
+	defer client.Close(ctx)
 
 	switch *action {
 	case "list":
@@ -65,16 +95,48 @@ func realMain() error {
 		for _, device := range devices {
 			fmt.Printf("%#v\n", device)
 		}
+	case "describe":
+		devices, err := client.GetDevices()
+		if err != nil {
+			return err
+		}
+		for _, d := range devices {
+			if *label != "" && d.Label != *label {
+				continue
+			}
+			describe(d)
+		}
 	case "up":
 		if *label == "" {
 			return fmt.Errorf("need a label")
 		}
-		return client.LiftShadeByLabel(*label)
+		return client.LiftShadeByLabel(ctx, *label)
 	case "lower-and-tilt":
 		if *label == "" {
 			return fmt.Errorf("need a label")
 		}
-		return client.LowerAndTiltShadeByLabels(strings.Split(*label, ","))
+		return client.LowerAndTiltShadeByLabels(ctx, strings.Split(*label, ","))
+
+	case "scenarios":
+		scenarios, err := client.GetScenarios()
+		if err != nil {
+			return err
+		}
+		for _, g := range scenarios {
+			fmt.Printf("%s\t%s\n", g.OID, g.Label)
+		}
+	case "run-scenario":
+		if *label == "" {
+			return fmt.Errorf("need a label")
+		}
+		res, err := client.DoCommand(ctx, map[string]interface{}{"command": "run_scenario", "scenario": *label})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %v\n", res["exec_id"], res["state"])
+		if res["state"] != "COMPLETED" {
+			return fmt.Errorf("scenario %s failed: %v", *label, res["failure"])
+		}
 
 	default:
 		return fmt.Errorf("unknown action [%s]", *action)
@@ -82,3 +144,65 @@ func realMain() error {
 
 	return nil
 }
+
+func describe(d verhboat.Device) {
+	fmt.Printf("%s\n", d.Label)
+	fmt.Printf("  url:          %s\n", d.DeviceURL)
+	fmt.Printf("  controllable: %s\n", d.ControllableName)
+	fmt.Printf("  class:        %s (widget %s)\n", d.Definition.UIClass, d.Definition.WidgetName)
+	fmt.Printf("  available:    %v  enabled: %v\n", d.Available, d.Enabled)
+	fmt.Printf("  commands:\n")
+	for _, c := range d.Definition.Commands {
+		fmt.Printf("    %s (%d params)\n", c.CommandName, c.Nparams)
+	}
+	fmt.Printf("  states:\n")
+	for _, st := range d.States {
+		fmt.Printf("    %s = %v\n", st.Name, st.Value)
+	}
+}
+
+const fakeToken = "fake-token"
+
+// startFake starts a fake gateway with the boat's shades.
+func startFake() *verhboat.FakeTahoma {
+	f := verhboat.NewFakeTahoma(fakeToken)
+	f.SetTravelTime(5 * time.Second)
+	port := f.AddShade("Salon Port", true)
+	stbd := f.AddShade("Salon Starboard", true)
+	fwd := f.AddShade("Salon Forward", false)
+
+	down := []verhboat.Command{{Name: "down", Parameters: []interface{}{}}}
+	f.AddScenario("Night", []verhboat.Action{
+		{DeviceURL: port, Commands: down},
+		{DeviceURL: stbd, Commands: down},
+		{DeviceURL: fwd, Commands: down},
+	})
+	return f
+}
+
+func discover(ctx context.Context, logger logging.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	gateways, err := verhboat.DiscoverTahomaGateways(ctx, logger)
+	if err != nil {
+		return err
+	}
+	if len(gateways) == 0 {
+		return fmt.Errorf("no TaHoma gateways found; is developer mode on?")
+	}
+
+	for _, g := range gateways {
+		fmt.Printf("gateway-pin: %s\n", g.Pin)
+		fmt.Printf("  host:        %s (%s)\n", g.Host(), g.HostName)
+		fmt.Printf("  port:        %d\n", g.Port)
+		fmt.Printf("  api version: %s  firmware: %s\n", g.APIVersion, g.FwVersion)
+		fp, err := verhboat.FetchCertFingerprint(g.Host(), g.Port)
+		if err != nil {
+			fmt.Printf("  cert-fingerprint: (%v)\n", err)
+		} else {
+			fmt.Printf("  cert-fingerprint: %s\n", fp)
+		}
+	}
+	return nil
+}
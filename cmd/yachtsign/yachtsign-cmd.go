@@ -2,7 +2,10 @@
 // protocol used by the erh:verhboat:nicolaudie-stick3 component.
 //
 // It talks to the controller directly using the shared verhboat package, so
-// it exercises exactly the same code the module runs.
+// it exercises exactly the same code the module runs. With -fake it starts an
+// in-process fake controller and talks to that instead, and -action serve
+// runs the fake in the foreground, printing every quick trigger it gets, so a
+// module config can be pointed at it to see what it would send.
 //
 // Examples:
 //
@@ -10,13 +13,21 @@
 //	go run ./cmd/yachtsign -ip 192.168.1.60 -action off
 //	go run ./cmd/yachtsign -ip 192.168.1.60 -action color -color FF0000
 //	go run ./cmd/yachtsign -action suntimes -lat 40.7128 -lng -74.0060
+//	go run ./cmd/yachtsign -action discover
+//	go run ./cmd/yachtsign -ip 192.168.1.60 -action status
+//	go run ./cmd/yachtsign -fake -action on -page B -scene 3 -color FF8000
+//	go run ./cmd/yachtsign -action serve -port 2430
 package main
 
 import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,16 +35,21 @@ import (
 )
 
 func run() error {
-	ip := flag.String("ip", "", "STICK-DE3 IPv4 address")
+	ip := flag.String("ip", "", "STICK-DE3 IPv4 or IPv6 address, hostname, or \"broadcast\"")
+	fake := flag.Bool("fake", false, "run against an in-process fake controller instead of -ip")
 	port := flag.Int("port", verhboat.StickDefaultPort, "STICK-DE3 UDP quick-trigger port")
-	action := flag.String("action", "", "action: on, off, pause, resume, reset, dimmer, dimmer-raw, speed, speed-raw, color, blackout, unblackout, or suntimes")
+	action := flag.String("action", "", "action: on, off, pause, resume, reset, dimmer, dimmer-raw, speed, speed-raw, color, blackout, unblackout, status, discover, suntimes, or serve")
 	pageValue := flag.String("page", "A", "page letter or zero-based page number; A=0, B=1")
 	scene := flag.Int("scene", 1, "scene number within the page, from 1 to 50")
+	zone := flag.Int("zone", 0, "zone synchronization ID sent with the trigger, from 0 to 255")
 	value := flag.Int("value", 100, "percentage for dimmer/speed, or raw value for dimmer-raw/speed-raw")
 	color := flag.String("color", "FFFFFF", "RGB color in RRGGBB format")
 	lat := flag.Float64("lat", 0, "latitude in degrees (for suntimes)")
 	lng := flag.Float64("lng", 0, "longitude in degrees, positive east (for suntimes)")
-	timeout := flag.Duration("timeout", 2*time.Second, "UDP connection and write timeout")
+	broadcast := flag.String("broadcast", verhboat.StickBroadcastAddress, "address to send the discovery query to (for discover)")
+	timeout := flag.Duration("timeout", 2*time.Second, "UDP connection and write timeout, and how long to wait for status replies")
+	pacing := flag.Duration("pacing", verhboat.StickDefaultPacing, "minimum gap between packets")
+	repeat := flag.Int("repeat", 1, "how many times to send each packet, from 1 to 5")
 	debug := flag.Bool("debug", false, "print the raw packet before sending")
 
 	flag.Parse()
@@ -43,13 +59,51 @@ func run() error {
 		return errors.New("-action is required")
 	}
 
-	// suntimes doesn't touch the controller; handle it before requiring -ip.
+	// suntimes doesn't touch the controller and discover finds them; handle
+	// them before requiring -ip.
 	if act == "suntimes" {
 		return printSunTimes(*lat, *lng)
 	}
+	if act == "discover" {
+		return discover(*broadcast, *port, *timeout)
+	}
+
+	// serve runs the fake controller in the foreground until interrupted.
+	if act == "serve" {
+		f, err := verhboat.NewFakeStick3(net.JoinHostPort("0.0.0.0", strconv.Itoa(*port)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		f.SetOnTrigger(printStickTrigger)
+
+		fmt.Printf("fake STICK-DE3 listening on %s\n", f.Addr())
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		printFakeStick3(f)
+		return nil
+	}
+
+	if *fake {
+		f, err := verhboat.NewFakeStick3("127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			// Let the last triggers arrive before showing what the fake
+			// made of them.
+			time.Sleep(100 * time.Millisecond)
+			printFakeStick3(f)
+			f.Close()
+		}()
+		*ip = f.Host()
+		*port = f.Port()
+		fmt.Printf("using fake STICK-DE3 on %s\n", f.Addr())
+	}
 
 	if strings.TrimSpace(*ip) == "" {
-		return errors.New("-ip is required")
+		return errors.New("-ip is required (or use -fake)")
 	}
 
 	page, err := verhboat.ParseStickPage(*pageValue)
@@ -57,10 +111,17 @@ func run() error {
 		return err
 	}
 
+	if *zone < 0 || *zone > 255 {
+		return errors.New("zone must be between 0 and 255")
+	}
+
 	client, err := verhboat.NewStick3Client(*ip, *port, *timeout, *debug)
 	if err != nil {
 		return err
 	}
+	client.SetPacing(*pacing)
+	client.SetRepeat(*repeat)
+	client = client.WithZone(byte(*zone))
 
 	switch act {
 	case "on":
@@ -118,25 +179,123 @@ func run() error {
 	case "unblackout":
 		return client.BlackoutOff()
 
+	case "status":
+		status, err := client.QueryStatus()
+		if err != nil {
+			return err
+		}
+		printStickStatus(status)
+		return nil
+
 	default:
 		return fmt.Errorf("unknown action %q", *action)
 	}
 }
 
-func printSunTimes(lat, lng float64) error {
-	now := time.Now().UTC()
-	sunrise, sunset, err := verhboat.SunTimes(now, lat, lng)
+// discover lists the controllers that answer a status query sent to address.
+func discover(address string, port int, wait time.Duration) error {
+	found, err := verhboat.DiscoverStick3(address, port, wait)
 	if err != nil {
 		return err
 	}
+	if len(found) == 0 {
+		fmt.Printf("no controllers answered on %s:%d within %s\n", address, port, wait)
+		fmt.Println("(the status query is speculative; controllers that don't answer it won't show up)")
+		return nil
+	}
+	for _, status := range found {
+		printStickStatus(status)
+	}
+	return nil
+}
+
+func printStickStatus(status verhboat.StickStatus) {
+	page, scene := status.PageScene()
+	state := "off"
+	if status.On() {
+		state = "on"
+	}
+	fmt.Printf("%-21s %-8s page %c scene %-2d %-3s dimmer %3d speed %3d color %s\n",
+		status.Address, status.DeviceID, 'A'+rune(page), scene, state, status.Dimmer, status.Speed, status.Color())
+}
+
+// stickPageScene formats an absolute scene number as e.g. "B3".
+func stickPageScene(absolute uint16) string {
+	page, scene := verhboat.StickStatus{Scene: absolute}.PageScene()
+	return fmt.Sprintf("%c%d", 'A'+rune(page), scene)
+}
+
+func printStickTrigger(trigger verhboat.StickQuickTrigger) {
+	line := fmt.Sprintf("%s %-12s", time.Now().Format("15:04:05.000"), trigger.Command)
+	switch trigger.Command {
+	case verhboat.StickBlackoutOn, verhboat.StickBlackoutOff:
+	default:
+		line += fmt.Sprintf(" scene %-4s", stickPageScene(trigger.Scene))
+	}
+	if trigger.ZoneSyncID != 0 {
+		line += fmt.Sprintf(" zone %d", trigger.ZoneSyncID)
+	}
+	switch trigger.Command {
+	case verhboat.StickDimmerSet:
+		line += fmt.Sprintf(" dimmer %d", trigger.Dimmer)
+	case verhboat.StickSpeedSet:
+		line += fmt.Sprintf(" speed %d", trigger.Speed)
+	case verhboat.StickColorSet:
+		line += fmt.Sprintf(" color %02X%02X%02X", trigger.Red, trigger.Green, trigger.Blue)
+	}
+	fmt.Println(strings.TrimRight(line, " "))
+}
+
+// printFakeStick3 prints the state the fake controller ended up in.
+func printFakeStick3(f *verhboat.FakeStick3) {
+	scenes := f.Scenes()
+	numbers := make([]int, 0, len(scenes))
+	for n := range scenes {
+		numbers = append(numbers, int(n))
+	}
+	sort.Ints(numbers)
+
+	fmt.Printf("received %d quick triggers; blackout %v\n", len(f.Triggers()), f.Blackout())
+	for _, n := range numbers {
+		s := scenes[uint16(n)]
+		state := "off"
+		if s.On {
+			state = "on"
+		}
+		if s.Paused {
+			state += ", paused"
+		}
+		fmt.Printf("scene %-4s zone %-3d %-11s dimmer %3d speed %3d color %s\n",
+			stickPageScene(uint16(n)), s.ZoneSyncID, state, s.Dimmer, s.Speed, s.Color())
+	}
+}
+
+func printSunTimes(lat, lng float64) error {
+	now := time.Now()
+	day := verhboat.SunDay(now.UTC(), lat, lng)
+
 	fmt.Printf("location: %.4f, %.4f\n", lat, lng)
-	fmt.Printf("sunrise (UTC):  %s\n", sunrise.Format(time.RFC3339))
-	fmt.Printf("sunset  (UTC):  %s\n", sunset.Format(time.RFC3339))
-	fmt.Printf("sunrise (local): %s\n", sunrise.Local().Format(time.RFC3339))
-	fmt.Printf("sunset  (local): %s\n", sunset.Local().Format(time.RFC3339))
-	fmt.Printf("sign on from %s until %s\n",
-		sunset.Add(-time.Hour).Local().Format("15:04"),
-		sunrise.Local().Format("15:04"))
+	fmt.Printf("%-18s %-8s %s\n", "event", "UTC", "local")
+	for _, e := range verhboat.SunEvents {
+		t, ok := day.Times[e]
+		if !ok {
+			fmt.Printf("%-18s %v\n", e, day.Errors[e])
+			continue
+		}
+		fmt.Printf("%-18s %-8s %s\n", e, t.Format("15:04"), t.Local().Format("15:04 MST"))
+	}
+	fmt.Printf("day length: %s\n", day.DayLength.Round(time.Minute))
+
+	azimuth, elevation := verhboat.SunPosition(now, lat, lng)
+	fmt.Printf("sun now: azimuth %.1f°, elevation %.1f°\n", azimuth, elevation)
+
+	sunrise, riseOK := day.Times[verhboat.SunEventSunrise]
+	sunset, setOK := day.Times[verhboat.SunEventSunset]
+	if riseOK && setOK {
+		fmt.Printf("sign on from %s until %s\n",
+			sunset.Add(-time.Hour).Local().Format("15:04"),
+			sunrise.Local().Format("15:04"))
+	}
 	return nil
 }
 
@@ -0,0 +1,289 @@
+package verhboat
+
+// In-process fake of the M4315-PRO telnet interface, used by the tests and by
+// cmd/m4315 -fake so the component can be exercised without hardware.
+//
+// It speaks just enough of the protocol: an optional "Password:" prompt,
+// `!SWITCH <outlet> <ON|OFF>` and `?OUTLETSTAT`. The status line format and a
+// few faults (slow replies, dropped connections) are configurable so the
+// client's parsing and error handling can be tested against them.
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status line formats the fake can emit for ?OUTLETSTAT. Each is a fmt pattern
+// taking the outlet number and "ON"/"OFF".
+const (
+	M4315FormatSpacedEquals = "$OUTLET%d = %s\r\n"
+	M4315FormatEquals       = "$OUTLET%d=%s\r\n"
+	M4315FormatSpace        = "$OUTLET%d %s\r\n"
+	M4315FormatColon        = "$OUTLET%d: %s\r\n"
+)
+
+// FakeM4315Pro is a fake M4315-PRO listening on a local TCP port.
+type FakeM4315Pro struct {
+	listener net.Listener
+	password string
+
+	mu              sync.Mutex
+	outlets         [M4315NumOutlets + 1]bool // index 0 unused
+	format          string
+	replyDelay      time.Duration
+	dropConnections bool
+	hangUpOnCommand bool
+	commands        []string
+	conns           map[net.Conn]struct{}
+
+	wg sync.WaitGroup
+}
+
+// NewFakeM4315Pro starts a fake device listening on addr (e.g. "127.0.0.1:0"
+// for a random port). If password is non-empty, clients must log in first.
+func NewFakeM4315Pro(addr, password string) (*FakeM4315Pro, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	f := &FakeM4315Pro{
+		listener: listener,
+		password: password,
+		format:   M4315FormatSpacedEquals,
+		conns:    map[net.Conn]struct{}{},
+	}
+
+	f.wg.Add(1)
+	go f.acceptLoop()
+
+	return f, nil
+}
+
+// Addr returns the host:port the fake is listening on.
+func (f *FakeM4315Pro) Addr() string {
+	return f.listener.Addr().String()
+}
+
+// Host returns the host the fake is listening on.
+func (f *FakeM4315Pro) Host() string {
+	host, _, _ := net.SplitHostPort(f.Addr())
+	return host
+}
+
+// Port returns the TCP port the fake is listening on.
+func (f *FakeM4315Pro) Port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Outlet reports whether the given outlet is on.
+func (f *FakeM4315Pro) Outlet(outlet int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if outlet < 1 || outlet > M4315NumOutlets {
+		return false
+	}
+	return f.outlets[outlet]
+}
+
+// SetOutlet changes an outlet's state directly, as if from the front panel.
+func (f *FakeM4315Pro) SetOutlet(outlet int, on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if outlet >= 1 && outlet <= M4315NumOutlets {
+		f.outlets[outlet] = on
+	}
+}
+
+// SetStatusFormat sets the fmt pattern used for each ?OUTLETSTAT line, e.g.
+// M4315FormatEquals.
+func (f *FakeM4315Pro) SetStatusFormat(format string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.format = format
+}
+
+// SetReplyDelay makes the fake wait this long before answering each command.
+func (f *FakeM4315Pro) SetReplyDelay(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replyDelay = d
+}
+
+// SetDropConnections makes the fake close every new connection immediately.
+func (f *FakeM4315Pro) SetDropConnections(drop bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dropConnections = drop
+}
+
+// SetHangUpOnCommand makes the fake close the connection, without acting on it,
+// when it receives a command after login.
+func (f *FakeM4315Pro) SetHangUpOnCommand(hangUp bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hangUpOnCommand = hangUp
+}
+
+// Commands returns every command line the fake has acted on, in order.
+func (f *FakeM4315Pro) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// Close stops the fake and drops any open connections.
+func (f *FakeM4315Pro) Close() error {
+	err := f.listener.Close()
+	f.mu.Lock()
+	for c := range f.conns {
+		c.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+func (f *FakeM4315Pro) acceptLoop() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		drop := f.dropConnections
+		if !drop {
+			f.conns[conn] = struct{}{}
+		}
+		f.mu.Unlock()
+
+		if drop {
+			conn.Close()
+			continue
+		}
+
+		f.wg.Add(1)
+		go f.serve(conn)
+	}
+}
+
+func (f *FakeM4315Pro) serve(conn net.Conn) {
+	defer f.wg.Done()
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+
+	if f.password != "" {
+		if _, err := conn.Write([]byte("Password: ")); err != nil {
+			return
+		}
+		line, err := readFakeLine(reader)
+		if err != nil {
+			return
+		}
+		if line != f.password {
+			_, _ = conn.Write([]byte("\r\nInvalid password\r\n"))
+			return
+		}
+	}
+	if _, err := conn.Write([]byte("\r\n>")); err != nil {
+		return
+	}
+
+	for {
+		line, err := readFakeLine(reader)
+		if err != nil {
+			return
+		}
+		if line == "" {
+			continue
+		}
+
+		f.mu.Lock()
+		delay := f.replyDelay
+		hangUp := f.hangUpOnCommand
+		f.mu.Unlock()
+
+		if hangUp {
+			return
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+
+		if _, err := conn.Write([]byte(f.handle(line) + ">")); err != nil {
+			return
+		}
+	}
+}
+
+// handle acts on one command line and returns the reply.
+func (f *FakeM4315Pro) handle(line string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commands = append(f.commands, line)
+
+	fields := strings.Fields(strings.ToUpper(line))
+	switch {
+	case len(fields) == 1 && fields[0] == "?OUTLETSTAT":
+		var b strings.Builder
+		for i := 1; i <= M4315NumOutlets; i++ {
+			fmt.Fprintf(&b, f.format, i, fakeOnOff(f.outlets[i]))
+		}
+		return b.String()
+
+	case len(fields) == 3 && fields[0] == "!SWITCH":
+		outlet, err := strconv.Atoi(fields[1])
+		if err != nil || outlet < 1 || outlet > M4315NumOutlets {
+			return "$ERROR invalid outlet\r\n"
+		}
+		switch fields[2] {
+		case "ON":
+			f.outlets[outlet] = true
+		case "OFF":
+			f.outlets[outlet] = false
+		default:
+			return "$ERROR invalid state\r\n"
+		}
+		return fmt.Sprintf(f.format, outlet, fakeOnOff(f.outlets[outlet]))
+
+	default:
+		return "$ERROR unknown command\r\n"
+	}
+}
+
+// readFakeLine reads one line terminated by CR or LF. The LF of a CRLF pair
+// comes back as an empty line, which callers skip.
+func readFakeLine(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == '\r' || c == '\n' {
+			return strings.TrimSpace(b.String()), nil
+		}
+		b.WriteByte(c)
+	}
+}
+
+func fakeOnOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
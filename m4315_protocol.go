@@ -0,0 +1,246 @@
+package verhboat
+
+// Panamax/Furman M4315-PRO telnet control protocol.
+//
+// This is the low-level client, extracted so the erh:verhboat:m4315-pro
+// component, the cmd/m4315 CLI, and the tests can share it. See m4315pro.go
+// for the Viam component and m4315_fake.go for an in-process fake device.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// M4315DefaultTCPPort is the M4315-PRO telnet port.
+	M4315DefaultTCPPort = 23
+
+	// M4315NumOutlets is the number of switchable outlets on the M4315-PRO.
+	M4315NumOutlets = 8
+
+	m4315DialTimeout = 5 * time.Second
+	m4315IOTimeout   = 5 * time.Second
+)
+
+// M4315Client is an M4315-PRO telnet client. Each call opens a fresh
+// connection, since the device only allows a handful of sessions and drops
+// idle ones.
+type M4315Client struct {
+	address  string
+	password string
+	timeout  time.Duration
+}
+
+// NewM4315Client creates an M4315-PRO telnet client. password may be empty if
+// telnet auth is off. timeout bounds both the dial and each exchange; zero
+// uses the defaults.
+func NewM4315Client(host string, port int, password string, timeout time.Duration) (*M4315Client, error) {
+	if host == "" {
+		return nil, errors.New("need a host")
+	}
+	if port == 0 {
+		port = M4315DefaultTCPPort
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid TCP port %d", port)
+	}
+	if timeout < 0 {
+		return nil, errors.New("timeout cannot be negative")
+	}
+
+	return &M4315Client{
+		address:  net.JoinHostPort(host, strconv.Itoa(port)),
+		password: password,
+		timeout:  timeout,
+	}, nil
+}
+
+// Address returns the host:port the client talks to.
+func (c *M4315Client) Address() string {
+	return c.address
+}
+
+func (c *M4315Client) dialTimeout() time.Duration {
+	if c.timeout == 0 {
+		return m4315DialTimeout
+	}
+	return c.timeout
+}
+
+func (c *M4315Client) ioTimeout() time.Duration {
+	if c.timeout == 0 {
+		return m4315IOTimeout
+	}
+	return c.timeout
+}
+
+// dialAndAuth opens a fresh telnet connection and, if a password is configured,
+// logs in. The returned bufio.Reader is positioned past the login prompt.
+func (c *M4315Client) dialAndAuth() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", c.address, c.dialTimeout())
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial %s: %w", c.address, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(c.ioTimeout()))
+
+	reader := bufio.NewReader(conn)
+
+	if c.password != "" {
+		if err := readUntilPrompt(reader, "password"); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("waiting for password prompt: %w", err)
+		}
+		if _, err := conn.Write([]byte(c.password + "\r")); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("sending password: %w", err)
+		}
+		if err := readUntilPrompt(reader, ">"); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("waiting for command prompt: %w", err)
+		}
+	}
+
+	return conn, reader, nil
+}
+
+// Switch sends one !SWITCH command for the given outlet.
+func (c *M4315Client) Switch(outlet int, on bool) error {
+	if outlet < 1 || outlet > M4315NumOutlets {
+		return fmt.Errorf("outlet must be between 1 and %d, got %d", M4315NumOutlets, outlet)
+	}
+
+	conn, _, err := c.dialAndAuth()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := "OFF"
+	if on {
+		state = "ON"
+	}
+	cmd := fmt.Sprintf("!SWITCH %d %s\r", outlet, state)
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return fmt.Errorf("sending command: %w", err)
+	}
+	return nil
+}
+
+// OutletStatus sends ?OUTLETSTAT and returns the on/off state of the given
+// outlet (true = on).
+func (c *M4315Client) OutletStatus(outlet int) (bool, error) {
+	var state bool
+	_, err := c.queryStatus(func(text string) bool {
+		var ok bool
+		state, ok = parseOutletStatus(text, outlet)
+		return ok
+	})
+	if err != nil {
+		return false, err
+	}
+	return state, nil
+}
+
+// AllOutletStatus sends ?OUTLETSTAT and returns the state of every outlet the
+// device reported, keyed by outlet number.
+func (c *M4315Client) AllOutletStatus() (map[int]bool, error) {
+	text, err := c.queryStatus(func(text string) bool {
+		return len(parseAllOutletStatus(text)) >= M4315NumOutlets
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseAllOutletStatus(text), nil
+}
+
+// queryStatus sends ?OUTLETSTAT and reads until done reports true for the
+// accumulated output, returning that output.
+func (c *M4315Client) queryStatus(done func(text string) bool) (string, error) {
+	conn, reader, err := c.dialAndAuth()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("?OUTLETSTAT\r")); err != nil {
+		return "", fmt.Errorf("sending query: %w", err)
+	}
+
+	// Read until we've seen what we need or the deadline fires. The device
+	// emits one $OUTLETn line per outlet; we don't know exactly how many lines
+	// it will send, so we read until the deadline ends the connection and
+	// parse what we got.
+	var buf strings.Builder
+	tmp := make([]byte, 256)
+	for {
+		n, err := reader.Read(tmp)
+		if n > 0 {
+			buf.Write(tmp[:n])
+			// Fast-path: if we've already seen what we need, stop reading.
+			if done(buf.String()) {
+				return buf.String(), nil
+			}
+		}
+		if err != nil {
+			// Connection closed or deadline hit; try a final parse.
+			if done(buf.String()) {
+				return buf.String(), nil
+			}
+			return "", fmt.Errorf("reading status: %w (got %q)", err, buf.String())
+		}
+	}
+}
+
+// outletStatusRE matches one outlet line in a ?OUTLETSTAT response, e.g.
+// "$OUTLET1 ON", "$OUTLET1=ON", "$OUTLET1 = OFF".
+var outletStatusRE = regexp.MustCompile(`(?i)\$OUTLET\s*(\d+)\s*[=: ]\s*(ON|OFF)`)
+
+// parseOutletStatus scans device output for the given outlet's state.
+func parseOutletStatus(text string, outlet int) (bool, bool) {
+	for _, m := range outletStatusRE.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n != outlet {
+			continue
+		}
+		return strings.EqualFold(m[2], "ON"), true
+	}
+	return false, false
+}
+
+// parseAllOutletStatus scans device output for every outlet's state.
+func parseAllOutletStatus(text string) map[int]bool {
+	res := map[int]bool{}
+	for _, m := range outletStatusRE.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		if _, seen := res[n]; !seen {
+			res[n] = strings.EqualFold(m[2], "ON")
+		}
+	}
+	return res
+}
+
+// readUntilPrompt reads from r until the accumulated input contains substr
+// (case-insensitive), or the connection deadline fires.
+func readUntilPrompt(r *bufio.Reader, substr string) error {
+	want := strings.ToLower(substr)
+	var buf strings.Builder
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(b)
+		if strings.Contains(strings.ToLower(buf.String()), want) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package verhboat
+
+// Watchdog for the m4315-pro outlet: periodically checks that the device
+// plugged into the outlet (e.g. the Starlink router or the NVR) still accepts
+// TCP connections, and power-cycles the outlet after enough consecutive
+// failures. Reboots are rate limited so a device that is simply gone doesn't
+// get cycled forever.
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	m4315WatchdogDefaultInterval      = time.Minute
+	m4315WatchdogDefaultFailures      = 3
+	m4315WatchdogDefaultMaxPerHour    = 2
+	m4315WatchdogDefaultGrace         = 5 * time.Minute
+	m4315WatchdogMaxDialTimeout       = 5 * time.Second
+	m4315WatchdogRebootHistoryHorizon = time.Hour
+)
+
+type M4315WatchdogConfig struct {
+	// Host and Port are dialed over TCP to check the device is alive.
+	Host string `json:"host"`
+	Port int    `json:"port"`
+
+	// IntervalSeconds is the time between checks. Defaults to 60.
+	IntervalSeconds float64 `json:"interval-seconds,omitempty"`
+
+	// Failures is the number of consecutive failed checks that triggers a
+	// power cycle. Defaults to 3.
+	Failures int `json:"failures,omitempty"`
+
+	// MaxRebootsPerHour caps watchdog power cycles. Defaults to 2; 0 never
+	// power-cycles (the watchdog only reports), -1 is unlimited.
+	MaxRebootsPerHour *int `json:"max-reboots-per-hour,omitempty"`
+
+	// GraceSeconds is how long to wait after a power cycle before checking
+	// again, to let the device boot. Defaults to 300.
+	GraceSeconds float64 `json:"grace-seconds,omitempty"`
+}
+
+func (c *M4315WatchdogConfig) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("need a host")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
+	}
+	if c.IntervalSeconds < 0 || c.GraceSeconds < 0 {
+		return fmt.Errorf("interval-seconds and grace-seconds cannot be negative")
+	}
+	if c.Failures < 0 {
+		return fmt.Errorf("failures cannot be negative")
+	}
+	if c.MaxRebootsPerHour != nil && *c.MaxRebootsPerHour < -1 {
+		return fmt.Errorf("max-reboots-per-hour must be -1 (unlimited) or more, got %d", *c.MaxRebootsPerHour)
+	}
+	return nil
+}
+
+func (c *M4315WatchdogConfig) interval() time.Duration {
+	if c.IntervalSeconds == 0 {
+		return m4315WatchdogDefaultInterval
+	}
+	return time.Duration(c.IntervalSeconds * float64(time.Second))
+}
+
+func (c *M4315WatchdogConfig) failures() int {
+	if c.Failures == 0 {
+		return m4315WatchdogDefaultFailures
+	}
+	return c.Failures
+}
+
+// maxRebootsPerHour is the configured cap, or -1 for none.
+func (c *M4315WatchdogConfig) maxRebootsPerHour() int {
+	if c.MaxRebootsPerHour == nil {
+		return m4315WatchdogDefaultMaxPerHour
+	}
+	return *c.MaxRebootsPerHour
+}
+
+func (c *M4315WatchdogConfig) grace() time.Duration {
+	if c.GraceSeconds == 0 {
+		return m4315WatchdogDefaultGrace
+	}
+	return time.Duration(c.GraceSeconds * float64(time.Second))
+}
+
+func (c *M4315WatchdogConfig) address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// m4315Watchdog holds the watchdog's state; the loop itself lives on M4315Pro
+// since it needs to power-cycle the outlet.
+type m4315Watchdog struct {
+	conf *M4315WatchdogConfig
+
+	mu           sync.Mutex
+	lastCheck    time.Time
+	lastOK       time.Time
+	lastError    string
+	failures     int
+	reboots      []time.Time // watchdog reboots within the last hour
+	totalReboots int
+	graceUntil   time.Time
+	limited      bool // the reboot limit stopped a power cycle in this outage
+}
+
+func newM4315Watchdog(conf *M4315WatchdogConfig) *m4315Watchdog {
+	return &m4315Watchdog{conf: conf}
+}
+
+// check dials the target once.
+func (w *m4315Watchdog) check(ctx context.Context) error {
+	timeout := w.conf.interval()
+	if timeout > m4315WatchdogMaxDialTimeout {
+		timeout = m4315WatchdogMaxDialTimeout
+	}
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", w.conf.address())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// pruneLocked drops reboot timestamps older than an hour.
+func (w *m4315Watchdog) pruneLocked(now time.Time) {
+	keep := w.reboots[:0]
+	for _, t := range w.reboots {
+		if now.Sub(t) < m4315WatchdogRebootHistoryHorizon {
+			keep = append(keep, t)
+		}
+	}
+	w.reboots = keep
+}
+
+// record notes the result of a check and reports whether the outlet should be
+// power-cycled now, or whether the reboot limit first stopped it in this
+// outage.
+func (w *m4315Watchdog) record(now time.Time, checkErr error) (reboot bool, limited bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastCheck = now
+	if checkErr == nil {
+		w.lastOK = now
+		w.lastError = ""
+		w.failures = 0
+		w.limited = false
+		return false, false
+	}
+
+	w.lastError = checkErr.Error()
+	w.failures++
+	if w.failures < w.conf.failures() {
+		return false, false
+	}
+
+	w.pruneLocked(now)
+	if limit := w.conf.maxRebootsPerHour(); limit >= 0 && len(w.reboots) >= limit {
+		// Count afresh, so once the limit allows it a power cycle still takes
+		// a full run of failures.
+		w.failures = 0
+		first := !w.limited
+		w.limited = true
+		return false, first
+	}
+	return true, false
+}
+
+// cycled notes a successful power cycle, by the watchdog (counted against
+// the hourly limit) or by hand, and gives the device time to boot.
+func (w *m4315Watchdog) cycled(now time.Time, byWatchdog bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failures = 0
+	w.limited = false
+	w.graceUntil = now.Add(w.conf.grace())
+	if byWatchdog {
+		w.reboots = append(w.reboots, now)
+		w.totalReboots++
+	}
+}
+
+func (w *m4315Watchdog) inGrace(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return now.Before(w.graceUntil)
+}
+
+func (w *m4315Watchdog) status(now time.Time) map[string]interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pruneLocked(now)
+
+	res := map[string]interface{}{
+		"target":               w.conf.address(),
+		"failures":             w.failures,
+		"reboots_last_hour":    len(w.reboots),
+		"total_reboots":        w.totalReboots,
+		"max_reboots_per_hour": w.conf.maxRebootsPerHour(),
+		"last_error":           w.lastError,
+		"in_grace":             now.Before(w.graceUntil),
+		"limited":              w.limited,
+	}
+	if !w.lastCheck.IsZero() {
+		res["last_check"] = w.lastCheck.UTC().Format(time.RFC3339)
+	}
+	if !w.lastOK.IsZero() {
+		res["last_ok"] = w.lastOK.UTC().Format(time.RFC3339)
+	}
+	if len(w.reboots) > 0 {
+		res["last_reboot"] = w.reboots[len(w.reboots)-1].UTC().Format(time.RFC3339)
+	}
+	return res
+}
+
+// watchdogTick runs one watchdog check and power-cycles the outlet if needed.
+func (s *M4315Pro) watchdogTick(ctx context.Context) {
+	w := s.watchdog
+	now := time.Now()
+
+	if w.inGrace(now) {
+		return
+	}
+
+	// Someone turned the outlet off on purpose; don't fight them.
+	s.mu.Lock()
+	off := s.lastPosition == 0
+	s.mu.Unlock()
+	if off {
+		return
+	}
+
+	checkErr := w.check(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	reboot, limited := w.record(now, checkErr)
+	if checkErr != nil {
+		s.logger.Debugf("m4315-pro %s outlet %d: watchdog check of %s failed: %v",
+			s.conf.Host, s.conf.Outlet, w.conf.address(), checkErr)
+	}
+	if limited && w.conf.maxRebootsPerHour() == 0 {
+		s.logger.Warnf("m4315-pro %s outlet %d: watchdog target %s is down; power cycling is disabled",
+			s.conf.Host, s.conf.Outlet, w.conf.address())
+		return
+	}
+	if limited {
+		s.logger.Warnf("m4315-pro %s outlet %d: watchdog target %s is down but reboot limit (%d/hour) reached",
+			s.conf.Host, s.conf.Outlet, w.conf.address(), w.conf.maxRebootsPerHour())
+		return
+	}
+	if !reboot {
+		return
+	}
+
+	s.logger.Warnf("m4315-pro %s outlet %d: watchdog target %s failed %d checks, power cycling",
+		s.conf.Host, s.conf.Outlet, w.conf.address(), w.conf.failures())
+	if err := s.powerCycle(ctx, s.conf.cycleOffTime(), true); err != nil {
+		// Not counted against the hourly limit; the next failed check tries
+		// again.
+		s.logger.Warnf("m4315-pro %s outlet %d: watchdog power cycle failed: %v",
+			s.conf.Host, s.conf.Outlet, err)
+	}
+}
+
+func (s *M4315Pro) watchdogLoop(ctx context.Context) {
+	defer s.wg.Done()
+	t := time.NewTicker(s.watchdog.conf.interval())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.watchdogTick(ctx)
+		}
+	}
+}
@@ -1,13 +1,8 @@
 package verhboat
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"net"
-	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -19,10 +14,8 @@ import (
 var M4315ProModel = NamespaceFamily.WithModel("m4315-pro")
 
 const (
-	m4315DefaultTCPPort = 23
-	m4315DialTimeout    = 5 * time.Second
-	m4315IOTimeout      = 5 * time.Second
-	m4315SyncInterval   = 5 * time.Minute
+	m4315SyncInterval        = 5 * time.Minute
+	m4315DefaultCycleOffTime = 10 * time.Second
 )
 
 func init() {
@@ -39,6 +32,14 @@ type M4315ProConfig struct {
 	TCPPort  int    `json:"tcp-port,omitempty"`
 	Outlet   int    `json:"outlet"`
 	Password string `json:"password,omitempty"`
+
+	// CycleOffSeconds is how long the outlet stays off during a power cycle.
+	// Defaults to 10 seconds.
+	CycleOffSeconds float64 `json:"cycle-off-seconds,omitempty"`
+
+	// Watchdog, if set, power-cycles the outlet when the device plugged into
+	// it stops answering.
+	Watchdog *M4315WatchdogConfig `json:"watchdog,omitempty"`
 }
 
 func (c *M4315ProConfig) Validate(path string) ([]string, []string, error) {
@@ -48,9 +49,24 @@ func (c *M4315ProConfig) Validate(path string) ([]string, []string, error) {
 	if c.Outlet < 1 || c.Outlet > 8 {
 		return nil, nil, fmt.Errorf("outlet must be between 1 and 8, got %d", c.Outlet)
 	}
+	if c.CycleOffSeconds < 0 {
+		return nil, nil, fmt.Errorf("cycle-off-seconds cannot be negative")
+	}
+	if c.Watchdog != nil {
+		if err := c.Watchdog.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("watchdog: %w", err)
+		}
+	}
 	return nil, nil, nil
 }
 
+func (c *M4315ProConfig) cycleOffTime() time.Duration {
+	if c.CycleOffSeconds == 0 {
+		return m4315DefaultCycleOffTime
+	}
+	return time.Duration(c.CycleOffSeconds * float64(time.Second))
+}
+
 type M4315Pro struct {
 	resource.AlwaysRebuild
 
@@ -58,9 +74,17 @@ type M4315Pro struct {
 	conf   *M4315ProConfig
 	logger logging.Logger
 
+	client *M4315Client
+
 	mu           sync.Mutex
 	lastPosition uint32
 
+	// cycleMu serializes power cycles, so the watchdog and DoCommand can't
+	// interleave their off/on pairs.
+	cycleMu sync.Mutex
+
+	watchdog *m4315Watchdog
+
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 }
@@ -71,11 +95,17 @@ func newM4315Pro(ctx context.Context, deps resource.Dependencies, rawConf resour
 		return nil, err
 	}
 
+	client, err := NewM4315Client(conf.Host, conf.TCPPort, conf.Password, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	bgCtx, cancel := context.WithCancel(context.Background())
 	s := &M4315Pro{
 		name:   rawConf.ResourceName(),
 		conf:   conf,
 		logger: logger,
+		client: client,
 		cancel: cancel,
 	}
 
@@ -88,119 +118,24 @@ func newM4315Pro(ctx context.Context, deps resource.Dependencies, rawConf resour
 	s.wg.Add(1)
 	go s.syncLoop(bgCtx)
 
-	return s, nil
-}
-
-func (s *M4315Pro) tcpPort() int {
-	if s.conf.TCPPort == 0 {
-		return m4315DefaultTCPPort
+	if conf.Watchdog != nil {
+		s.watchdog = newM4315Watchdog(conf.Watchdog)
+		s.wg.Add(1)
+		go s.watchdogLoop(bgCtx)
 	}
-	return s.conf.TCPPort
-}
 
-// dialAndAuth opens a fresh telnet connection and, if a password is configured,
-// logs in. The returned bufio.Reader is positioned past the login prompt.
-func (s *M4315Pro) dialAndAuth() (net.Conn, *bufio.Reader, error) {
-	addr := net.JoinHostPort(s.conf.Host, strconv.Itoa(s.tcpPort()))
-	conn, err := net.DialTimeout("tcp", addr, m4315DialTimeout)
-	if err != nil {
-		return nil, nil, fmt.Errorf("dial %s: %w", addr, err)
-	}
-	_ = conn.SetDeadline(time.Now().Add(m4315IOTimeout))
-
-	reader := bufio.NewReader(conn)
-
-	if s.conf.Password != "" {
-		if err := readUntilPrompt(reader, "password"); err != nil {
-			conn.Close()
-			return nil, nil, fmt.Errorf("waiting for password prompt: %w", err)
-		}
-		if _, err := conn.Write([]byte(s.conf.Password + "\r")); err != nil {
-			conn.Close()
-			return nil, nil, fmt.Errorf("sending password: %w", err)
-		}
-		if err := readUntilPrompt(reader, ">"); err != nil {
-			conn.Close()
-			return nil, nil, fmt.Errorf("waiting for command prompt: %w", err)
-		}
-	}
-
-	return conn, reader, nil
+	return s, nil
 }
 
 // sendSwitch sends one !SWITCH command for the configured outlet.
 func (s *M4315Pro) sendSwitch(state string) error {
-	conn, _, err := s.dialAndAuth()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	cmd := fmt.Sprintf("!SWITCH %d %s\r", s.conf.Outlet, state)
 	s.logger.Debugf("m4315-pro %s outlet %d -> %s", s.conf.Host, s.conf.Outlet, state)
-	if _, err := conn.Write([]byte(cmd)); err != nil {
-		return fmt.Errorf("sending command: %w", err)
-	}
-	return nil
-}
-
-// outletStatusRE matches one outlet line in a ?OUTLETSTAT response, e.g.
-// "$OUTLET1 ON", "$OUTLET1=ON", "$OUTLET1 = OFF".
-var outletStatusRE = regexp.MustCompile(`(?i)\$OUTLET\s*(\d+)\s*[=: ]\s*(ON|OFF)`)
-
-// queryStatus sends ?OUTLETSTAT and returns the on/off state of the configured
-// outlet (true = on).
-func (s *M4315Pro) queryStatus() (bool, error) {
-	conn, reader, err := s.dialAndAuth()
-	if err != nil {
-		return false, err
-	}
-	defer conn.Close()
-
-	if _, err := conn.Write([]byte("?OUTLETSTAT\r")); err != nil {
-		return false, fmt.Errorf("sending query: %w", err)
-	}
-
-	// Read until we've seen our outlet's status or the deadline fires. The
-	// device emits one $OUTLETn line per outlet; we don't know exactly how
-	// many lines it will send, so we read until the deadline ends the
-	// connection and parse what we got.
-	var buf strings.Builder
-	tmp := make([]byte, 256)
-	for {
-		n, err := reader.Read(tmp)
-		if n > 0 {
-			buf.Write(tmp[:n])
-			// Fast-path: if we've already seen our outlet, stop reading.
-			if state, ok := parseOutletStatus(buf.String(), s.conf.Outlet); ok {
-				return state, nil
-			}
-		}
-		if err != nil {
-			// Connection closed or deadline hit; try a final parse.
-			if state, ok := parseOutletStatus(buf.String(), s.conf.Outlet); ok {
-				return state, nil
-			}
-			return false, fmt.Errorf("reading status: %w (got %q)", err, buf.String())
-		}
-	}
-}
-
-// parseOutletStatus scans device output for the configured outlet's state.
-func parseOutletStatus(text string, outlet int) (bool, bool) {
-	for _, m := range outletStatusRE.FindAllStringSubmatch(text, -1) {
-		n, err := strconv.Atoi(m[1])
-		if err != nil || n != outlet {
-			continue
-		}
-		return strings.EqualFold(m[2], "ON"), true
-	}
-	return false, false
+	return s.client.Switch(s.conf.Outlet, state == "ON")
 }
 
 // syncFromDevice queries the device and updates the cached position.
 func (s *M4315Pro) syncFromDevice(ctx context.Context) error {
-	on, err := s.queryStatus()
+	on, err := s.client.OutletStatus(s.conf.Outlet)
 	if err != nil {
 		return err
 	}
@@ -235,23 +170,6 @@ func (s *M4315Pro) syncLoop(ctx context.Context) {
 	}
 }
 
-// readUntilPrompt reads from r until the accumulated input contains substr
-// (case-insensitive), or the connection deadline fires.
-func readUntilPrompt(r *bufio.Reader, substr string) error {
-	want := strings.ToLower(substr)
-	var buf strings.Builder
-	for {
-		b, err := r.ReadByte()
-		if err != nil {
-			return err
-		}
-		buf.WriteByte(b)
-		if strings.Contains(strings.ToLower(buf.String()), want) {
-			return nil
-		}
-	}
-}
-
 func (s *M4315Pro) Name() resource.Name {
 	return s.name
 }
@@ -262,8 +180,82 @@ func (s *M4315Pro) Close(ctx context.Context) error {
 	return nil
 }
 
+// cycle power-cycles the outlet: off, wait offTime, then on. If ctx is
+// cancelled while the outlet is off it is still turned back on, so a cycle
+// never leaves the router or NVR dark.
+func (s *M4315Pro) cycle(ctx context.Context, offTime time.Duration) error {
+	s.cycleMu.Lock()
+	defer s.cycleMu.Unlock()
+
+	s.logger.Infof("m4315-pro %s outlet %d: power cycling (off for %v)", s.conf.Host, s.conf.Outlet, offTime)
+
+	if err := s.SetPosition(ctx, 0, nil); err != nil {
+		return fmt.Errorf("turning outlet off: %w", err)
+	}
+
+	t := time.NewTimer(offTime)
+	defer t.Stop()
+	var waitErr error
+	select {
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	case <-t.C:
+	}
+
+	if err := s.SetPosition(context.Background(), 1, nil); err != nil {
+		return fmt.Errorf("turning outlet back on: %w", err)
+	}
+	return waitErr
+}
+
+// powerCycle cycles the outlet and, once it's back on, tells the watchdog so
+// it leaves the device to boot. Watchdog cycles count against its hourly
+// limit; manual ones don't.
+func (s *M4315Pro) powerCycle(ctx context.Context, offTime time.Duration, byWatchdog bool) error {
+	if err := s.cycle(ctx, offTime); err != nil {
+		return err
+	}
+	if s.watchdog != nil {
+		s.watchdog.cycled(time.Now(), byWatchdog)
+	}
+	return nil
+}
+
+// DoCommand supports:
+//
+//	{"command": "cycle"}                     power-cycle with the configured off time
+//	{"command": "cycle", "off_seconds": 30}  power-cycle with a custom off time
+//	{"command": "status"}                    report position and watchdog state
 func (s *M4315Pro) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	return map[string]interface{}{}, nil
+	command, _ := cmd["command"].(string)
+
+	switch command {
+	case "cycle":
+		offTime := s.conf.cycleOffTime()
+		if v, ok := cmd["off_seconds"]; ok {
+			secs, ok := v.(float64)
+			if !ok || secs < 0 {
+				return nil, fmt.Errorf("cycle needs a non-negative number \"off_seconds\"")
+			}
+			offTime = time.Duration(secs * float64(time.Second))
+		}
+		if err := s.powerCycle(ctx, offTime, false); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"cycled": true, "off_seconds": offTime.Seconds()}, nil
+
+	case "status":
+		s.mu.Lock()
+		res := map[string]interface{}{"position": int(s.lastPosition)}
+		s.mu.Unlock()
+		if s.watchdog != nil {
+			res["watchdog"] = s.watchdog.status(time.Now())
+		}
+		return res, nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
 }
 
 func (s *M4315Pro) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
@@ -0,0 +1,456 @@
+package verhboat
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestParseOutletStatus(t *testing.T) {
+	for _, tc := range []struct {
+		text   string
+		outlet int
+		on     bool
+		found  bool
+	}{
+		{"$OUTLET1 ON", 1, true, true},
+		{"$OUTLET1=OFF", 1, false, true},
+		{"$OUTLET3 = on\r\n", 3, true, true},
+		{"$OUTLET2: OFF", 2, false, true},
+		{"$outlet 4 ON", 4, true, true},
+		{"$OUTLET1 = ON\r\n$OUTLET2 = OFF\r\n", 2, false, true},
+		{"$OUTLET1 = ON\r\n", 2, false, false},
+		{"garbage", 1, false, false},
+		{"", 1, false, false},
+	} {
+		on, found := parseOutletStatus(tc.text, tc.outlet)
+		test.That(t, found, test.ShouldEqual, tc.found)
+		test.That(t, on, test.ShouldEqual, tc.on)
+	}
+
+	all := parseAllOutletStatus("$OUTLET1 = ON\r\n$OUTLET2=OFF\r\n$OUTLET8 ON\r\n")
+	test.That(t, all, test.ShouldResemble, map[int]bool{1: true, 2: false, 8: true})
+}
+
+func newTestM4315Client(t *testing.T, fake *FakeM4315Pro, password string) *M4315Client {
+	t.Helper()
+	client, err := NewM4315Client(fake.Host(), fake.Port(), password, time.Second)
+	test.That(t, err, test.ShouldBeNil)
+	return client
+}
+
+// waitForOutlet waits for a fire-and-forget !SWITCH to land on the fake.
+func waitForOutlet(t *testing.T, fake *FakeM4315Pro, outlet int, on bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for fake.Outlet(outlet) != on {
+		if time.Now().After(deadline) {
+			t.Fatalf("outlet %d never became %v", outlet, on)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestM4315ClientAgainstFake(t *testing.T) {
+	for _, format := range []string{
+		M4315FormatSpacedEquals,
+		M4315FormatEquals,
+		M4315FormatSpace,
+		M4315FormatColon,
+	} {
+		fake, err := NewFakeM4315Pro("127.0.0.1:0", "secret")
+		test.That(t, err, test.ShouldBeNil)
+		fake.SetStatusFormat(format)
+
+		client := newTestM4315Client(t, fake, "secret")
+
+		on, err := client.OutletStatus(3)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldBeFalse)
+
+		test.That(t, client.Switch(3, true), test.ShouldBeNil)
+		waitForOutlet(t, fake, 3, true)
+
+		on, err = client.OutletStatus(3)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldBeTrue)
+
+		fake.SetOutlet(5, true)
+		all, err := client.AllOutletStatus()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(all), test.ShouldEqual, M4315NumOutlets)
+		test.That(t, all[3], test.ShouldBeTrue)
+		test.That(t, all[5], test.ShouldBeTrue)
+		test.That(t, all[1], test.ShouldBeFalse)
+
+		test.That(t, client.Switch(9, true), test.ShouldNotBeNil)
+
+		test.That(t, fake.Close(), test.ShouldBeNil)
+	}
+}
+
+func TestM4315ClientFaults(t *testing.T) {
+	fake, err := NewFakeM4315Pro("127.0.0.1:0", "secret")
+	test.That(t, err, test.ShouldBeNil)
+	defer fake.Close()
+
+	t.Run("wrong password", func(t *testing.T) {
+		client := newTestM4315Client(t, fake, "wrong")
+		_, err := client.OutletStatus(1)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "command prompt")
+	})
+
+	t.Run("no password sent", func(t *testing.T) {
+		client := newTestM4315Client(t, fake, "")
+		_, err := client.OutletStatus(1)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("slow reply", func(t *testing.T) {
+		client := newTestM4315Client(t, fake, "secret")
+		fake.SetReplyDelay(300 * time.Millisecond)
+		defer fake.SetReplyDelay(0)
+
+		on, err := client.OutletStatus(1)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldBeFalse)
+
+		fake.SetReplyDelay(2 * time.Second)
+		_, err = client.OutletStatus(1)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "reading status")
+	})
+
+	t.Run("dropped connection", func(t *testing.T) {
+		client := newTestM4315Client(t, fake, "secret")
+		fake.SetDropConnections(true)
+		defer fake.SetDropConnections(false)
+
+		_, err := client.OutletStatus(1)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("hang up on command", func(t *testing.T) {
+		client := newTestM4315Client(t, fake, "secret")
+		fake.SetHangUpOnCommand(true)
+		defer fake.SetHangUpOnCommand(false)
+
+		_, err := client.OutletStatus(1)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "reading status")
+	})
+}
+
+func TestM4315ProComponent(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.NewTestLogger(t)
+
+	fake, err := NewFakeM4315Pro("127.0.0.1:0", "")
+	test.That(t, err, test.ShouldBeNil)
+	defer fake.Close()
+
+	fake.SetOutlet(2, true)
+
+	conf := &M4315ProConfig{Host: fake.Host(), TCPPort: fake.Port(), Outlet: 2}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	sw, err := newM4315Pro(ctx, nil, resource.Config{
+		Name:                "outlet",
+		API:                 toggleswitch.API,
+		Model:               M4315ProModel,
+		ConvertedAttributes: conf,
+	}, logger)
+	test.That(t, err, test.ShouldBeNil)
+	defer sw.Close(ctx)
+
+	// The initial sync picks up the state set from the "front panel".
+	pos, err := sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 1)
+
+	test.That(t, sw.SetPosition(ctx, 0, nil), test.ShouldBeNil)
+	waitForOutlet(t, fake, 2, false)
+	pos, err = sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+
+	test.That(t, sw.SetPosition(ctx, 2, nil), test.ShouldNotBeNil)
+
+	// Construction fails if the device can't be reached.
+	fake.SetDropConnections(true)
+	_, err = newM4315Pro(ctx, nil, resource.Config{
+		Name:                "outlet",
+		API:                 toggleswitch.API,
+		Model:               M4315ProModel,
+		ConvertedAttributes: conf,
+	}, logger)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func newTestM4315Pro(t *testing.T, conf *M4315ProConfig) *M4315Pro {
+	t.Helper()
+	return newTestM4315ProLogger(t, conf, logging.NewTestLogger(t))
+}
+
+func newTestM4315ProLogger(t *testing.T, conf *M4315ProConfig, logger logging.Logger) *M4315Pro {
+	t.Helper()
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	sw, err := newM4315Pro(context.Background(), nil, resource.Config{
+		Name:                "outlet",
+		API:                 toggleswitch.API,
+		Model:               M4315ProModel,
+		ConvertedAttributes: conf,
+	}, logger)
+	test.That(t, err, test.ShouldBeNil)
+	return sw.(*M4315Pro)
+}
+
+func countCommands(fake *FakeM4315Pro, cmd string) int {
+	n := 0
+	for _, c := range fake.Commands() {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+// waitForCommands waits until the fake has acted on cmd n times.
+func waitForCommands(t *testing.T, fake *FakeM4315Pro, cmd string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for countCommands(fake, cmd) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("never saw %q %d times, got %v", cmd, n, fake.Commands())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestM4315ProCycle(t *testing.T) {
+	ctx := context.Background()
+
+	fake, err := NewFakeM4315Pro("127.0.0.1:0", "")
+	test.That(t, err, test.ShouldBeNil)
+	defer fake.Close()
+	fake.SetOutlet(1, true)
+
+	s := newTestM4315Pro(t, &M4315ProConfig{Host: fake.Host(), TCPPort: fake.Port(), Outlet: 1})
+	defer s.Close(ctx)
+
+	res, err := s.DoCommand(ctx, map[string]interface{}{"command": "cycle", "off_seconds": 0.05})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["cycled"], test.ShouldBeTrue)
+	waitForCommands(t, fake, "!SWITCH 1 ON", 1)
+	test.That(t, countCommands(fake, "!SWITCH 1 OFF"), test.ShouldEqual, 1)
+	test.That(t, fake.Outlet(1), test.ShouldBeTrue)
+
+	// A cancelled cycle still turns the outlet back on.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = s.cycle(cancelled, time.Hour)
+	test.That(t, err, test.ShouldEqual, context.Canceled)
+	waitForCommands(t, fake, "!SWITCH 1 ON", 2)
+	test.That(t, fake.Outlet(1), test.ShouldBeTrue)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "cycle", "off_seconds": "soon"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	res, err = s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["position"], test.ShouldEqual, 1)
+	test.That(t, res["watchdog"], test.ShouldBeNil)
+}
+
+func TestM4315ProWatchdog(t *testing.T) {
+	ctx := context.Background()
+
+	fake, err := NewFakeM4315Pro("127.0.0.1:0", "")
+	test.That(t, err, test.ShouldBeNil)
+	defer fake.Close()
+	fake.SetOutlet(4, true)
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	targetPort := target.Addr().(*net.TCPAddr).Port
+
+	maxReboots := 1
+	s := newTestM4315Pro(t, &M4315ProConfig{
+		Host:            fake.Host(),
+		TCPPort:         fake.Port(),
+		Outlet:          4,
+		CycleOffSeconds: 0.05,
+		Watchdog: &M4315WatchdogConfig{
+			Host:              "127.0.0.1",
+			Port:              targetPort,
+			IntervalSeconds:   3600, // ticks are driven by hand below
+			Failures:          2,
+			MaxRebootsPerHour: &maxReboots,
+			GraceSeconds:      0.001,
+		},
+	})
+	defer s.Close(ctx)
+
+	watchdogStatus := func() map[string]interface{} {
+		res, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+		test.That(t, err, test.ShouldBeNil)
+		return res["watchdog"].(map[string]interface{})
+	}
+
+	s.watchdogTick(ctx)
+	st := watchdogStatus()
+	test.That(t, st["failures"], test.ShouldEqual, 0)
+	test.That(t, st["last_ok"], test.ShouldNotBeNil)
+
+	// The target goes away: one failure is tolerated, the second cycles.
+	test.That(t, target.Close(), test.ShouldBeNil)
+	s.watchdogTick(ctx)
+	test.That(t, watchdogStatus()["failures"], test.ShouldEqual, 1)
+	test.That(t, countCommands(fake, "!SWITCH 4 OFF"), test.ShouldEqual, 0)
+
+	s.watchdogTick(ctx)
+	waitForCommands(t, fake, "!SWITCH 4 ON", 1)
+	test.That(t, countCommands(fake, "!SWITCH 4 OFF"), test.ShouldEqual, 1)
+	st = watchdogStatus()
+	test.That(t, st["failures"], test.ShouldEqual, 0)
+	test.That(t, st["total_reboots"], test.ShouldEqual, 1)
+	test.That(t, st["reboots_last_hour"], test.ShouldEqual, 1)
+	test.That(t, st["last_reboot"], test.ShouldNotBeNil)
+
+	// Still down, but the hourly limit stops another cycle.
+	time.Sleep(10 * time.Millisecond)
+	s.watchdogTick(ctx)
+	s.watchdogTick(ctx)
+	s.watchdogTick(ctx)
+	test.That(t, countCommands(fake, "!SWITCH 4 OFF"), test.ShouldEqual, 1)
+	test.That(t, watchdogStatus()["total_reboots"], test.ShouldEqual, 1)
+
+	// An outlet that was turned off on purpose isn't watched.
+	test.That(t, s.SetPosition(ctx, 0, nil), test.ShouldBeNil)
+	before := watchdogStatus()["failures"]
+	s.watchdogTick(ctx)
+	test.That(t, watchdogStatus()["failures"], test.ShouldEqual, before)
+}
+
+func TestM4315ProWatchdogLimits(t *testing.T) {
+	ctx := context.Background()
+
+	// With a password, a dropped connection fails the command.
+	fake, err := NewFakeM4315Pro("127.0.0.1:0", "secret")
+	test.That(t, err, test.ShouldBeNil)
+	defer fake.Close()
+	fake.SetOutlet(4, true)
+
+	// Nothing listens here, so every check fails.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	targetPort := target.Addr().(*net.TCPAddr).Port
+	test.That(t, target.Close(), test.ShouldBeNil)
+
+	logger, logs := logging.NewObservedTestLogger(t)
+	newWatched := func(maxReboots int) *M4315Pro {
+		return newTestM4315ProLogger(t, &M4315ProConfig{
+			Host:            fake.Host(),
+			TCPPort:         fake.Port(),
+			Password:        "secret",
+			Outlet:          4,
+			CycleOffSeconds: 0.01,
+			Watchdog: &M4315WatchdogConfig{
+				Host:              "127.0.0.1",
+				Port:              targetPort,
+				IntervalSeconds:   3600,
+				Failures:          1,
+				MaxRebootsPerHour: &maxReboots,
+				GraceSeconds:      0.001,
+			},
+		}, logger)
+	}
+	watchdogStatus := func(s *M4315Pro) map[string]interface{} {
+		res, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+		test.That(t, err, test.ShouldBeNil)
+		return res["watchdog"].(map[string]interface{})
+	}
+
+	// 0 only watches, and says so once per outage.
+	s := newWatched(0)
+	s.watchdogTick(ctx)
+	s.watchdogTick(ctx)
+	s.watchdogTick(ctx)
+	test.That(t, countCommands(fake, "!SWITCH 4 OFF"), test.ShouldEqual, 0)
+	st := watchdogStatus(s)
+	test.That(t, st["failures"], test.ShouldEqual, 0)
+	test.That(t, st["limited"], test.ShouldBeTrue)
+	test.That(t, logs.FilterMessageSnippet("power cycling is disabled").Len(), test.ShouldEqual, 1)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+
+	// -1 has no limit.
+	s = newWatched(-1)
+	for i := 1; i <= 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+		s.watchdogTick(ctx)
+		waitForCommands(t, fake, "!SWITCH 4 ON", i)
+	}
+	test.That(t, watchdogStatus(s)["total_reboots"], test.ShouldEqual, 3)
+	test.That(t, watchdogStatus(s)["max_reboots_per_hour"], test.ShouldEqual, -1)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+
+	// A power cycle that fails doesn't use up the hourly budget.
+	s = newWatched(1)
+	fake.SetDropConnections(true)
+	s.watchdogTick(ctx)
+	st = watchdogStatus(s)
+	test.That(t, st["total_reboots"], test.ShouldEqual, 0)
+	test.That(t, st["reboots_last_hour"], test.ShouldEqual, 0)
+
+	fake.SetDropConnections(false)
+	offs := countCommands(fake, "!SWITCH 4 OFF")
+	s.watchdogTick(ctx)
+	waitForCommands(t, fake, "!SWITCH 4 OFF", offs+1)
+	test.That(t, watchdogStatus(s)["total_reboots"], test.ShouldEqual, 1)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+
+	// A cycle by hand resets the failures and waits out the boot too, without
+	// using up the budget.
+	s = newTestM4315Pro(t, &M4315ProConfig{
+		Host:            fake.Host(),
+		TCPPort:         fake.Port(),
+		Password:        "secret",
+		Outlet:          4,
+		CycleOffSeconds: 0.01,
+		Watchdog: &M4315WatchdogConfig{
+			Host:            "127.0.0.1",
+			Port:            targetPort,
+			IntervalSeconds: 3600,
+			Failures:        2,
+			GraceSeconds:    3600,
+		},
+	})
+	s.watchdogTick(ctx)
+	test.That(t, watchdogStatus(s)["failures"], test.ShouldEqual, 1)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "cycle"})
+	test.That(t, err, test.ShouldBeNil)
+	st = watchdogStatus(s)
+	test.That(t, st["failures"], test.ShouldEqual, 0)
+	test.That(t, st["in_grace"], test.ShouldBeTrue)
+	test.That(t, st["total_reboots"], test.ShouldEqual, 0)
+	offs = countCommands(fake, "!SWITCH 4 OFF")
+	s.watchdogTick(ctx)
+	s.watchdogTick(ctx)
+	test.That(t, countCommands(fake, "!SWITCH 4 OFF"), test.ShouldEqual, offs)
+	test.That(t, watchdogStatus(s)["failures"], test.ShouldEqual, 0)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+
+	bad := -2
+	conf := &M4315WatchdogConfig{Host: "127.0.0.1", Port: 80, MaxRebootsPerHour: &bad}
+	test.That(t, conf.Validate(), test.ShouldNotBeNil)
+}
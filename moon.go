@@ -0,0 +1,130 @@
+package verhboat
+
+// erh:verhboat:moon reports the moon's phase, illumination, position and
+// next moonrise/moonset at the boat's GPS position, along with the day's sun
+// times, for planning nights at anchor and fishing trips.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var MoonModel = NamespaceFamily.WithModel("moon")
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		MoonModel,
+		resource.Registration[sensor.Sensor, *MoonConfig]{
+			Constructor: newMoon,
+		})
+}
+
+type MoonConfig struct {
+	// MovementSensor gives the boat's position.
+	MovementSensor string `json:"movement-sensor"`
+
+	// Timezone for the reported times and for which day's sun times are
+	// reported; defaults to the machine's, "gps" for the time zone at the
+	// boat's position.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (c *MoonConfig) Validate(path string) ([]string, []string, error) {
+	if c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("need a movement-sensor")
+	}
+	if _, err := loadTimezone(c.Timezone); err != nil {
+		return nil, nil, err
+	}
+	return []string{c.MovementSensor}, nil, nil
+}
+
+type Moon struct {
+	resource.AlwaysRebuild
+
+	name     resource.Name
+	movement movementsensor.MovementSensor
+	timezone string
+	loc      *time.Location
+
+	now func() time.Time
+}
+
+func newMoon(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	conf, err := resource.NativeConfig[*MoonConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := loadTimezone(conf.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Moon{name: rawConf.ResourceName(), timezone: conf.Timezone, loc: loc, now: time.Now}
+	m.movement, err = movementsensor.FromDependencies(deps, conf.MovementSensor)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Moon) Name() resource.Name {
+	return m.name
+}
+
+func (m *Moon) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (m *Moon) Close(ctx context.Context) error {
+	return nil
+}
+
+func (m *Moon) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	point, _, err := m.movement.Position(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading position: %w", err)
+	}
+	loc := zoneAt(m.timezone, m.loc, point.Lat(), point.Lng())
+	return moonReadings(m.now().In(loc), point.Lat(), point.Lng()), nil
+}
+
+// moonReadings are the readings at now, at lat, lng. Times are RFC3339 in
+// now's location; events that don't happen are left out.
+func moonReadings(now time.Time, lat, lng float64) map[string]interface{} {
+	phase, illumination := MoonPhase(now)
+	moonAz, moonAlt := MoonPosition(now, lat, lng)
+	sunAz, sunEl := SunPosition(now, lat, lng)
+
+	res := map[string]interface{}{
+		"latitude":          lat,
+		"longitude":         lng,
+		"moon_phase":        phase,
+		"moon_phase_name":   MoonPhaseName(phase),
+		"moon_illumination": illumination,
+		"moon_azimuth":      moonAz,
+		"moon_altitude":     moonAlt,
+		"moon_up":           moonAlt > moonHorizonAltitude,
+		"sun_azimuth":       sunAz,
+		"sun_elevation":     sunEl,
+	}
+
+	rise, set := MoonRiseSet(now, lat, lng)
+	if !rise.IsZero() {
+		res["next_moonrise"] = rise.In(now.Location()).Format(time.RFC3339)
+	}
+	if !set.IsZero() {
+		res["next_moonset"] = set.In(now.Location()).Format(time.RFC3339)
+	}
+
+	addSunDayReadings(res, now, lat, lng)
+	return res
+}
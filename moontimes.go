@@ -0,0 +1,174 @@
+package verhboat
+
+// Moon position, phase and moonrise/moonset, from the main terms of the
+// lunar series in Meeus' "Astronomical Algorithms", chapter 47. Good to a
+// few minutes for moonrise and moonset and a percent or so for
+// illumination, which is plenty for planning a night at anchor or out
+// fishing.
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Moonrise and moonset are when the moon's center is at +0.125°
+	// (geocentric): its parallax (~0.95°) drops it more than refraction and
+	// its radius lift it.
+	moonHorizonAltitude = 0.125
+
+	// How finely MoonRiseSet scans the moon's altitude. The moon moves
+	// ~15°/hour in hour angle, so linear interpolation over this is good to
+	// well under a minute.
+	moonScanStep = 10 * time.Minute
+
+	sunDistanceKm = 149598000.0
+)
+
+// moonTerm is one periodic term of the moon's longitude or latitude
+// (degrees) or distance (km), in multiples of D, M, M' and F.
+type moonTerm struct {
+	d, m, mp, f float64
+	coeff       float64
+}
+
+// The largest terms of Meeus' tables 47.A and 47.B; the ones left out are
+// each under 0.004° (or 100 km).
+var (
+	moonLongitudeTerms = []moonTerm{
+		{0, 0, 1, 0, 6.288774}, {2, 0, -1, 0, 1.274027}, {2, 0, 0, 0, 0.658314},
+		{0, 0, 2, 0, 0.213618}, {0, 1, 0, 0, -0.185116}, {0, 0, 0, 2, -0.114332},
+		{2, 0, -2, 0, 0.058793}, {2, -1, -1, 0, 0.057066}, {2, 0, 1, 0, 0.053322},
+		{2, -1, 0, 0, 0.045758}, {0, 1, -1, 0, -0.040923}, {1, 0, 0, 0, -0.034720},
+		{0, 1, 1, 0, -0.030383}, {2, 0, 0, -2, 0.015327}, {0, 0, 1, 2, -0.012528},
+		{0, 0, 1, -2, 0.010980}, {4, 0, -1, 0, 0.010675}, {0, 0, 3, 0, 0.010034},
+		{4, 0, -2, 0, 0.008548}, {2, 1, -1, 0, -0.007888}, {2, 1, 0, 0, -0.006766},
+		{1, 0, -1, 0, -0.005163}, {1, 1, 0, 0, 0.004987}, {2, -1, 1, 0, 0.004036},
+	}
+	moonLatitudeTerms = []moonTerm{
+		{0, 0, 0, 1, 5.128122}, {0, 0, 1, 1, 0.280602}, {0, 0, 1, -1, 0.277693},
+		{2, 0, 0, -1, 0.173237}, {2, 0, -1, 1, 0.055413}, {2, 0, -1, -1, 0.046271},
+		{2, 0, 0, 1, 0.032573}, {0, 0, 2, 1, 0.017198}, {2, 0, 1, -1, 0.009266},
+		{0, 0, 2, -1, 0.008822},
+	}
+	moonDistanceTerms = []moonTerm{
+		{0, 0, 1, 0, -20905.355}, {2, 0, -1, 0, -3699.111}, {2, 0, 0, 0, -2955.968},
+		{0, 0, 2, 0, -569.925}, {2, 0, -2, 0, 246.158}, {2, -1, 0, 0, -204.586},
+		{2, 0, 1, 0, -170.733}, {2, -1, -1, 0, -152.138}, {0, 1, -1, 0, -129.620},
+		{1, 0, 0, 0, 108.743}, {0, 1, 1, 0, 104.755},
+	}
+)
+
+// moonEquatorial returns the moon's right ascension and declination
+// (radians) and its distance (km), d days after J2000.0.
+func moonEquatorial(d float64) (ra, dec, dist float64) {
+	t := d / 36525                                        // Julian centuries
+	l := 218.3164477 + 481267.88123421*t                  // mean longitude
+	dArg := (297.8501921 + 445267.1114034*t) * sunDegRad  // mean elongation
+	mArg := (357.5291092 + 35999.0502909*t) * sunDegRad   // sun's mean anomaly
+	mpArg := (134.9633964 + 477198.8675055*t) * sunDegRad // moon's mean anomaly
+	fArg := (93.2720950 + 483202.0175233*t) * sunDegRad   // argument of latitude
+
+	// Terms with the sun's anomaly shrink as the earth's orbit gets rounder.
+	e := 1 - 0.002516*t
+	sum := func(terms []moonTerm, f func(float64) float64) float64 {
+		total := 0.0
+		for _, term := range terms {
+			c := term.coeff * math.Pow(e, math.Abs(term.m))
+			total += c * f(term.d*dArg+term.m*mArg+term.mp*mpArg+term.f*fArg)
+		}
+		return total
+	}
+
+	lng := (l + sum(moonLongitudeTerms, math.Sin)) * sunDegRad
+	lat := sum(moonLatitudeTerms, math.Sin) * sunDegRad
+	dist = 385000.56 + sum(moonDistanceTerms, math.Cos)
+
+	ra, dec = eclipticToEquatorial(lng, lat)
+	return ra, dec, dist
+}
+
+// MoonPosition returns the moon's azimuth (degrees clockwise from true north)
+// and altitude (degrees above the horizon, geocentric, without refraction)
+// at time t, at the given latitude and longitude (degrees, longitude
+// positive east).
+func MoonPosition(t time.Time, lat, lng float64) (azimuth, altitude float64) {
+	d := julianDate(t) - 2451545.0
+	ra, dec, _ := moonEquatorial(d)
+	return horizontalPosition(d, lat, lng, ra, dec)
+}
+
+// MoonPhase returns the moon's phase at t, going from 0 (new) through 0.25
+// (first quarter), 0.5 (full) and 0.75 (last quarter) back to 1, and the
+// fraction of its disc that's lit.
+func MoonPhase(t time.Time) (phase, illumination float64) {
+	d := julianDate(t) - 2451545.0
+	sra, sdec := sunEquatorial(d)
+	mra, mdec, mdist := moonEquatorial(d)
+
+	// Elongation of the moon from the sun, then the phase angle seen from
+	// the moon.
+	phi := math.Acos(math.Sin(sdec)*math.Sin(mdec) + math.Cos(sdec)*math.Cos(mdec)*math.Cos(sra-mra))
+	inc := math.Atan2(sunDistanceKm*math.Sin(phi), mdist-sunDistanceKm*math.Cos(phi))
+
+	// Which side of the sun the moon is on: waxing or waning.
+	angle := math.Atan2(math.Cos(sdec)*math.Sin(sra-mra), math.Sin(sdec)*math.Cos(mdec)-math.Cos(sdec)*math.Sin(mdec)*math.Cos(sra-mra))
+
+	illumination = (1 + math.Cos(inc)) / 2
+	if angle < 0 {
+		phase = 0.5 - 0.5*inc/math.Pi
+	} else {
+		phase = 0.5 + 0.5*inc/math.Pi
+	}
+	return phase, illumination
+}
+
+var moonPhaseNames = []string{
+	"new moon",
+	"waxing crescent",
+	"first quarter",
+	"waxing gibbous",
+	"full moon",
+	"waning gibbous",
+	"last quarter",
+	"waning crescent",
+}
+
+// MoonPhaseName names a phase from MoonPhase, e.g. "waxing gibbous".
+func MoonPhaseName(phase float64) string {
+	return moonPhaseNames[int(math.Round(phase*8))%8]
+}
+
+// MoonRiseSet returns the first moonrise and moonset in the 24 hours from
+// start, each zero if there isn't one. The moon rises about 50 minutes later
+// each day, so most months have a day without a moonrise and one without a
+// moonset; at high latitudes it can stay up or down for days.
+func MoonRiseSet(start time.Time, lat, lng float64) (rise, set time.Time) {
+	above := func(t time.Time) float64 {
+		_, alt := MoonPosition(t, lat, lng)
+		return alt - moonHorizonAltitude
+	}
+
+	end := start.Add(24 * time.Hour)
+	t0, h0 := start, above(start)
+	for t0.Before(end) {
+		t1 := t0.Add(moonScanStep)
+		h1 := above(t1)
+		if (h0 < 0) != (h1 < 0) {
+			at := t0.Add(time.Duration(float64(moonScanStep) * h0 / (h0 - h1)))
+			if !at.Before(end) {
+				break
+			}
+			if h1 >= 0 && rise.IsZero() {
+				rise = at
+			} else if h1 < 0 && set.IsZero() {
+				set = at
+			}
+		}
+		if !rise.IsZero() && !set.IsZero() {
+			break
+		}
+		t0, h0 = t1, h1
+	}
+	return rise.Round(time.Second), set.Round(time.Second)
+}
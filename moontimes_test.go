@@ -0,0 +1,131 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestMoonPhase(t *testing.T) {
+	// Published new and full moons (UTC), the eclipses of 2026.
+	for _, tc := range []struct {
+		at    time.Time
+		phase float64
+		lit   float64
+		name  string
+	}{
+		{time.Date(2026, 2, 17, 12, 1, 0, 0, time.UTC), 0, 0, "new moon"},            // annular solar eclipse
+		{time.Date(2026, 3, 3, 11, 38, 0, 0, time.UTC), 0.5, 1, "full moon"},         // total lunar eclipse
+		{time.Date(2026, 8, 12, 17, 37, 0, 0, time.UTC), 0, 0, "new moon"},           // total solar eclipse
+		{time.Date(2026, 8, 28, 4, 18, 0, 0, time.UTC), 0.5, 1, "full moon"},         // partial lunar eclipse
+		{time.Date(2026, 2, 24, 12, 28, 0, 0, time.UTC), 0.25, 0.5, "first quarter"}, // between them
+	} {
+		phase, lit := MoonPhase(tc.at)
+		if phase > 0.9 {
+			phase-- // just before new is as good as just after
+		}
+		test.That(t, phase, test.ShouldAlmostEqual, tc.phase, 0.02)
+		test.That(t, lit, test.ShouldAlmostEqual, tc.lit, 0.02)
+		test.That(t, MoonPhaseName(phase), test.ShouldEqual, tc.name)
+	}
+
+	test.That(t, MoonPhaseName(0.1), test.ShouldEqual, "waxing crescent")
+	test.That(t, MoonPhaseName(0.4), test.ShouldEqual, "waxing gibbous")
+	test.That(t, MoonPhaseName(0.6), test.ShouldEqual, "waning gibbous")
+	test.That(t, MoonPhaseName(0.9), test.ShouldEqual, "waning crescent")
+	test.That(t, MoonPhaseName(0.98), test.ShouldEqual, "new moon")
+}
+
+func TestMoonEquatorial(t *testing.T) {
+	// Meeus, "Astronomical Algorithms", example 47.a: 1992 April 12 at 0h TD
+	// (a minute ahead of UTC), α 134.688470°, δ +13.768368°, 368409.7 km.
+	d := julianDate(time.Date(1992, 4, 12, 0, 0, 0, 0, time.UTC)) - 2451545.0
+	ra, dec, dist := moonEquatorial(d)
+	test.That(t, ra/sunDegRad, test.ShouldAlmostEqual, 134.688470, 0.02)
+	test.That(t, dec/sunDegRad, test.ShouldAlmostEqual, 13.768368, 0.02)
+	test.That(t, dist, test.ShouldAlmostEqual, 368409.7, 50)
+}
+
+func TestMoonRiseSet(t *testing.T) {
+	lat, lng := 40.7128, -74.0060
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	// A full moon rises around sunset and sets around sunrise.
+	day := time.Date(2026, 3, 3, 0, 0, 0, 0, ny)
+	rise, set := MoonRiseSet(day, lat, lng)
+	sunrise, sunset, err := SunTimes(day.Add(12*time.Hour).UTC(), lat, lng)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, within(rise, sunset, time.Hour), test.ShouldBeTrue)
+	test.That(t, within(set, sunrise, time.Hour), test.ShouldBeTrue)
+
+	// At moonrise it's on the horizon, in the east.
+	az, alt := MoonPosition(rise, lat, lng)
+	test.That(t, alt, test.ShouldAlmostEqual, moonHorizonAltitude, 0.1)
+	test.That(t, az, test.ShouldBeBetween, 45, 135)
+
+	// A new moon rises with the sun.
+	day = time.Date(2026, 8, 12, 0, 0, 0, 0, ny)
+	rise, _ = MoonRiseSet(day, lat, lng)
+	sunrise, _, err = SunTimes(day.Add(12*time.Hour).UTC(), lat, lng)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, within(rise, sunrise, time.Hour), test.ShouldBeTrue)
+
+	// It rises later each day, so one day in March has no moonrise.
+	prev, _ := MoonRiseSet(time.Date(2026, 3, 1, 0, 0, 0, 0, ny), lat, lng)
+	days := map[int]bool{}
+	for prev.In(ny).Month() == time.March {
+		days[prev.In(ny).Day()] = true
+		rise, _ := MoonRiseSet(prev.Add(2*time.Hour), lat, lng)
+		test.That(t, rise.Sub(prev), test.ShouldBeBetween, 24*time.Hour+10*time.Minute, 25*time.Hour+50*time.Minute)
+		prev = rise
+	}
+	test.That(t, len(days), test.ShouldEqual, 30)
+}
+
+func TestMoonSensor(t *testing.T) {
+	ctx := context.Background()
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	conf := &MoonConfig{MovementSensor: "gps", Timezone: "America/New_York"}
+	deps, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"gps"})
+	_, _, err = (&MoonConfig{}).Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	res, err := newMoon(ctx, resource.Dependencies{
+		movementsensor.Named("gps"): &testGPS{lat: 40.7128, lng: -74.0060},
+	}, resource.Config{Name: "moon", API: sensor.API, ConvertedAttributes: conf}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer res.Close(ctx)
+
+	// Full moon evening.
+	m := res.(*Moon)
+	m.now = func() time.Time { return time.Date(2026, 3, 3, 21, 0, 0, 0, ny) }
+	readings, err := m.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["moon_phase_name"], test.ShouldEqual, "full moon")
+	test.That(t, readings["moon_illumination"], test.ShouldBeGreaterThan, 0.99)
+	test.That(t, readings["moon_up"], test.ShouldBeTrue)
+	test.That(t, readings["next_moonset"], test.ShouldStartWith, "2026-03-04T06:")
+	test.That(t, readings["next_moonrise"], test.ShouldStartWith, "2026-03-04T19:")
+	test.That(t, readings["sunset"], test.ShouldStartWith, "2026-03-03T17:")
+	test.That(t, readings["civil_dusk"], test.ShouldStartWith, "2026-03-03T18:")
+	test.That(t, readings["day_length_minutes"], test.ShouldBeBetween, 11*60, 12*60)
+	test.That(t, readings["sun_elevation"], test.ShouldBeLessThan, -10)
+
+	// "gps" reports times in the zone where the boat is.
+	m.timezone, m.loc = gpsTimezone, time.UTC
+	readings, err = m.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["sunset"], test.ShouldStartWith, "2026-03-03T17:")
+	test.That(t, readings["sunset"], test.ShouldEndWith, "-05:00")
+}
@@ -1,19 +1,14 @@
 package verhboat
 
 // erh:verhboat:nicolaudie-stick3 drives a Nicolaudie STICK-DE3 lighting
-// controller (e.g. a yacht name sign) over its UDP quick-trigger protocol.
-//
-// If a movement sensor (a GPS) is configured, the sign is turned on
-// automatically one hour before sunset and off at sunrise, using the sun
-// times at the sensor's current position. Without a movement sensor there is
-// no schedule and the sign is controlled manually via DoCommand.
-//
-// Scheduling of color patterns is a planned follow-up; for now a single hex
-// color is shown while the sign is on.
+// controller (e.g. a yacht name sign) over its UDP quick-trigger protocol,
+// on a sun-relative schedule or by hand; see the README.
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -28,7 +23,7 @@ var NicolaudieStick3Model = NamespaceFamily.WithModel("nicolaudie-stick3")
 const (
 	stick3SendTimeout   = 2 * time.Second
 	stick3TickInterval  = 1 * time.Minute
-	stick3SunsetLeadIn  = 1 * time.Hour // turn on this long before sunset
+	stick3DefaultResend = 5 * time.Minute
 	stick3DefaultPageAt = "A"
 	stick3DefaultScene  = 1
 )
@@ -43,6 +38,8 @@ func init() {
 }
 
 type NicolaudieStick3Config struct {
+	// IP is the controller's IPv4 or IPv6 address, a hostname (looked up
+	// again every few minutes and whenever a send fails) or "broadcast".
 	IP   string `json:"ip"`
 	Port int    `json:"port,omitempty"`
 
@@ -59,12 +56,75 @@ type NicolaudieStick3Config struct {
 	// page A, scene 1.
 	Page  string `json:"page,omitempty"`
 	Scene int    `json:"scene,omitempty"`
+
+	// ZoneSyncID is the STICK zone synchronization ID sent with the sign's
+	// triggers, 0-255.
+	ZoneSyncID int `json:"zone_sync_id,omitempty"`
+
+	// Zones are other scenes on the same controller, controlled by name.
+	Zones []Stick3Zone `json:"zones,omitempty"`
+
+	// Presets are named looks for the sign, chosen with the "preset"
+	// command or as switch positions by nicolaudie-stick3-switch.
+	Presets []Stick3Preset `json:"presets,omitempty"`
+
+	// OnAt and OffAt move the default schedule used without a Schedule: on
+	// at OnAt (default "sunset-1h"), off at OffAt (default "sunrise"). Either
+	// is "HH:MM" local or a sun event with an optional offset, such as
+	// "civil_dusk+15m". OffAfterHours turns the sign off that long after it
+	// came on, if that's before OffAt.
+	OnAt          string  `json:"on_at,omitempty"`
+	OffAt         string  `json:"off_at,omitempty"`
+	OffAfterHours float64 `json:"off_after_hours,omitempty"`
+
+	// Schedule replaces the default sunset/sunrise schedule; the first entry
+	// whose window contains the current time is shown, and the sign is off
+	// when none does. Times and dates are in Timezone (default the machine's;
+	// "gps" for the time zone at the GPS position).
+	Schedule []Stick3ScheduleEntry `json:"schedule,omitempty"`
+	Timezone string                `json:"timezone,omitempty"`
+
+	// Holidays names lists of dates ("MM-DD" or "YYYY-MM-DD") that schedule
+	// entries can use alongside the built-in holidays, e.g. game days.
+	Holidays map[string][]string `json:"holidays,omitempty"`
+
+	// AnimationFPS is how many color/dimmer updates a second animations
+	// stream to the STICK. Defaults to 10.
+	AnimationFPS float64 `json:"animation_fps,omitempty"`
+
+	// ReassertSeconds is how often the sign's state is re-sent, unless the
+	// controller reports it's already showing it. Defaults to 300; negative
+	// turns it off.
+	ReassertSeconds float64 `json:"reassert_seconds,omitempty"`
+
+	// StatusReadback asks the controller what it's showing before
+	// re-sending, and allows read_status. Off by default: the status query
+	// is speculative (see stick3_status.go).
+	StatusReadback bool `json:"status_readback,omitempty"`
+
+	// PacingMS is the gap between packets to the controller, which drops
+	// packets that come too close together. Defaults to 20; negative sends
+	// them as fast as they come. Repeat sends each packet that many times,
+	// 1-5, for lossy links.
+	PacingMS float64 `json:"pacing_ms,omitempty"`
+	Repeat   int     `json:"repeat,omitempty"`
+
+	// StateFile keeps manual overrides and the color set with set_color
+	// across restarts (see stick3_override.go). Defaults to a file named for
+	// the component in $VIAM_MODULE_DATA; "none" turns it off.
+	StateFile string `json:"state_file,omitempty"`
 }
 
 func (c *NicolaudieStick3Config) Validate(path string) ([]string, []string, error) {
 	if c.IP == "" {
 		return nil, nil, fmt.Errorf("need an ip")
 	}
+	if err := ValidateStickHost(c.IP); err != nil {
+		return nil, nil, err
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return nil, nil, fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
+	}
 
 	if _, err := ParseStickPage(c.pageOrDefault()); err != nil {
 		return nil, nil, err
@@ -80,6 +140,75 @@ func (c *NicolaudieStick3Config) Validate(path string) ([]string, []string, erro
 		}
 	}
 
+	if err := validateZoneSyncID(c.ZoneSyncID); err != nil {
+		return nil, nil, err
+	}
+	zoneNames := map[string]bool{}
+	for i := range c.Zones {
+		z := &c.Zones[i]
+		if err := z.validate(); err != nil {
+			return nil, nil, err
+		}
+		if zoneNames[z.Name] {
+			return nil, nil, fmt.Errorf("zone %s is listed twice", z.Name)
+		}
+		zoneNames[z.Name] = true
+	}
+	presetNames := map[string]bool{}
+	for i := range c.Presets {
+		p := &c.Presets[i]
+		if err := p.validate(); err != nil {
+			return nil, nil, err
+		}
+		if presetNames[p.Name] {
+			return nil, nil, fmt.Errorf("preset %s is listed twice", p.Name)
+		}
+		presetNames[p.Name] = true
+	}
+
+	if c.PacingMS > 1000 {
+		return nil, nil, fmt.Errorf("pacing_ms must be at most 1000, got %v", c.PacingMS)
+	}
+	if c.Repeat < 0 || c.Repeat > stickMaxRepeat {
+		return nil, nil, fmt.Errorf("repeat must be between 1 and %d, got %d", stickMaxRepeat, c.Repeat)
+	}
+
+	if c.AnimationFPS < 0 || c.AnimationFPS > stick3MaxFPS {
+		return nil, nil, fmt.Errorf("animation_fps must be between 0 and %v, got %v", stick3MaxFPS, c.AnimationFPS)
+	}
+
+	if _, err := c.location(); err != nil {
+		return nil, nil, err
+	}
+	if c.Timezone == gpsTimezone && c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("timezone gps needs a movement_sensor")
+	}
+
+	rules, err := c.onRules()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.hasOnRules() && len(c.Schedule) == 0 && rules.usesSun() && c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("on_at/off_at relative to the sun need a movement_sensor")
+	}
+
+	for name, dates := range c.Holidays {
+		for _, d := range dates {
+			if _, err := parseStick3Date(d); err != nil {
+				return nil, nil, fmt.Errorf("holiday %q: %w", name, err)
+			}
+		}
+	}
+	for i := range c.Schedule {
+		e := &c.Schedule[i]
+		if err := e.validate(c.Holidays); err != nil {
+			return nil, nil, fmt.Errorf("schedule %s: %w", e.displayName(i), err)
+		}
+		if e.usesSun() && c.MovementSensor == "" {
+			return nil, nil, fmt.Errorf("schedule %s uses sun times, which need a movement_sensor", e.displayName(i))
+		}
+	}
+
 	var deps []string
 	if c.MovementSensor != "" {
 		deps = append(deps, c.MovementSensor)
@@ -87,6 +216,52 @@ func (c *NicolaudieStick3Config) Validate(path string) ([]string, []string, erro
 	return deps, nil, nil
 }
 
+func (c *NicolaudieStick3Config) location() (*time.Location, error) {
+	return loadTimezone(c.Timezone)
+}
+
+func (c *NicolaudieStick3Config) hasOnRules() bool {
+	return c.OnAt != "" || c.OffAt != "" || c.OffAfterHours != 0
+}
+
+func (c *NicolaudieStick3Config) onRules() (sunOnRules, error) {
+	on, off := c.OnAt, c.OffAt
+	if on == "" {
+		on = stick3DefaultStart
+	}
+	if off == "" {
+		off = stick3DefaultEnd
+	}
+	return makeSunOnRules(on, off, c.OffAfterHours)
+}
+
+func (c *NicolaudieStick3Config) fps() float64 {
+	if c.AnimationFPS == 0 {
+		return stick3DefaultFPS
+	}
+	return c.AnimationFPS
+}
+
+func (c *NicolaudieStick3Config) reassertInterval() time.Duration {
+	if c.ReassertSeconds == 0 {
+		return stick3DefaultResend
+	}
+	if c.ReassertSeconds < 0 {
+		return 0
+	}
+	return time.Duration(c.ReassertSeconds * float64(time.Second))
+}
+
+func (c *NicolaudieStick3Config) pacing() time.Duration {
+	if c.PacingMS == 0 {
+		return StickDefaultPacing
+	}
+	if c.PacingMS < 0 {
+		return 0
+	}
+	return time.Duration(c.PacingMS * float64(time.Millisecond))
+}
+
 func (c *NicolaudieStick3Config) pageOrDefault() string {
 	if c.Page == "" {
 		return stick3DefaultPageAt
@@ -101,6 +276,13 @@ func (c *NicolaudieStick3Config) sceneOrDefault() int {
 	return c.Scene
 }
 
+// stick3Look is what the sign shows while it's on.
+type stick3Look struct {
+	page, scene   int
+	red, grn, blu byte
+	dimmer, speed *int // percent; nil leaves the scene's own
+}
+
 type NicolaudieStick3 struct {
 	resource.AlwaysRebuild
 
@@ -108,15 +290,34 @@ type NicolaudieStick3 struct {
 	conf   *NicolaudieStick3Config
 	logger logging.Logger
 
-	client *Stick3Client
-	page   int
-	scene  int
+	controller *Stick3Client // for the whole controller, e.g. blackout
+	client     *Stick3Client // for the sign's scene, with its zone sync ID
+	base       stick3Look    // from the config, used outside of schedule entries
+	rules      sunOnRules
+	loc        *time.Location
 
 	movement movementsensor.MovementSensor
 
-	mu            sync.Mutex
-	on            bool
-	red, grn, blu byte
+	mu        sync.Mutex
+	on        bool
+	asserted  bool       // whether on has been sent to the controller yet
+	look      stick3Look // shown while on
+	active    int        // schedule entry being shown, or -1
+	scheduled string     // what the schedule wanted at its last check, see scheduleKey
+	override  *stick3Override
+	stateFile string
+
+	now func() time.Time
+
+	readback   *StickStatus // the controller's last status reply
+	readbackAt time.Time
+
+	zones     map[string]*stick3ZoneState
+	zoneNames []string // in config order
+	blackout  bool
+
+	anim       *stick3Animation // running animation, or nil
+	animCancel context.CancelFunc
 
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
@@ -128,6 +329,41 @@ func newNicolaudieStick3(ctx context.Context, deps resource.Dependencies, rawCon
 		return nil, err
 	}
 
+	s, err := makeNicolaudieStick3(deps, rawConf.ResourceName(), conf, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled := s.hasSchedule()
+	if !scheduled && s.override != nil {
+		// Nothing else will; put back what was set by hand before the restart.
+		s.mu.Lock()
+		if err := s.applyOverrideLocked(); err != nil {
+			s.logger.Warnf("nicolaudie-stick3 %s: restoring override: %v", s.conf.IP, err)
+		}
+		s.mu.Unlock()
+	}
+
+	reassert := conf.reassertInterval()
+	if scheduled || reassert > 0 {
+		bgCtx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		if scheduled {
+			s.wg.Add(1)
+			go s.scheduleLoop(bgCtx)
+		}
+		if reassert > 0 {
+			s.wg.Add(1)
+			go s.reassertLoop(bgCtx, reassert)
+		}
+	}
+
+	return s, nil
+}
+
+// makeNicolaudieStick3 builds the component, restoring its state file,
+// without starting its loops or sending anything.
+func makeNicolaudieStick3(deps resource.Dependencies, name resource.Name, conf *NicolaudieStick3Config, logger logging.Logger) (*NicolaudieStick3, error) {
 	port := conf.Port
 	if port == 0 {
 		port = StickDefaultPort
@@ -137,41 +373,63 @@ func newNicolaudieStick3(ctx context.Context, deps resource.Dependencies, rawCon
 	if err != nil {
 		return nil, err
 	}
+	client.SetPacing(conf.pacing())
+	if conf.Repeat > 0 {
+		client.SetRepeat(conf.Repeat)
+	}
 
 	page, err := ParseStickPage(conf.pageOrDefault())
 	if err != nil {
 		return nil, err
 	}
 
+	loc, err := conf.location()
+	if err != nil {
+		return nil, err
+	}
+
 	s := &NicolaudieStick3{
-		name:   rawConf.ResourceName(),
-		conf:   conf,
-		logger: logger,
-		client: client,
-		page:   page,
-		scene:  conf.sceneOrDefault(),
+		name:       name,
+		conf:       conf,
+		logger:     logger,
+		controller: client,
+		client:     client.WithZone(byte(conf.ZoneSyncID)),
+		base:       stick3Look{page: page, scene: conf.sceneOrDefault()},
+		loc:        loc,
+		active:     -1,
+		zones:      map[string]*stick3ZoneState{},
+		stateFile:  conf.stateFile(name.Name),
+		now:        time.Now,
+	}
+
+	for i := range conf.Zones {
+		z := &conf.Zones[i]
+		s.zones[z.Name] = newStick3ZoneState(z, client)
+		s.zoneNames = append(s.zoneNames, z.Name)
+	}
+
+	s.rules, err = conf.onRules()
+	if err != nil {
+		return nil, err
 	}
 
 	if conf.Color != "" {
-		s.red, s.grn, s.blu, _ = ParseHexColor(conf.Color)
+		s.base.red, s.base.grn, s.base.blu, _ = ParseHexColor(conf.Color)
 	}
+	s.look = s.base
+	s.restoreState()
 
 	if conf.MovementSensor != "" {
 		s.movement, err = movementsensor.FromDependencies(deps, conf.MovementSensor)
 		if err != nil {
 			return nil, err
 		}
-
-		bgCtx, cancel := context.WithCancel(context.Background())
-		s.cancel = cancel
-		s.wg.Add(1)
-		go s.scheduleLoop(bgCtx)
 	}
 
 	return s, nil
 }
 
-// setOn turns the sign on (scene on + configured color) or off. Caller need not
+// setOn turns the sign on (scene on + current color) or off. Caller need not
 // hold the lock; setOn manages it.
 func (s *NicolaudieStick3) setOn(on bool) error {
 	s.mu.Lock()
@@ -181,55 +439,206 @@ func (s *NicolaudieStick3) setOn(on bool) error {
 
 func (s *NicolaudieStick3) setOnLocked(on bool) error {
 	if on {
-		if err := s.client.SceneOn(s.page, s.scene); err != nil {
+		return s.showLocked(s.look)
+	}
+	if err := s.stopAnimationLocked(); err != nil {
+		return err
+	}
+	if err := s.client.SceneOff(s.look.page, s.look.scene); err != nil {
+		return err
+	}
+	s.on = false
+	s.asserted = true
+	return nil
+}
+
+// showLocked turns the sign on showing look, switching scenes if needed.
+// Any running animation is stopped first.
+func (s *NicolaudieStick3) showLocked(look stick3Look) error {
+	if err := s.stopAnimationLocked(); err != nil {
+		return err
+	}
+	if s.on && (look.page != s.look.page || look.scene != s.look.scene) {
+		if err := s.client.SceneOff(s.look.page, s.look.scene); err != nil {
 			return err
 		}
-		if err := s.client.SetColor(s.page, s.scene, s.red, s.grn, s.blu); err != nil {
+	}
+	if err := look.send(s.client); err != nil {
+		return err
+	}
+	s.look = look
+	s.on = true
+	s.asserted = true
+	return nil
+}
+
+// send turns look's scene on with client and applies its color, dimmer and
+// speed.
+func (look stick3Look) send(client *Stick3Client) error {
+	if err := client.SceneOn(look.page, look.scene); err != nil {
+		return err
+	}
+	if err := client.SetColor(look.page, look.scene, look.red, look.grn, look.blu); err != nil {
+		return err
+	}
+	if look.dimmer != nil {
+		if err := client.SetDimmerPercent(look.page, look.scene, *look.dimmer); err != nil {
 			return err
 		}
-	} else {
-		if err := s.client.SceneOff(s.page, s.scene); err != nil {
+	}
+	if look.speed != nil {
+		if err := client.SetSpeedPercent(look.page, look.scene, *look.speed); err != nil {
 			return err
 		}
 	}
-	s.on = on
 	return nil
 }
 
-// desiredOn reports whether the sign should be on right now, based on the sun
-// times at the given location: on from one hour before sunset until sunrise.
-func desiredOn(now time.Time, lat, lng float64) (bool, error) {
-	sunrise, sunset, err := SunTimes(now, lat, lng)
-	if err != nil {
-		if err == ErrSunAlwaysDown {
-			return true, nil // polar night: keep it on
+// setLevel remembers a "dimmer" or "speed" percent for look, sending it with
+// client if the scene is on.
+func (look *stick3Look) setLevel(client *Stick3Client, on bool, kind string, percent int) error {
+	if kind == "dimmer" {
+		look.dimmer = &percent
+		if on {
+			return client.SetDimmerPercent(look.page, look.scene, percent)
 		}
-		if err == ErrSunAlwaysUp {
-			return false, nil // polar day: keep it off
+		return nil
+	}
+	look.speed = &percent
+	if on {
+		return client.SetSpeedPercent(look.page, look.scene, percent)
+	}
+	return nil
+}
+
+// sceneCommand sends a pause, resume or reset for look's scene.
+func (look stick3Look) sceneCommand(client *Stick3Client, command string) error {
+	switch command {
+	case "pause":
+		return client.PauseScene(look.page, look.scene)
+	case "resume":
+		return client.ResumeScene(look.page, look.scene)
+	default:
+		return client.ResetScene(look.page, look.scene)
+	}
+}
+
+// addLevels adds look's dimmer and speed, if set, to a status result.
+func (look stick3Look) addLevels(res map[string]interface{}) {
+	if look.dimmer != nil {
+		res["dimmer"] = *look.dimmer
+	}
+	if look.speed != nil {
+		res["speed"] = *look.speed
+	}
+}
+
+// setSceneLocked switches the sign to another scene, keeping its color,
+// dimmer and speed; if it's on, the old scene is turned off and the new one
+// on.
+func (s *NicolaudieStick3) setSceneLocked(page, scene int) error {
+	look := s.look
+	look.page, look.scene = page, scene
+	if s.on {
+		return s.showLocked(look)
+	}
+	if err := s.stopAnimationLocked(); err != nil {
+		return err
+	}
+	s.look = look
+	return nil
+}
+
+// stick3SceneArgs reads the "page" (default A) and "scene" of a scene
+// command.
+func stick3SceneArgs(cmd map[string]interface{}) (page, scene int, err error) {
+	pageName := stick3DefaultPageAt
+	if v, ok := cmd["page"]; ok {
+		switch p := v.(type) {
+		case string:
+			pageName = p
+		case float64:
+			pageName = fmt.Sprint(int(p))
+		default:
+			return 0, 0, fmt.Errorf("\"page\" must be a letter or number")
 		}
-		return false, err
 	}
+	page, err = ParseStickPage(pageName)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, ok := cmd["scene"].(float64)
+	if !ok || n != math.Trunc(n) || n < 1 || n > 50 {
+		return 0, 0, fmt.Errorf("scene needs a \"scene\" of 1-50")
+	}
+	return page, int(n), nil
+}
 
-	onStart := sunset.Add(-stick3SunsetLeadIn)
+// entryLook is what a schedule entry shows, filling in from the config.
+func (s *NicolaudieStick3) entryLook(e *Stick3ScheduleEntry) stick3Look {
+	return s.base.with(e.Page, e.Scene, e.Color, e.Dimmer, e.Speed)
+}
 
-	// On before this morning's sunrise (tail of last night), or after this
-	// evening's lead-in to sunset.
-	return now.Before(sunrise) || !now.Before(onStart), nil
+// with is look with the set fields of a schedule entry or preset (already
+// validated) replacing its own. Dimmer and speed are replaced even when
+// unset, leaving the scene's own.
+func (look stick3Look) with(page string, scene int, color string, dimmer, speed *int) stick3Look {
+	if page != "" {
+		look.page, _ = ParseStickPage(page)
+	}
+	if scene != 0 {
+		look.scene = scene
+	}
+	if color != "" {
+		look.red, look.grn, look.blu, _ = ParseHexColor(color)
+	}
+	look.dimmer = dimmer
+	look.speed = speed
+	return look
+}
+
+// hasSchedule is whether anything turns the sign on and off by itself.
+func (s *NicolaudieStick3) hasSchedule() bool {
+	return s.movement != nil || len(s.conf.Schedule) > 0 || s.conf.hasOnRules()
+}
+
+// location is the timezone schedules are in; for "gps" the time zone at lat,
+// lng.
+func (s *NicolaudieStick3) location(lat, lng float64) *time.Location {
+	return zoneAt(s.conf.Timezone, s.loc, lat, lng)
 }
 
 func (s *NicolaudieStick3) evaluateSchedule(ctx context.Context) error {
-	point, _, err := s.movement.Position(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("reading position: %w", err)
+	var lat, lng float64
+	if s.movement != nil {
+		point, _, err := s.movement.Position(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("reading position: %w", err)
+		}
+		lat, lng = point.Lat(), point.Lng()
 	}
 
-	want, err := desiredOn(time.Now().UTC(), point.Lat(), point.Lng())
+	now := s.now()
+	if len(s.conf.Schedule) > 0 {
+		i := activeStick3Entry(s.conf.Schedule, s.conf.Holidays, now, s.location(lat, lng), lat, lng)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if held, err := s.checkOverrideLocked(now, scheduleKey(i)); held || err != nil {
+			return err
+		}
+		return s.applyScheduleEntryLocked(i)
+	}
+
+	want, err := desiredOn(now, s.rules, s.location(lat, lng), lat, lng)
 	if err != nil {
 		return err
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if held, err := s.checkOverrideLocked(now, onOff(want)); held || err != nil {
+		return err
+	}
 	if want == s.on {
 		return nil
 	}
@@ -237,6 +646,53 @@ func (s *NicolaudieStick3) evaluateSchedule(ctx context.Context) error {
 	return s.setOnLocked(want)
 }
 
+// checkOverrideLocked notes what the schedule wants, scheduled, and whether
+// an override is holding against it.
+func (s *NicolaudieStick3) checkOverrideLocked(now time.Time, scheduled string) (bool, error) {
+	s.scheduled = scheduled
+	return s.holdOverrideLocked(now, scheduled)
+}
+
+// scheduleKey names what a schedule wants: entry i, or "none".
+func scheduleKey(i int) string {
+	if i < 0 {
+		return "none"
+	}
+	return fmt.Sprintf("entry %d", i)
+}
+
+// applyScheduleEntryLocked shows schedule entry i, or turns the sign off if
+// i is -1 or the entry is an off one. Nothing is sent if that's already the
+// case.
+func (s *NicolaudieStick3) applyScheduleEntryLocked(i int) error {
+	var e *Stick3ScheduleEntry
+	if i >= 0 {
+		e = &s.conf.Schedule[i]
+	}
+	wantOn := e != nil && !e.Off
+	if i == s.active && wantOn == s.on {
+		return nil
+	}
+
+	if e != nil {
+		s.logger.Infof("nicolaudie-stick3 %s: schedule %s", s.conf.IP, e.displayName(i))
+	} else {
+		s.logger.Infof("nicolaudie-stick3 %s: no schedule entry, turning off", s.conf.IP)
+	}
+
+	var err error
+	if wantOn {
+		err = s.showLocked(s.entryLook(e))
+	} else if s.on {
+		err = s.setOnLocked(false)
+	}
+	if err != nil {
+		return err
+	}
+	s.active = i
+	return nil
+}
+
 func (s *NicolaudieStick3) scheduleLoop(ctx context.Context) {
 	defer s.wg.Done()
 
@@ -259,6 +715,97 @@ func (s *NicolaudieStick3) scheduleLoop(ctx context.Context) {
 	}
 }
 
+func (s *NicolaudieStick3) reassertLoop(ctx context.Context, interval time.Duration) {
+	defer s.wg.Done()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.reassert(); err != nil {
+				s.logger.Warnf("nicolaudie-stick3 %s: re-sending state failed: %v", s.conf.IP, err)
+			}
+		}
+	}
+}
+
+// reassert re-sends what the sign and zones should be showing, in case the
+// controller was power-cycled or changed from its own panel; with
+// StatusReadback, not if the controller says it's already showing it.
+// During a blackout only the blackout is re-sent.
+func (s *NicolaudieStick3) reassert() error {
+	status, err := StickStatus{}, ErrStickNoStatus
+	if s.conf.StatusReadback {
+		status, err = s.client.QueryStatus()
+		if err != nil && !errors.Is(err, ErrStickNoStatus) {
+			s.logger.Debugf("nicolaudie-stick3 %s: status query failed: %v", s.conf.IP, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.readback, s.readbackAt = &status, time.Now()
+	}
+	if s.blackout {
+		return s.setBlackoutLocked(true)
+	}
+	var found *StickStatus
+	if err == nil {
+		found = &status
+	}
+	if err := s.reassertSignLocked(found); err != nil {
+		return err
+	}
+	return s.reassertZonesLocked()
+}
+
+// reassertSignLocked re-sends the sign's state. Nothing is sent if the
+// controller's status reply already agrees, during an animation (which is
+// sending anyway), or before the component has turned it on or off at all.
+func (s *NicolaudieStick3) reassertSignLocked(status *StickStatus) error {
+	if !s.asserted || s.anim != nil {
+		return nil
+	}
+	if status != nil && s.agreesLocked(*status) {
+		return nil
+	}
+
+	if status != nil {
+		s.logger.Infof("nicolaudie-stick3 %s: controller reports scene %d %s, re-sending %s",
+			s.conf.IP, status.Scene, onOff(status.On()), onOff(s.on))
+	}
+	if s.on {
+		return s.showLocked(s.look)
+	}
+	return s.client.SceneOff(s.look.page, s.look.scene)
+}
+
+// agreesLocked is whether a status reply matches what the sign should show.
+func (s *NicolaudieStick3) agreesLocked(status StickStatus) bool {
+	page, scene := status.PageScene()
+	if page != s.look.page || scene != s.look.scene || status.On() != s.on {
+		return false
+	}
+	return !s.on || (status.Red == s.look.red && status.Green == s.look.grn && status.Blue == s.look.blu)
+}
+
+// addStick3Readback adds a status reply to DoCommand results.
+func addStick3Readback(res map[string]interface{}, status StickStatus, at time.Time) {
+	page, scene := status.PageScene()
+	res["controller_address"] = status.Address
+	res["controller_on"] = status.On()
+	res["controller_page"] = page
+	res["controller_scene"] = scene
+	res["controller_color"] = status.Color()
+	res["controller_dimmer"] = int(math.Round(float64(status.Dimmer) * 100 / 127))
+	res["controller_seen"] = at.Format(time.RFC3339)
+}
+
 func onOff(on bool) string {
 	if on {
 		return "on"
@@ -271,6 +818,13 @@ func (s *NicolaudieStick3) Name() resource.Name {
 }
 
 func (s *NicolaudieStick3) Close(ctx context.Context) error {
+	s.mu.Lock()
+	err := s.stopAnimationLocked()
+	s.mu.Unlock()
+	if err != nil {
+		s.logger.Warnf("nicolaudie-stick3 %s: stopping animation: %v", s.conf.IP, err)
+	}
+
 	if s.cancel != nil {
 		s.cancel()
 	}
@@ -280,25 +834,81 @@ func (s *NicolaudieStick3) Close(ctx context.Context) error {
 
 // DoCommand supports manual control and testing:
 //
-//	{"command": "on"}                          turn the sign on
-//	{"command": "off"}                         turn the sign off
+//	{"command": "on"}                          turn the sign on until the schedule next changes
+//	{"command": "off"}                         turn the sign off, likewise
+//	{"command": "off", "until": "07:00"}       ...until a time ("HH:MM" or RFC 3339), or
+//	                                           "indefinite"; also for "preset"
+//	{"command": "clear_override"}              go back to the schedule now
 //	{"command": "set_color", "color": "FF0000"} change color (applied if on)
-//	{"command": "status"}                      report current state
+//	{"command": "dimmer", "dimmer": 60}        set the dimmer percent, kept for "on"
+//	{"command": "speed", "speed": 40}          set the scene speed percent, kept for "on"
+//	{"command": "pause"}                       pause the scene's program
+//	{"command": "resume"}                      resume it
+//	{"command": "reset"}                       restart it from the beginning
+//	{"command": "scene", "page": "B", "scene": 3}
+//	                                           switch scenes, keeping color, dimmer and speed
+//	{"command": "on", "zone": "underwater"}    all of the above take a zone
+//	{"command": "preset", "preset": "party"}   show a preset (or "on" or "off")
+//	{"command": "blackout"}                    darken the sign and every zone
+//	{"command": "unblackout"}                  undo blackout
+//	{"command": "animate", "animation": "fade", "color": "FF0000", "seconds": 5}
+//	                                           fade to a color, which then stays
+//	{"command": "animate", "animation": "crossfade", "color": "FF0000", "color2": "0000FF", "seconds": 4}
+//	                                           fade back and forth between two colors
+//	{"command": "animate", "animation": "rainbow", "seconds": 30}
+//	                                           cycle through the hues
+//	{"command": "animate", "animation": "breathe", "seconds": 4, "min_dimmer": 10}
+//	                                           pulse the dimmer, keeping the color
+//	{"command": "stop_animation"}              stop, settling on a steady frame
+//	{"command": "read_status"}                 ask the controller what it's showing
+//	                                           (with status_readback)
+//	{"command": "status"}                      report current state, and the
+//	                                           controller's last status reply
 func (s *NicolaudieStick3) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
 	command, _ := cmd["command"].(string)
 
 	switch command {
-	case "on":
-		if err := s.setOn(true); err != nil {
+	case "on", "off":
+		loc, err := s.untilLocation(ctx, cmd)
+		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"on": true}, nil
-
-	case "off":
-		if err := s.setOn(false); err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		z, err := s.zoneLocked(cmd)
+		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"on": false}, nil
+		if z != nil {
+			if err := z.setOn(command == "on"); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"zone": z.name, "on": z.on}, nil
+		}
+		until, at, err := parseStick3Until(cmd, s.now(), loc)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.setOnLocked(command == "on"); err != nil {
+			return nil, err
+		}
+		s.overrideLocked(command == "on", "", until, at)
+		res := map[string]interface{}{"on": command == "on"}
+		s.addOverrideLocked(res)
+		return res, nil
+
+	case "clear_override":
+		s.mu.Lock()
+		s.clearOverrideLocked()
+		s.mu.Unlock()
+		if s.hasSchedule() {
+			if err := s.evaluateSchedule(ctx); err != nil {
+				return nil, err
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return map[string]interface{}{"on": s.on}, nil
 
 	case "set_color":
 		hex, ok := cmd["color"].(string)
@@ -310,25 +920,203 @@ func (s *NicolaudieStick3) DoCommand(ctx context.Context, cmd map[string]interfa
 			return nil, err
 		}
 		s.mu.Lock()
-		s.red, s.grn, s.blu = red, grn, blu
-		on := s.on
-		var applyErr error
-		if on {
-			applyErr = s.client.SetColor(s.page, s.scene, red, grn, blu)
+		defer s.mu.Unlock()
+		z, err := s.zoneLocked(cmd)
+		if err != nil {
+			return nil, err
 		}
-		s.mu.Unlock()
-		if applyErr != nil {
-			return nil, applyErr
+		if z != nil {
+			if err := z.setColor(red, grn, blu); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"zone": z.name, "color": hex}, nil
+		}
+		if err := s.stopAnimationLocked(); err != nil {
+			return nil, err
+		}
+		s.look.red, s.look.grn, s.look.blu = red, grn, blu
+		s.saveStateLocked()
+		if s.on {
+			if err := s.client.SetColor(s.look.page, s.look.scene, red, grn, blu); err != nil {
+				return nil, err
+			}
 		}
 		return map[string]interface{}{"color": hex}, nil
 
+	case "dimmer", "speed":
+		v, ok := cmd[command].(float64)
+		if !ok || v < 0 || v > 100 {
+			return nil, fmt.Errorf("%s needs a %q percent of 0-100", command, command)
+		}
+		percent := int(math.Round(v))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		z, err := s.zoneLocked(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if z != nil {
+			if err := z.look.setLevel(z.client, z.on, command, percent); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"zone": z.name, command: percent}, nil
+		}
+		if command == "dimmer" {
+			// A breathe animation would fight it.
+			if err := s.stopAnimationLocked(); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.look.setLevel(s.client, s.on, command, percent); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{command: percent}, nil
+
+	case "pause", "resume", "reset":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		z, err := s.zoneLocked(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if z != nil {
+			if err := z.look.sceneCommand(z.client, command); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"zone": z.name, "page": z.look.page, "scene": z.look.scene}, nil
+		}
+		if err := s.look.sceneCommand(s.client, command); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"page": s.look.page, "scene": s.look.scene}, nil
+
+	case "scene":
+		page, scene, err := stick3SceneArgs(cmd)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		z, err := s.zoneLocked(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if z != nil {
+			if err := z.setScene(page, scene); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"zone": z.name, "page": page, "scene": scene}, nil
+		}
+		if err := s.setSceneLocked(page, scene); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"page": page, "scene": scene}, nil
+
+	case "preset":
+		name, ok := cmd["preset"].(string)
+		if !ok {
+			return nil, fmt.Errorf("preset needs a string \"preset\"")
+		}
+		pos, err := s.positionByName(name)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := s.untilLocation(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		until, at, err := parseStick3Until(cmd, s.now(), loc)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.setPositionLocked(pos, until, at); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"preset": name}, nil
+
+	case "blackout", "unblackout":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.setBlackoutLocked(command == "blackout"); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"blackout": s.blackout}, nil
+
+	case "animate":
+		kind, _ := cmd["animation"].(string)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		a, err := newStick3Animation(kind, [3]byte{s.look.red, s.look.grn, s.look.blu}, cmd)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.startAnimationLocked(a); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"animation": kind}, nil
+
+	case "stop_animation":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.stopAnimationLocked(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"color": fmt.Sprintf("%02X%02X%02X", s.look.red, s.look.grn, s.look.blu)}, nil
+
 	case "status":
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		return map[string]interface{}{
+		res := map[string]interface{}{
 			"on":    s.on,
-			"color": fmt.Sprintf("%02X%02X%02X", s.red, s.grn, s.blu),
-		}, nil
+			"color": fmt.Sprintf("%02X%02X%02X", s.look.red, s.look.grn, s.look.blu),
+			"page":  s.look.page,
+			"scene": s.look.scene,
+		}
+		s.look.addLevels(res)
+		if len(s.conf.Presets) > 0 {
+			res["preset"] = s.positionNames()[s.positionLocked()]
+		}
+		if s.anim != nil {
+			res["animation"] = s.anim.kind
+		}
+		if s.active >= 0 {
+			res["schedule_entry"] = s.conf.Schedule[s.active].displayName(s.active)
+		}
+		s.addOverrideLocked(res)
+		if s.readback != nil {
+			addStick3Readback(res, *s.readback, s.readbackAt)
+		}
+		if len(s.zones) > 0 {
+			zones := map[string]interface{}{}
+			for name, z := range s.zones {
+				zones[name] = z.status()
+			}
+			res["zones"] = zones
+		}
+		res["blackout"] = s.blackout
+		if at, err := s.client.LastSendError(); err != nil {
+			res["last_send_error"] = err.Error()
+			res["last_send_error_at"] = at.Format(time.RFC3339)
+		}
+		return res, nil
+
+	case "read_status":
+		if !s.conf.StatusReadback {
+			return nil, fmt.Errorf("read_status needs status_readback in the config")
+		}
+		status, err := s.client.QueryStatus()
+		if err != nil {
+			return nil, err
+		}
+		at := time.Now()
+		s.mu.Lock()
+		s.readback, s.readbackAt = &status, at
+		s.mu.Unlock()
+		res := map[string]interface{}{}
+		addStick3Readback(res, status, at)
+		return res, nil
 
 	default:
 		return nil, fmt.Errorf("unknown command %q", command)
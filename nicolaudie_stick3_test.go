@@ -0,0 +1,99 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestStick3Commands(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFakeStick3(t)
+
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Color: "FFFFFF", ReassertSeconds: -1,
+		Zones: []Stick3Zone{{Name: "cockpit", Scene: 2, ZoneSyncID: 3}},
+	}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	res, err := newNicolaudieStick3(ctx, nil, resource.Config{
+		Name:                "sign",
+		API:                 generic.API,
+		ConvertedAttributes: conf,
+	}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer res.Close(ctx)
+
+	do := func(cmd map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		resp, err := res.DoCommand(ctx, cmd)
+		test.That(t, err, test.ShouldBeNil)
+		return resp
+	}
+
+	// Dimmer and speed are sent straight away while on...
+	do(map[string]interface{}{"command": "on"})
+	quietTriggers(t, f, 0)
+	n := len(f.Triggers())
+	do(map[string]interface{}{"command": "dimmer", "dimmer": 60.0})
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{1, 0, StickDimmerSet, 76}})
+
+	// ...remembered while off, and re-applied on "on".
+	do(map[string]interface{}{"command": "off"})
+	quietTriggers(t, f, 0)
+	n = len(f.Triggers())
+	do(map[string]interface{}{"command": "speed", "speed": 40.0})
+	test.That(t, triggersSince(t, f, n), test.ShouldBeEmpty)
+	do(map[string]interface{}{"command": "on"})
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{
+		{1, 0, StickSceneOn, 0}, {1, 0, StickColorSet, 0}, {1, 0, StickDimmerSet, 76}, {1, 0, StickSpeedSet, 51},
+	})
+
+	status := do(map[string]interface{}{"command": "status"})
+	test.That(t, status["dimmer"], test.ShouldEqual, 60)
+	test.That(t, status["speed"], test.ShouldEqual, 40)
+
+	n = len(f.Triggers())
+	do(map[string]interface{}{"command": "pause"})
+	do(map[string]interface{}{"command": "resume"})
+	do(map[string]interface{}{"command": "reset"})
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{
+		{1, 0, StickPauseOn, 0}, {1, 0, StickPauseOff, 0}, {1, 0, StickSceneReset, 0},
+	})
+
+	// Switching scenes turns the old one off and keeps the look.
+	n = len(f.Triggers())
+	resp := do(map[string]interface{}{"command": "scene", "page": "B", "scene": 3.0})
+	test.That(t, resp["scene"], test.ShouldEqual, 3)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{
+		{1, 0, StickSceneOff, 0},
+		{53, 0, StickSceneOn, 0}, {53, 0, StickColorSet, 0}, {53, 0, StickDimmerSet, 76}, {53, 0, StickSpeedSet, 51},
+	})
+
+	// The same verbs work on zones.
+	n = len(f.Triggers())
+	do(map[string]interface{}{"command": "dimmer", "dimmer": 100.0, "zone": "cockpit"})
+	do(map[string]interface{}{"command": "on", "zone": "cockpit"})
+	do(map[string]interface{}{"command": "pause", "zone": "cockpit"})
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{
+		{2, 3, StickSceneOn, 0}, {2, 3, StickColorSet, 0}, {2, 3, StickDimmerSet, 127}, {2, 3, StickPauseOn, 0},
+	})
+	status = do(map[string]interface{}{"command": "status"})
+	test.That(t, status["zones"].(map[string]interface{})["cockpit"].(map[string]interface{})["dimmer"], test.ShouldEqual, 100)
+
+	for _, bad := range []map[string]interface{}{
+		{"command": "dimmer", "dimmer": 120.0},
+		{"command": "speed"},
+		{"command": "scene", "scene": 0.0},
+		{"command": "scene", "page": "?", "scene": 1.0},
+		{"command": "reset", "zone": "bilge"},
+	} {
+		_, err := res.DoCommand(ctx, bad)
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
@@ -0,0 +1,199 @@
+package verhboat
+
+// Where a Stick3Client sends: an IPv4 or IPv6 literal, a hostname such as
+// the one the controller registers with DHCP, or "broadcast" for a
+// controller whose address isn't known. Hostnames are looked up when first
+// sent to and the answer kept for stickResolveTTL; a failed send forgets it
+// so the next one looks again, and if a lookup fails the last answer is used
+// until one succeeds.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StickBroadcastHost, as a controller address, sends to
+	// StickBroadcastAddress so any controller on the LAN acts on it.
+	StickBroadcastHost = "broadcast"
+
+	stickResolveTTL = 5 * time.Minute
+)
+
+// ValidateStickHost checks a controller address: an IP address, a hostname,
+// or StickBroadcastHost. It doesn't look hostnames up.
+func ValidateStickHost(host string) error {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return errors.New("controller address cannot be empty")
+	}
+	if strings.EqualFold(host, StickBroadcastHost) {
+		return nil
+	}
+	if _, ok := parseStickIP(host); ok {
+		return nil
+	}
+	if strings.ContainsAny(host, "[]:%") {
+		return fmt.Errorf("invalid controller IP address %q", host)
+	}
+	if !validHostname(host) {
+		return fmt.Errorf("invalid controller address %q; use an IP address, a hostname or %q", host, StickBroadcastHost)
+	}
+	return nil
+}
+
+// parseStickIP parses an IP literal, allowing IPv6 in brackets and with a
+// zone such as "fe80::1%eth0".
+func parseStickIP(host string) (netip.Addr, bool) {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// validHostname checks host against RFC 1123: dot-separated labels of
+// letters, digits and inner hyphens, up to 63 characters each.
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stickAddress resolves a controller address. It's shared by a client and
+// the clients WithZone makes from it, so they share the cached lookup.
+type stickAddress struct {
+	host    string
+	port    int
+	timeout time.Duration
+	literal bool // an IP or broadcast, never looked up
+
+	// lookup is net.DefaultResolver.LookupIPAddr, replaced in tests.
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu         sync.Mutex
+	resolved   *net.UDPAddr
+	resolvedAt time.Time // zero once forgotten
+}
+
+func newStickAddress(host string, port int, timeout time.Duration) (*stickAddress, error) {
+	if err := ValidateStickHost(host); err != nil {
+		return nil, err
+	}
+	host = strings.TrimSpace(host)
+	a := &stickAddress{
+		host:    host,
+		port:    port,
+		timeout: timeout,
+		lookup:  net.DefaultResolver.LookupIPAddr,
+	}
+	if strings.EqualFold(host, StickBroadcastHost) {
+		a.resolved, a.literal = &net.UDPAddr{IP: net.ParseIP(StickBroadcastAddress), Port: port}, true
+	} else if ip, ok := parseStickIP(host); ok {
+		a.resolved, a.literal = net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), true
+	}
+	return a, nil
+}
+
+func (a *stickAddress) String() string {
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(a.host, "["), "]"), strconv.Itoa(a.port))
+}
+
+// resolve returns where to send, looking the hostname up if the last answer
+// is missing or older than stickResolveTTL.
+func (a *stickAddress) resolve() (*net.UDPAddr, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.literal {
+		return a.resolved, nil
+	}
+	if a.resolved != nil && !a.resolvedAt.IsZero() && time.Since(a.resolvedAt) < stickResolveTTL {
+		return a.resolved, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	addrs, err := a.lookup(ctx, a.host)
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no addresses")
+	}
+	if err != nil {
+		if a.resolved != nil {
+			// Keep using the last answer until the name resolves again.
+			return a.resolved, nil
+		}
+		return nil, fmt.Errorf("resolve %s: %w", a.host, err)
+	}
+
+	// The STICK-DE3 is IPv4 on most networks, so prefer that.
+	best := addrs[0]
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			best = addr
+			break
+		}
+	}
+	a.resolved = &net.UDPAddr{IP: best.IP, Port: a.port, Zone: best.Zone}
+	a.resolvedAt = time.Now()
+	return a.resolved, nil
+}
+
+// forget makes the next resolve look the hostname up again, after a send to
+// it failed.
+func (a *stickAddress) forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.resolvedAt = time.Time{}
+}
+
+// stickIsBroadcast is whether dest is a broadcast address, either
+// StickBroadcastAddress or that of one of this machine's networks, so
+// replies to it can come from anywhere.
+func stickIsBroadcast(dest *net.UDPAddr) bool {
+	ip4 := dest.IP.To4()
+	if ip4 == nil {
+		return dest.IP.IsMulticast()
+	}
+	if ip4.Equal(net.IPv4bcast) {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil || len(ipNet.Mask) != net.IPv4len {
+			continue
+		}
+		bcast := make(net.IP, net.IPv4len)
+		for i := range bcast {
+			bcast[i] = ipNet.IP.To4()[i] | ^ipNet.Mask[i]
+		}
+		if bcast.Equal(ip4) && !ipNet.IP.To4().Equal(ip4) {
+			return true
+		}
+	}
+	return false
+}
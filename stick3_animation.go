@@ -0,0 +1,236 @@
+package verhboat
+
+// Animations for the nicolaudie-stick3 sign, driven from Go: a goroutine
+// streams quick-trigger color or dimmer updates at the configured frame rate.
+//
+// Stopping an animation, for whatever reason (DoCommand, a new color, the
+// schedule, Close), always settles the sign on a resting frame: the fade's
+// target color, or the color and dimmer from before the animation started.
+// Frames are sent with the component's lock held and only while the
+// animation is still current, so no frame can land after the settle.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	stick3DefaultFPS      = 10.0
+	stick3MaxFPS          = 40.0
+	stick3DefaultAnimSecs = 5.0
+	stick3DefaultMinDim   = 10
+)
+
+type stick3Animation struct {
+	kind      string // fade, crossfade, rainbow, breathe
+	from, to  [3]byte
+	period    time.Duration
+	minDimmer int
+}
+
+func newStick3Animation(kind string, from [3]byte, cmd map[string]interface{}) (*stick3Animation, error) {
+	a := &stick3Animation{kind: kind, from: from, period: time.Duration(stick3DefaultAnimSecs * float64(time.Second)), minDimmer: stick3DefaultMinDim}
+
+	if secs, ok := cmd["seconds"].(float64); ok {
+		if secs <= 0 {
+			return nil, fmt.Errorf("seconds must be positive")
+		}
+		a.period = time.Duration(secs * float64(time.Second))
+	}
+
+	parseColor := func(key string) ([3]byte, error) {
+		hex, ok := cmd[key].(string)
+		if !ok {
+			return [3]byte{}, fmt.Errorf("%s needs a string %q", kind, key)
+		}
+		r, g, b, err := ParseHexColor(hex)
+		return [3]byte{r, g, b}, err
+	}
+
+	var err error
+	switch kind {
+	case "fade":
+		a.to, err = parseColor("color")
+	case "crossfade":
+		if a.from, err = parseColor("color"); err == nil {
+			a.to, err = parseColor("color2")
+		}
+	case "rainbow":
+	case "breathe":
+		if m, ok := cmd["min_dimmer"].(float64); ok {
+			if m < 0 || m > 100 {
+				return nil, fmt.Errorf("min_dimmer must be between 0 and 100")
+			}
+			a.minDimmer = int(m)
+		}
+	default:
+		return nil, fmt.Errorf("unknown animation %q; use fade, crossfade, rainbow or breathe", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// changesDimmer reports whether the animation drives the dimmer rather than
+// the color.
+func (a *stick3Animation) changesDimmer() bool {
+	return a.kind == "breathe"
+}
+
+// frame returns the color (or, for breathe, the dimmer percent) t into the
+// animation, and whether a one-shot animation has finished.
+func (a *stick3Animation) frame(t time.Duration) (color [3]byte, dimmer int, done bool) {
+	f := t.Seconds() / a.period.Seconds()
+	// 0 -> 1 -> 0 over each period.
+	wave := (1 - math.Cos(2*math.Pi*f)) / 2
+
+	switch a.kind {
+	case "fade":
+		if f >= 1 {
+			return a.to, 0, true
+		}
+		return lerpColor(a.from, a.to, f), 0, false
+	case "crossfade":
+		return lerpColor(a.from, a.to, wave), 0, false
+	case "rainbow":
+		return hueColor(360 * (f - math.Floor(f))), 0, false
+	case "breathe":
+		return a.from, int(math.Round(100 - float64(100-a.minDimmer)*wave)), false
+	}
+	return a.from, 0, true
+}
+
+func lerpColor(a, b [3]byte, f float64) [3]byte {
+	var c [3]byte
+	for i := range c {
+		c[i] = byte(math.Round(float64(a[i]) + (float64(b[i])-float64(a[i]))*f))
+	}
+	return c
+}
+
+// hueColor returns the fully saturated, full brightness color of a hue (degrees).
+func hueColor(hue float64) [3]byte {
+	x := 1 - math.Abs(math.Mod(hue/60, 2)-1)
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g = 1, x
+	case hue < 120:
+		r, g = x, 1
+	case hue < 180:
+		g, b = 1, x
+	case hue < 240:
+		g, b = x, 1
+	case hue < 300:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	return [3]byte{byte(math.Round(r * 255)), byte(math.Round(g * 255)), byte(math.Round(b * 255))}
+}
+
+// startAnimationLocked stops any running animation, turns the sign on if
+// needed, and starts a.
+func (s *NicolaudieStick3) startAnimationLocked(a *stick3Animation) error {
+	if err := s.stopAnimationLocked(); err != nil {
+		return err
+	}
+	if !s.on {
+		if err := s.showLocked(s.look); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.anim = a
+	s.animCancel = cancel
+	s.wg.Add(1)
+	go s.animate(ctx, a)
+	return nil
+}
+
+// stopAnimationLocked stops the running animation, if any, and settles the
+// sign on its resting frame.
+func (s *NicolaudieStick3) stopAnimationLocked() error {
+	a := s.anim
+	if a == nil {
+		return nil
+	}
+	s.animCancel()
+	s.anim = nil
+	s.animCancel = nil
+
+	if a.kind == "fade" {
+		s.look.red, s.look.grn, s.look.blu = a.to[0], a.to[1], a.to[2]
+	}
+	if !s.on {
+		return nil
+	}
+	return s.sendRestingLocked(a)
+}
+
+func (s *NicolaudieStick3) sendRestingLocked(a *stick3Animation) error {
+	if a.changesDimmer() {
+		dimmer := 100
+		if s.look.dimmer != nil {
+			dimmer = *s.look.dimmer
+		}
+		return s.client.SetDimmerPercent(s.look.page, s.look.scene, dimmer)
+	}
+	return s.client.SetColor(s.look.page, s.look.scene, s.look.red, s.look.grn, s.look.blu)
+}
+
+func (s *NicolaudieStick3) animate(ctx context.Context, a *stick3Animation) {
+	defer s.wg.Done()
+
+	t := time.NewTicker(time.Duration(float64(time.Second) / s.conf.fps()))
+	defer t.Stop()
+
+	// Frames don't wait to be sent, and one still queued when the next is
+	// ready is replaced by it.
+	stream := s.client.Coalescing()
+
+	start := time.Now()
+	var last [3]byte
+	lastDimmer := -1
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		color, dimmer, done := a.frame(time.Since(start))
+
+		s.mu.Lock()
+		if ctx.Err() != nil || s.anim != a {
+			s.mu.Unlock()
+			return
+		}
+		var err error
+		switch {
+		case a.changesDimmer() && dimmer != lastDimmer:
+			err = stream.SetDimmerPercent(s.look.page, s.look.scene, dimmer)
+			lastDimmer = dimmer
+		case !a.changesDimmer() && color != last:
+			err = stream.SetColor(s.look.page, s.look.scene, color[0], color[1], color[2])
+			last = color
+		}
+		if done {
+			s.look.red, s.look.grn, s.look.blu = a.to[0], a.to[1], a.to[2]
+			s.anim = nil
+			s.animCancel = nil
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			s.logger.Debugf("nicolaudie-stick3 %s: animation frame failed: %v", s.conf.IP, err)
+		}
+		if done {
+			return
+		}
+	}
+}
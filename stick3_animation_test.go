@@ -0,0 +1,161 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+// newTestFakeStick3 starts a fake controller that's closed when the test
+// ends.
+func newTestFakeStick3(t *testing.T) *FakeStick3 {
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// quietTriggers waits until the fake has stopped receiving quick triggers and
+// returns those after the first n.
+func quietTriggers(t *testing.T, f *FakeStick3, n int) []StickQuickTrigger {
+	last := -1
+	for i := 0; i < 100; i++ {
+		time.Sleep(50 * time.Millisecond)
+		triggers := f.Triggers()
+		if len(triggers) == last {
+			return triggers[n:]
+		}
+		last = len(triggers)
+	}
+	t.Fatal("stick triggers never stopped")
+	return nil
+}
+
+// stickTrigger is the interesting part of a quick trigger; level is the
+// dimmer or speed.
+type stickTrigger struct {
+	scene   uint16
+	zone    byte
+	command StickCommand
+	level   uint16
+}
+
+// triggersSince returns the quick triggers after the first n, once they've
+// all arrived.
+func triggersSince(t *testing.T, f *FakeStick3, n int) []stickTrigger {
+	var res []stickTrigger
+	for _, trigger := range quietTriggers(t, f, n) {
+		tr := stickTrigger{scene: trigger.Scene, zone: trigger.ZoneSyncID, command: trigger.Command}
+		switch tr.command {
+		case StickDimmerSet:
+			tr.level = trigger.Dimmer
+		case StickSpeedSet:
+			tr.level = trigger.Speed
+		}
+		res = append(res, tr)
+	}
+	return res
+}
+
+func TestStick3AnimationFrames(t *testing.T) {
+	red, blue := [3]byte{255, 0, 0}, [3]byte{0, 0, 255}
+
+	fade := &stick3Animation{kind: "fade", from: red, to: blue, period: 2 * time.Second}
+	c, _, done := fade.frame(0)
+	test.That(t, c, test.ShouldResemble, red)
+	test.That(t, done, test.ShouldBeFalse)
+	c, _, _ = fade.frame(time.Second)
+	test.That(t, c, test.ShouldResemble, [3]byte{128, 0, 128})
+	c, _, done = fade.frame(3 * time.Second)
+	test.That(t, c, test.ShouldResemble, blue)
+	test.That(t, done, test.ShouldBeTrue)
+
+	cross := &stick3Animation{kind: "crossfade", from: red, to: blue, period: 2 * time.Second}
+	c, _, done = cross.frame(time.Second)
+	test.That(t, c, test.ShouldResemble, blue)
+	test.That(t, done, test.ShouldBeFalse)
+	c, _, _ = cross.frame(2 * time.Second)
+	test.That(t, c, test.ShouldResemble, red)
+
+	rainbow := &stick3Animation{kind: "rainbow", period: 6 * time.Second}
+	c, _, _ = rainbow.frame(0)
+	test.That(t, c, test.ShouldResemble, red)
+	c, _, _ = rainbow.frame(2 * time.Second)
+	test.That(t, c, test.ShouldResemble, [3]byte{0, 255, 0})
+	c, _, _ = rainbow.frame(10 * time.Second)
+	test.That(t, c, test.ShouldResemble, blue)
+
+	breathe := &stick3Animation{kind: "breathe", from: red, period: 4 * time.Second, minDimmer: 20}
+	c, d, _ := breathe.frame(0)
+	test.That(t, c, test.ShouldResemble, red)
+	test.That(t, d, test.ShouldEqual, 100)
+	_, d, _ = breathe.frame(2 * time.Second)
+	test.That(t, d, test.ShouldEqual, 20)
+
+	_, err := newStick3Animation("strobe", red, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = newStick3Animation("crossfade", red, map[string]interface{}{"color": "00FF00"})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = newStick3Animation("fade", red, map[string]interface{}{"color": "00FF00", "seconds": -1.0})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStick3AnimationStops(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFakeStick3(t)
+
+	conf := &NicolaudieStick3Config{IP: f.Host(), Port: f.Port(), Color: "FF0000", AnimationFPS: 40}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	res, err := newNicolaudieStick3(ctx, nil, resource.Config{
+		Name:                "sign",
+		API:                 generic.API,
+		ConvertedAttributes: conf,
+	}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	s := res.(*NicolaudieStick3)
+
+	// Animating turns the sign on, then streams frames.
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "animate", "animation": "rainbow", "seconds": 1.0})
+	test.That(t, err, test.ShouldBeNil)
+	time.Sleep(300 * time.Millisecond)
+	test.That(t, len(f.Triggers()), test.ShouldBeGreaterThan, 5)
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["on"], test.ShouldBeTrue)
+	test.That(t, status["animation"], test.ShouldEqual, "rainbow")
+
+	// Stopping settles back on the configured color.
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "stop_animation"})
+	test.That(t, err, test.ShouldBeNil)
+	triggers := quietTriggers(t, f, 0)
+	last := triggers[len(triggers)-1]
+	test.That(t, last.Command, test.ShouldEqual, StickColorSet)
+	test.That(t, f.Scene(0, 1).Color(), test.ShouldEqual, "FF0000")
+
+	// A fade keeps its target once finished.
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "animate", "animation": "fade", "color": "0000FF", "seconds": 0.2})
+	test.That(t, err, test.ShouldBeNil)
+	quietTriggers(t, f, 0)
+	test.That(t, f.Scene(0, 1).Color(), test.ShouldEqual, "0000FF")
+	status, err = s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["color"], test.ShouldEqual, "0000FF")
+	test.That(t, status["animation"], test.ShouldBeNil)
+
+	// Close mid-breath restores full brightness.
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "animate", "animation": "breathe", "seconds": 0.5})
+	test.That(t, err, test.ShouldBeNil)
+	time.Sleep(300 * time.Millisecond)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+	triggers = quietTriggers(t, f, 0)
+	last = triggers[len(triggers)-1]
+	test.That(t, last.Command, test.ShouldEqual, StickDimmerSet)
+	test.That(t, f.Scene(0, 1).Dimmer, test.ShouldEqual, 127) // 100%
+}
@@ -0,0 +1,292 @@
+package verhboat
+
+// In-process fake of a STICK-DE3, used by the tests and by cmd/yachtsign so
+// the quick-trigger protocol and the component can be exercised without a
+// controller.
+//
+// It listens for quick triggers on UDP, decodes them and keeps the state a
+// controller would: which scenes are on or paused, their color, dimmer and
+// speed, and the master blackout. It answers status queries for the scene
+// last switched on or off, unless told to behave like firmware that doesn't.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeStick3Scene is what the fake knows about one scene. Dimmer and speed
+// are the raw STICK values, 127 being 100%.
+type FakeStick3Scene struct {
+	On         bool
+	Paused     bool
+	Resets     int
+	Red        byte
+	Green      byte
+	Blue       byte
+	Dimmer     uint16
+	Speed      uint16
+	ZoneSyncID byte // from the last trigger for the scene
+}
+
+// Color is the scene's color as RRGGBB hex.
+func (s FakeStick3Scene) Color() string {
+	return fmt.Sprintf("%02X%02X%02X", s.Red, s.Green, s.Blue)
+}
+
+// FakeStick3 is a fake STICK-DE3 listening on a local UDP port.
+type FakeStick3 struct {
+	conn *net.UDPConn
+
+	mu            sync.Mutex
+	scenes        map[uint16]*FakeStick3Scene
+	current       uint16 // the scene last switched on or off, for status
+	blackout      bool
+	triggers      []StickQuickTrigger
+	statusReplies bool
+	onTrigger     func(StickQuickTrigger)
+
+	wg sync.WaitGroup
+}
+
+// NewFakeStick3 starts a fake controller listening on addr (e.g.
+// "127.0.0.1:0" for a random port).
+func NewFakeStick3(addr string) (*FakeStick3, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	f := &FakeStick3{
+		conn:          conn,
+		scenes:        map[uint16]*FakeStick3Scene{},
+		statusReplies: true,
+	}
+
+	f.wg.Add(1)
+	go f.readLoop()
+
+	return f, nil
+}
+
+// Addr returns the host:port the fake is listening on.
+func (f *FakeStick3) Addr() string {
+	return f.conn.LocalAddr().String()
+}
+
+// Host returns the host the fake is listening on.
+func (f *FakeStick3) Host() string {
+	host, _, _ := net.SplitHostPort(f.Addr())
+	return host
+}
+
+// Port returns the UDP port the fake is listening on.
+func (f *FakeStick3) Port() int {
+	return f.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Scene returns the state of a scene, by zero-based page and one-based
+// scene. Scenes that haven't been sent anything are off and black.
+func (f *FakeStick3) Scene(page, scene int) FakeStick3Scene {
+	absolute, err := StickAbsoluteScene(page, scene)
+	if err != nil {
+		return FakeStick3Scene{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.scenes[absolute]; ok {
+		return *s
+	}
+	return FakeStick3Scene{}
+}
+
+// Scenes returns every scene that's been sent a trigger, by absolute scene
+// number.
+func (f *FakeStick3) Scenes() map[uint16]FakeStick3Scene {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := map[uint16]FakeStick3Scene{}
+	for n, s := range f.scenes {
+		res[n] = *s
+	}
+	return res
+}
+
+// OnScenes returns the absolute numbers of the scenes that are on, in order.
+func (f *FakeStick3) OnScenes() []uint16 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []uint16
+	for n, s := range f.scenes {
+		if s.On {
+			res = append(res, n)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// Blackout reports whether the master blackout is on.
+func (f *FakeStick3) Blackout() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blackout
+}
+
+// Triggers returns every quick trigger the fake has received, in order.
+func (f *FakeStick3) Triggers() []StickQuickTrigger {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]StickQuickTrigger(nil), f.triggers...)
+}
+
+// WaitForTriggers waits up to timeout for the fake to have received at least
+// n quick triggers. UDP is asynchronous, so tests call this before looking
+// at the state.
+func (f *FakeStick3) WaitForTriggers(n int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		f.mu.Lock()
+		got := len(f.triggers)
+		f.mu.Unlock()
+		if got >= n {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("got %d quick triggers, wanted %d", got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// SetStatusReplies sets whether the fake answers status queries; firmware
+// without readback doesn't.
+func (f *FakeStick3) SetStatusReplies(reply bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statusReplies = reply
+}
+
+// SetOnTrigger sets a function called with each quick trigger after it's
+// been applied, e.g. to print them.
+func (f *FakeStick3) SetOnTrigger(fn func(StickQuickTrigger)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onTrigger = fn
+}
+
+// Status is what the fake answers a status query with.
+func (f *FakeStick3) Status() StickStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.statusLocked()
+}
+
+func (f *FakeStick3) statusLocked() StickStatus {
+	status := StickStatus{DeviceID: stickDeviceID, Scene: f.current, Command: StickSceneOff}
+	s, ok := f.scenes[f.current]
+	if !ok {
+		return status
+	}
+	if s.On {
+		status.Command = StickSceneOn
+	}
+	status.Dimmer, status.Speed = s.Dimmer, s.Speed
+	status.Red, status.Green, status.Blue = s.Red, s.Green, s.Blue
+	return status
+}
+
+// Close stops the fake.
+func (f *FakeStick3) Close() error {
+	err := f.conn.Close()
+	f.wg.Wait()
+	return err
+}
+
+func (f *FakeStick3) readLoop() {
+	defer f.wg.Done()
+	buf := make([]byte, 512)
+	for {
+		n, from, err := f.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		packet := buf[:n]
+
+		if bytes.Equal(packet, BuildStickStatusQuery()) {
+			f.mu.Lock()
+			reply, status := f.statusReplies, f.statusLocked()
+			f.mu.Unlock()
+			if reply {
+				_, _ = f.conn.WriteToUDP(BuildStickStatusReply(status), from)
+			}
+			continue
+		}
+
+		trigger, err := ParseStickQuickTrigger(packet)
+		if err != nil {
+			continue // not for us; a real controller ignores it too
+		}
+		f.mu.Lock()
+		f.apply(trigger)
+		fn := f.onTrigger
+		f.mu.Unlock()
+		if fn != nil {
+			fn(trigger)
+		}
+	}
+}
+
+// apply updates the state for one quick trigger.
+func (f *FakeStick3) apply(trigger StickQuickTrigger) {
+	f.triggers = append(f.triggers, trigger)
+
+	switch trigger.Command {
+	case StickBlackoutOn:
+		f.blackout = true
+		return
+	case StickBlackoutOff:
+		f.blackout = false
+		return
+	}
+
+	s, ok := f.scenes[trigger.Scene]
+	if !ok {
+		s = &FakeStick3Scene{}
+		f.scenes[trigger.Scene] = s
+	}
+	s.ZoneSyncID = trigger.ZoneSyncID
+
+	switch trigger.Command {
+	case StickSceneOn:
+		s.On, s.Paused = true, false
+		f.current = trigger.Scene
+	case StickSceneOff:
+		s.On = false
+		f.current = trigger.Scene
+	case StickPauseOn:
+		s.Paused = true
+	case StickPauseOff:
+		s.Paused = false
+	case StickSceneReset:
+		s.Resets++
+		s.Paused = false
+	case StickDimmerSet:
+		s.Dimmer = trigger.Dimmer
+	case StickSpeedSet:
+		s.Speed = trigger.Speed
+	case StickColorSet:
+		s.Red, s.Green, s.Blue = trigger.Red, trigger.Green, trigger.Blue
+	}
+}
@@ -0,0 +1,272 @@
+package verhboat
+
+// Manual overrides. Turning the sign on or off by hand (DoCommand on/off, a
+// preset, or a switch position) holds it there against the schedule until
+// the schedule next changes what it wants, until a given time, or until
+// clear_override. The override (with its preset) and the color last set with
+// set_color are kept in a small JSON state file, so a restart or reconfigure
+// doesn't undo them.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long an override lasts.
+const (
+	stick3UntilTransition = "transition" // the schedule's next change
+	stick3UntilTime       = "time"       // a given time
+	stick3UntilCleared    = "indefinite" // clear_override
+)
+
+// stick3Override is a manual on or off holding against the schedule.
+type stick3Override struct {
+	On     bool      `json:"on"`
+	Preset string    `json:"preset,omitempty"` // the preset it's showing, if any
+	Until  string    `json:"until"`            // one of the stick3Until constants
+	At     time.Time `json:"at"`               // for stick3UntilTime
+	Since  time.Time `json:"since"`
+
+	// Scheduled is what the schedule wanted when the override was made (see
+	// scheduleKey); a stick3UntilTransition override ends when that changes.
+	Scheduled string `json:"scheduled,omitempty"`
+}
+
+// stick3State is the state file's contents.
+type stick3State struct {
+	Override *stick3Override `json:"override,omitempty"`
+	Color    string          `json:"color,omitempty"`
+}
+
+// stateFile is where the component keeps its state, or "" for nowhere.
+func (c *NicolaudieStick3Config) stateFile(name string) string {
+	switch c.StateFile {
+	case "none":
+		return ""
+	case "":
+		dir := os.Getenv("VIAM_MODULE_DATA")
+		if dir == "" {
+			return ""
+		}
+		return filepath.Join(dir, "nicolaudie-stick3-"+name+".json")
+	default:
+		return c.StateFile
+	}
+}
+
+func loadStick3State(path string) (stick3State, error) {
+	var state stick3State
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// restoreState picks up the override and color from the state file.
+func (s *NicolaudieStick3) restoreState() {
+	state, err := loadStick3State(s.stateFile)
+	if err != nil {
+		s.logger.Warnf("nicolaudie-stick3 %s: ignoring state file: %v", s.conf.IP, err)
+		return
+	}
+	if state.Color != "" {
+		if red, grn, blu, err := ParseHexColor(state.Color); err == nil {
+			s.look.red, s.look.grn, s.look.blu = red, grn, blu
+		}
+	}
+	if o := state.Override; o != nil {
+		s.logger.Infof("nicolaudie-stick3 %s: restoring override %s %s", s.conf.IP, onOff(o.On), o.describe())
+		s.override = o
+	}
+}
+
+// saveStateLocked writes the state file. A failure is only logged; the sign
+// works the same without it.
+func (s *NicolaudieStick3) saveStateLocked() {
+	if s.stateFile == "" {
+		return
+	}
+	state := stick3State{
+		Override: s.override,
+		Color:    fmt.Sprintf("%02X%02X%02X", s.look.red, s.look.grn, s.look.blu),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		// Write and rename so a crash can't leave half a file.
+		tmp := s.stateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, s.stateFile)
+		}
+	}
+	if err != nil {
+		s.logger.Warnf("nicolaudie-stick3 %s: saving state: %v", s.conf.IP, err)
+	}
+}
+
+// untilLocation is the timezone a command's "until" clock time is in: the
+// schedule's, which for "gps" means reading the position.
+func (s *NicolaudieStick3) untilLocation(ctx context.Context, cmd map[string]interface{}) (*time.Location, error) {
+	if _, ok := cmd["until"]; !ok || s.conf.Timezone != gpsTimezone || s.movement == nil {
+		return s.loc, nil
+	}
+	point, _, err := s.movement.Position(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading position: %w", err)
+	}
+	return s.location(point.Lat(), point.Lng()), nil
+}
+
+// parseStick3Until reads a command's "until": "transition" (the default),
+// "indefinite", an RFC 3339 time, or "HH:MM" for its next occurrence in loc.
+func parseStick3Until(cmd map[string]interface{}, now time.Time, loc *time.Location) (until string, at time.Time, err error) {
+	v, ok := cmd["until"]
+	if !ok {
+		return stick3UntilTransition, time.Time{}, nil
+	}
+	str, ok := v.(string)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("\"until\" must be a string")
+	}
+	switch str = strings.TrimSpace(str); str {
+	case "", stick3UntilTransition:
+		return stick3UntilTransition, time.Time{}, nil
+	case stick3UntilCleared:
+		return stick3UntilCleared, time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		if !t.After(now) {
+			return "", time.Time{}, fmt.Errorf("\"until\" %s is in the past", str)
+		}
+		return stick3UntilTime, t, nil
+	}
+	t, err := time.ParseInLocation("15:04", str, loc)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("\"until\" must be %q, %q, an RFC 3339 time or HH:MM, got %q",
+			stick3UntilTransition, stick3UntilCleared, str)
+	}
+	local := now.In(loc)
+	at = time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return stick3UntilTime, at, nil
+}
+
+func (o *stick3Override) describe() string {
+	switch o.Until {
+	case stick3UntilTime:
+		return "until " + o.At.Format(time.RFC3339)
+	case stick3UntilCleared:
+		return "until cleared"
+	default:
+		return "until the schedule changes"
+	}
+}
+
+// ended is whether the override is over at now, when the schedule wants
+// scheduled.
+func (o *stick3Override) ended(now time.Time, scheduled string) bool {
+	switch o.Until {
+	case stick3UntilTime:
+		return !now.Before(o.At)
+	case stick3UntilTransition:
+		return o.Scheduled != "" && scheduled != o.Scheduled
+	default:
+		return false
+	}
+}
+
+// overrideLocked records that the sign was turned on or off by hand, showing
+// preset if it isn't "".
+func (s *NicolaudieStick3) overrideLocked(on bool, preset, until string, at time.Time) {
+	s.override = &stick3Override{
+		On:        on,
+		Preset:    preset,
+		Until:     until,
+		At:        at,
+		Since:     s.now(),
+		Scheduled: s.scheduled,
+	}
+	// The schedule re-applies its entry once the override ends.
+	s.active = -1
+	s.saveStateLocked()
+}
+
+// holdOverrideLocked is the schedule's check while there's an override: it
+// either ends the override or keeps the sign as it says. It returns whether
+// the override is still holding.
+func (s *NicolaudieStick3) holdOverrideLocked(now time.Time, scheduled string) (bool, error) {
+	o := s.override
+	if o == nil {
+		return false, nil
+	}
+	if o.Scheduled == "" {
+		// Made before the schedule's first check.
+		o.Scheduled = scheduled
+	}
+	if o.ended(now, scheduled) {
+		s.logger.Infof("nicolaudie-stick3 %s: override %s ended, back to the schedule", s.conf.IP, onOff(o.On))
+		s.override = nil
+		s.active = -1
+		s.saveStateLocked()
+		return false, nil
+	}
+	if s.asserted && s.on == o.On {
+		return true, nil
+	}
+	return true, s.applyOverrideLocked()
+}
+
+// applyOverrideLocked puts the sign back as the override has it, preset and
+// all, e.g. after a restart.
+func (s *NicolaudieStick3) applyOverrideLocked() error {
+	o := s.override
+	if !o.On || o.Preset == "" {
+		return s.setOnLocked(o.On)
+	}
+	pos, err := s.positionByName(o.Preset)
+	if err != nil {
+		s.logger.Warnf("nicolaudie-stick3 %s: override preset %q is no longer configured", s.conf.IP, o.Preset)
+		return s.setOnLocked(true)
+	}
+	return s.showLocked(s.positionLook(pos))
+}
+
+// clearOverrideLocked ends any override. The caller re-evaluates the
+// schedule.
+func (s *NicolaudieStick3) clearOverrideLocked() {
+	s.override = nil
+	s.active = -1
+	s.saveStateLocked()
+}
+
+// addOverrideLocked adds the override, if any, to a status result.
+func (s *NicolaudieStick3) addOverrideLocked(res map[string]interface{}) {
+	o := s.override
+	if o == nil {
+		return
+	}
+	res["override"] = onOff(o.On)
+	res["override_until"] = o.Until
+	if o.Until == stick3UntilTime {
+		res["override_until_time"] = o.At.Format(time.RFC3339)
+	}
+	res["override_since"] = o.Since.Format(time.RFC3339)
+}
@@ -0,0 +1,221 @@
+package verhboat
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestParseStick3Until(t *testing.T) {
+	now := time.Date(2026, 6, 1, 20, 0, 0, 0, time.UTC)
+
+	until, _, err := parseStick3Until(map[string]interface{}{}, now, time.UTC)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, until, test.ShouldEqual, stick3UntilTransition)
+	until, _, err = parseStick3Until(map[string]interface{}{"until": "indefinite"}, now, time.UTC)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, until, test.ShouldEqual, stick3UntilCleared)
+
+	until, at, err := parseStick3Until(map[string]interface{}{"until": "07:00"}, now, time.UTC)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, until, test.ShouldEqual, stick3UntilTime)
+	test.That(t, at, test.ShouldEqual, time.Date(2026, 6, 2, 7, 0, 0, 0, time.UTC))
+	_, at, err = parseStick3Until(map[string]interface{}{"until": "22:30"}, now, time.UTC)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, at, test.ShouldEqual, time.Date(2026, 6, 1, 22, 30, 0, 0, time.UTC))
+	_, at, err = parseStick3Until(map[string]interface{}{"until": "2026-06-03T08:00:00Z"}, now, time.UTC)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, at, test.ShouldEqual, time.Date(2026, 6, 3, 8, 0, 0, 0, time.UTC))
+
+	for _, bad := range []interface{}{"soon", "25:00", "2026-05-01T08:00:00Z", 7.0} {
+		_, _, err := parseStick3Until(map[string]interface{}{"until": bad}, now, time.UTC)
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+func TestStick3Overrides(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Color: "FFFFFF", OnAt: "18:00", OffAt: "06:00", Timezone: "UTC",
+		StateFile: filepath.Join(t.TempDir(), "sign.json"),
+	}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	day := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	var s *NicolaudieStick3
+	start := func() {
+		s, err = makeNicolaudieStick3(nil, generic.Named("sign"), conf, logging.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+	}
+	at := func(hours float64) {
+		t.Helper()
+		n := len(f.Triggers())
+		s.now = func() time.Time { return day.Add(time.Duration(hours * float64(time.Hour))) }
+		test.That(t, s.evaluateSchedule(ctx), test.ShouldBeNil)
+		// Let anything just sent arrive.
+		time.Sleep(50 * time.Millisecond)
+		_ = f.WaitForTriggers(n, time.Second)
+	}
+	do := func(cmd map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		res, err := s.DoCommand(ctx, cmd)
+		test.That(t, err, test.ShouldBeNil)
+		return res
+	}
+	signOn := func() bool { return f.Scene(0, 1).On }
+
+	start()
+	at(20)
+	test.That(t, signOn(), test.ShouldBeTrue)
+
+	// Off by hand holds until the schedule next changes...
+	res := do(map[string]interface{}{"command": "off"})
+	test.That(t, res["override"], test.ShouldEqual, "off")
+	test.That(t, res["override_until"], test.ShouldEqual, stick3UntilTransition)
+	at(23)
+	test.That(t, signOn(), test.ShouldBeFalse)
+	// ...which it does at 06:00, off anyway; at 18:00 it comes back on.
+	at(24 + 7)
+	test.That(t, do(map[string]interface{}{"command": "status"})["override"], test.ShouldBeNil)
+	at(24 + 19)
+	test.That(t, signOn(), test.ShouldBeTrue)
+
+	// An indefinite override and the color survive a restart.
+	do(map[string]interface{}{"command": "set_color", "color": "FF8000"})
+	do(map[string]interface{}{"command": "off", "until": "indefinite"})
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+	start()
+	at(48 + 7)
+	at(48 + 20)
+	test.That(t, signOn(), test.ShouldBeFalse)
+	status := do(map[string]interface{}{"command": "status"})
+	test.That(t, status["override"], test.ShouldEqual, "off")
+	test.That(t, status["override_until"], test.ShouldEqual, stick3UntilCleared)
+	test.That(t, status["color"], test.ShouldEqual, "FF8000")
+
+	// clear_override goes back to the schedule now.
+	res = do(map[string]interface{}{"command": "clear_override"})
+	test.That(t, res["on"], test.ShouldBeTrue)
+	time.Sleep(50 * time.Millisecond)
+	test.That(t, signOn(), test.ShouldBeTrue)
+	test.That(t, f.Scene(0, 1).Color(), test.ShouldEqual, "FF8000")
+
+	// An override until a time holds through a transition.
+	do(map[string]interface{}{"command": "on", "until": "08:00"})
+	at(72 + 7)
+	test.That(t, signOn(), test.ShouldBeTrue)
+	at(72 + 8)
+	test.That(t, signOn(), test.ShouldBeFalse)
+
+	// A transition that passed while the module was down ends the override.
+	at(72 + 20)
+	do(map[string]interface{}{"command": "off"})
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+	start()
+	at(96 + 19)
+	test.That(t, signOn(), test.ShouldBeFalse)
+	at(96 + 19.5)
+	test.That(t, signOn(), test.ShouldBeFalse)
+	at(120 + 7)
+	at(120 + 19)
+	test.That(t, signOn(), test.ShouldBeTrue)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+}
+
+func TestStick3PresetOverrideRestored(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Color: "FFFFFF", OnAt: "18:00", OffAt: "06:00", Timezone: "UTC",
+		Presets:   []Stick3Preset{{Name: "party", Scene: 4, Color: "0000FF"}},
+		StateFile: filepath.Join(t.TempDir(), "sign.json"),
+	}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	now := time.Date(2026, 6, 1, 20, 0, 0, 0, time.UTC)
+	start := func() *NicolaudieStick3 {
+		s, err := makeNicolaudieStick3(nil, generic.Named("sign"), conf, logging.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+		s.now = func() time.Time { return now }
+		return s
+	}
+
+	s := start()
+	test.That(t, s.evaluateSchedule(ctx), test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "preset", "preset": "party", "until": "indefinite"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+
+	// The controller lost power with the module: everything's off.
+	f.Close()
+	f, err = NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	conf.Port = f.Port()
+
+	s = start()
+	defer s.Close(ctx)
+	now = now.Add(time.Hour)
+	n := len(f.Triggers())
+	test.That(t, s.evaluateSchedule(ctx), test.ShouldBeNil)
+	_ = f.WaitForTriggers(n+2, time.Second)
+	test.That(t, f.Scene(0, 4).On, test.ShouldBeTrue)
+	test.That(t, f.Scene(0, 4).Color(), test.ShouldEqual, "0000FF")
+	test.That(t, f.Scene(0, 1).On, test.ShouldBeFalse)
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["preset"], test.ShouldEqual, "party")
+	test.That(t, status["override"], test.ShouldEqual, "on")
+}
+
+func TestStick3UntilGPSTimezone(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Color: "FFFFFF", OnAt: "18:00", OffAt: "06:00",
+		Timezone: gpsTimezone, MovementSensor: "gps", StateFile: "none",
+		Presets: []Stick3Preset{{Name: "party", Scene: 4}},
+	}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	deps := resource.Dependencies{movementsensor.Named("gps"): &testGPS{lat: 40.7128, lng: -74.0060}}
+	s, err := makeNicolaudieStick3(deps, generic.Named("sign"), conf, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer s.Close(ctx)
+	// 20:00 EDT.
+	s.now = func() time.Time { return time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC) }
+
+	// The boat is in New York, so 23:30 is EDT, as the schedule has it.
+	for _, cmd := range []map[string]interface{}{
+		{"command": "on", "until": "23:30"},
+		{"command": "preset", "preset": "party", "until": "23:30"},
+	} {
+		_, err := s.DoCommand(ctx, cmd)
+		test.That(t, err, test.ShouldBeNil)
+		status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["override_until_time"], test.ShouldEqual, "2026-07-26T23:30:00-04:00")
+	}
+	test.That(t, s.SetPosition(ctx, 0, map[string]interface{}{"until": "07:15"}), test.ShouldBeNil)
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["override_until_time"], test.ShouldEqual, "2026-07-27T07:15:00-04:00")
+}
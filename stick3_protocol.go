@@ -41,11 +41,34 @@ const (
 	StickBlackoutOn  StickCommand = 9
 )
 
+var stickCommandNames = map[StickCommand]string{
+	StickSceneOff:    "scene-off",
+	StickSceneOn:     "scene-on",
+	StickPauseOff:    "pause-off",
+	StickPauseOn:     "pause-on",
+	StickSceneReset:  "scene-reset",
+	StickDimmerSet:   "dimmer",
+	StickSpeedSet:    "speed",
+	StickColorSet:    "color",
+	StickBlackoutOff: "blackout-off",
+	StickBlackoutOn:  "blackout-on",
+}
+
+func (c StickCommand) String() string {
+	if name, ok := stickCommandNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("command-%d", byte(c))
+}
+
 // Stick3Client is a STICK-DE3 UDP quick-trigger client.
 type Stick3Client struct {
-	address string
+	address *stickAddress   // shared with the clients WithZone makes
+	queue   *stickSendQueue // likewise, see stick3_queue.go
 	timeout time.Duration
 	debug   bool
+	zone    byte // zone synchronization ID stamped on triggers, see WithZone
+	nowait  bool // see Coalescing
 }
 
 // StickQuickTrigger is a single quick-trigger command.
@@ -60,13 +83,10 @@ type StickQuickTrigger struct {
 	Blue       byte
 }
 
-// NewStick3Client creates a STICK-DE3 UDP client.
-func NewStick3Client(ip string, port int, timeout time.Duration, debug bool) (*Stick3Client, error) {
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return nil, fmt.Errorf("invalid controller IP address %q", ip)
-	}
-
+// NewStick3Client creates a STICK-DE3 UDP client. host is an IPv4 or IPv6
+// address, a hostname (looked up when sending, see stick3_address.go) or
+// StickBroadcastHost.
+func NewStick3Client(host string, port int, timeout time.Duration, debug bool) (*Stick3Client, error) {
 	if port < 1 || port > 65535 {
 		return nil, fmt.Errorf("invalid UDP port %d", port)
 	}
@@ -75,13 +95,32 @@ func NewStick3Client(ip string, port int, timeout time.Duration, debug bool) (*S
 		return nil, errors.New("timeout must be greater than zero")
 	}
 
+	address, err := newStickAddress(host, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Stick3Client{
-		address: net.JoinHostPort(ip, strconv.Itoa(port)),
+		address: address,
+		queue:   newStickSendQueue(),
 		timeout: timeout,
 		debug:   debug,
 	}, nil
 }
 
+// Address is the controller's address as configured, "host:port".
+func (c *Stick3Client) Address() string {
+	return c.address.String()
+}
+
+// WithZone returns a client for the same controller whose triggers carry the
+// given zone synchronization ID, for scenes that belong to a zone.
+func (c *Stick3Client) WithZone(zoneSyncID byte) *Stick3Client {
+	zoned := *c
+	zoned.zone = zoneSyncID
+	return &zoned
+}
+
 // StickAbsoluteScene converts a zero-based page and a one-based scene number
 // into the absolute scene number expected by the STICK-DE3.
 //
@@ -149,17 +188,68 @@ func BuildStickQuickTrigger(trigger StickQuickTrigger) []byte {
 	return packet
 }
 
-// Send transmits a single quick-trigger command over UDP.
+// ParseStickQuickTrigger decodes a packet built by BuildStickQuickTrigger.
+func ParseStickQuickTrigger(packet []byte) (StickQuickTrigger, error) {
+	if len(packet) != stickPacketSize {
+		return StickQuickTrigger{}, fmt.Errorf("quick trigger must be %d bytes, got %d", stickPacketSize, len(packet))
+	}
+	if !strings.HasPrefix(string(packet[0:8]), stickDeviceIDPrefix) {
+		return StickQuickTrigger{}, fmt.Errorf("quick trigger has unknown device id % X", packet[0:8])
+	}
+	if op := binary.LittleEndian.Uint16(packet[8:10]); op != stickQuickTriggerOpcode {
+		return StickQuickTrigger{}, fmt.Errorf("not a quick trigger: opcode %d", op)
+	}
+
+	return StickQuickTrigger{
+		Scene:      binary.LittleEndian.Uint16(packet[10:12]),
+		ZoneSyncID: packet[12],
+		Command:    StickCommand(packet[13]),
+		Dimmer:     binary.LittleEndian.Uint16(packet[14:16]),
+		Speed:      binary.LittleEndian.Uint16(packet[16:18]),
+		Red:        packet[20],
+		Green:      packet[21],
+		Blue:       packet[22],
+	}, nil
+}
+
+// Send queues a single quick-trigger command and waits for it to go out over
+// UDP, unless the client is from Coalescing.
 func (c *Stick3Client) Send(trigger StickQuickTrigger) error {
-	packet := BuildStickQuickTrigger(trigger)
+	if trigger.ZoneSyncID == 0 {
+		trigger.ZoneSyncID = c.zone
+	}
+	done := c.queue.enqueue(c, BuildStickQuickTrigger(trigger), !c.nowait)
+	if done == nil {
+		return nil
+	}
+	return <-done
+}
+
+// transmit sends a packet now. If sending to a hostname fails, it's looked
+// up again and the send tried once more.
+func (c *Stick3Client) transmit(packet []byte) error {
+	err := c.send(packet)
+	if err != nil && !c.address.literal {
+		// The controller may have a new address; look it up and try again.
+		c.address.forget()
+		err = c.send(packet)
+	}
+	return err
+}
+
+func (c *Stick3Client) send(packet []byte) error {
+	dest, err := c.address.resolve()
+	if err != nil {
+		return err
+	}
 
 	if c.debug {
-		fmt.Printf("destination: %s\n", c.address)
+		fmt.Printf("destination: %s (%s)\n", c.address, dest)
 		fmt.Printf("packet size: %d\n", len(packet))
 		fmt.Printf("packet: % X\n", packet)
 	}
 
-	conn, err := net.DialTimeout("udp", c.address, c.timeout)
+	conn, err := net.DialUDP("udp", nil, dest)
 	if err != nil {
 		return fmt.Errorf("open UDP connection to %s: %w", c.address, err)
 	}
@@ -0,0 +1,276 @@
+package verhboat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestStickQuickTriggerPacket(t *testing.T) {
+	packet := BuildStickQuickTrigger(StickQuickTrigger{
+		Scene: 53, ZoneSyncID: 7, Command: StickColorSet, Dimmer: 0x0102, Speed: 0x0304, Red: 0xAA, Green: 0xBB, Blue: 0xCC,
+	})
+	test.That(t, packet, test.ShouldResemble, []byte{
+		'S', 't', 'i', 'c', 'k', '_', '3', 'A',
+		0x6D, 0x00, // opcode 109
+		53, 0, // scene
+		7,          // zone
+		7,          // command
+		0x02, 0x01, // dimmer
+		0x04, 0x03, // speed
+		0, 0,
+		0xAA, 0xBB, 0xCC, 0,
+	})
+
+	trigger, err := ParseStickQuickTrigger(packet)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, trigger, test.ShouldResemble, StickQuickTrigger{
+		Scene: 53, ZoneSyncID: 7, Command: StickColorSet, Dimmer: 0x0102, Speed: 0x0304, Red: 0xAA, Green: 0xBB, Blue: 0xCC,
+	})
+
+	_, err = ParseStickQuickTrigger(packet[:20])
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = ParseStickQuickTrigger(BuildStickStatusReply(StickStatus{Scene: 1}))
+	test.That(t, err, test.ShouldNotBeNil)
+	bad := append([]byte(nil), packet...)
+	copy(bad, "Nope_3A!")
+	_, err = ParseStickQuickTrigger(bad)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	test.That(t, StickSceneOn.String(), test.ShouldEqual, "scene-on")
+	test.That(t, StickCommand(42).String(), test.ShouldEqual, "command-42")
+}
+
+func TestStickAbsoluteScene(t *testing.T) {
+	n, err := StickAbsoluteScene(0, 1)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 1)
+	n, err = StickAbsoluteScene(2, 50)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 150)
+
+	for _, bad := range [][2]int{{-1, 1}, {0, 0}, {0, 51}, {2000, 1}} {
+		_, err := StickAbsoluteScene(bad[0], bad[1])
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+
+	page, err := ParseStickPage("b")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, page, test.ShouldEqual, 1)
+	page, err = ParseStickPage("3")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, page, test.ShouldEqual, 3)
+	_, err = ParseStickPage("?")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	r, g, b, err := ParseHexColor("#00FF80")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, []byte{r, g, b}, test.ShouldResemble, []byte{0, 255, 128})
+	_, _, _, err = ParseHexColor("F00")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestFakeStick3(t *testing.T) {
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	client, err := NewStick3Client(f.Host(), f.Port(), time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+	zoned := client.WithZone(4)
+
+	test.That(t, client.SceneOn(1, 3), test.ShouldBeNil)
+	test.That(t, client.SetColor(1, 3, 255, 128, 0), test.ShouldBeNil)
+	test.That(t, client.SetDimmerPercent(1, 3, 50), test.ShouldBeNil)
+	test.That(t, client.SetSpeedRaw(1, 3, 200), test.ShouldBeNil)
+	test.That(t, client.PauseScene(1, 3), test.ShouldBeNil)
+	test.That(t, zoned.SceneOn(0, 2), test.ShouldBeNil)
+	test.That(t, zoned.SceneOff(0, 2), test.ShouldBeNil)
+	test.That(t, client.ResetScene(1, 3), test.ShouldBeNil)
+	test.That(t, client.BlackoutOn(), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(9, time.Second), test.ShouldBeNil)
+
+	test.That(t, f.Scene(1, 3), test.ShouldResemble, FakeStick3Scene{
+		On: true, Resets: 1, Red: 255, Green: 128, Dimmer: 64, Speed: 200,
+	})
+	test.That(t, f.Scene(1, 3).Color(), test.ShouldEqual, "FF8000")
+	test.That(t, f.Scene(0, 2), test.ShouldResemble, FakeStick3Scene{ZoneSyncID: 4})
+	test.That(t, f.Scene(0, 1), test.ShouldResemble, FakeStick3Scene{})
+	test.That(t, f.OnScenes(), test.ShouldResemble, []uint16{53})
+	test.That(t, f.Blackout(), test.ShouldBeTrue)
+	test.That(t, f.Triggers()[4], test.ShouldResemble, StickQuickTrigger{Scene: 53, Command: StickPauseOn})
+
+	test.That(t, client.BlackoutOff(), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(10, time.Second), test.ShouldBeNil)
+	test.That(t, f.Blackout(), test.ShouldBeFalse)
+
+	// Status is for the scene last switched: scene A2, now off.
+	status, err := client.QueryStatus()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status.Scene, test.ShouldEqual, 2)
+	test.That(t, status.On(), test.ShouldBeFalse)
+
+	test.That(t, client.SceneOn(1, 3), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(11, time.Second), test.ShouldBeNil)
+	status, err = client.QueryStatus()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status.On(), test.ShouldBeTrue)
+	test.That(t, status.Color(), test.ShouldEqual, "FF8000")
+	test.That(t, status.Dimmer, test.ShouldEqual, 64)
+
+	f.SetStatusReplies(false)
+	client.timeout = 100 * time.Millisecond
+	_, err = client.QueryStatus()
+	test.That(t, err, test.ShouldEqual, ErrStickNoStatus)
+	test.That(t, f.WaitForTriggers(12, 50*time.Millisecond), test.ShouldNotBeNil)
+}
+
+// TestStick3AgainstFake drives the component against the fake and checks
+// what the controller ends up showing, rather than the packets.
+func TestStick3AgainstFake(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Page: "B", Scene: 2, Color: "FF0000", ReassertSeconds: -1, StatusReadback: true,
+		Zones: []Stick3Zone{{Name: "underwater", Scene: 5, ZoneSyncID: 2, Color: "0000FF"}},
+	}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	res, err := newNicolaudieStick3(ctx, nil, resource.Config{
+		Name:                "sign",
+		API:                 generic.API,
+		ConvertedAttributes: conf,
+	}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer res.Close(ctx)
+	s := res.(*NicolaudieStick3)
+
+	do := func(cmd map[string]interface{}) {
+		t.Helper()
+		_, err := res.DoCommand(ctx, cmd)
+		test.That(t, err, test.ShouldBeNil)
+	}
+
+	do(map[string]interface{}{"command": "on"})
+	do(map[string]interface{}{"command": "dimmer", "dimmer": 50.0})
+	do(map[string]interface{}{"command": "set_color", "color": "00FF00"})
+	do(map[string]interface{}{"command": "on", "zone": "underwater"})
+	test.That(t, f.WaitForTriggers(6, time.Second), test.ShouldBeNil)
+
+	sign := f.Scene(1, 2)
+	test.That(t, sign.On, test.ShouldBeTrue)
+	test.That(t, sign.Color(), test.ShouldEqual, "00FF00")
+	test.That(t, sign.Dimmer, test.ShouldEqual, 64)
+	zone := f.Scene(0, 5)
+	test.That(t, zone.On, test.ShouldBeTrue)
+	test.That(t, zone.Color(), test.ShouldEqual, "0000FF")
+	test.That(t, zone.ZoneSyncID, test.ShouldEqual, 2)
+
+	do(map[string]interface{}{"command": "scene", "page": "B", "scene": 3.0})
+	test.That(t, f.WaitForTriggers(10, time.Second), test.ShouldBeNil)
+	test.That(t, f.OnScenes(), test.ShouldResemble, []uint16{5, 53})
+	test.That(t, f.Scene(1, 3).Color(), test.ShouldEqual, "00FF00")
+
+	do(map[string]interface{}{"command": "blackout"})
+	test.That(t, f.WaitForTriggers(11, time.Second), test.ShouldBeNil)
+	test.That(t, f.Blackout(), test.ShouldBeTrue)
+	do(map[string]interface{}{"command": "unblackout"})
+	do(map[string]interface{}{"command": "off"})
+	test.That(t, f.WaitForTriggers(13, time.Second), test.ShouldBeNil)
+	test.That(t, f.Blackout(), test.ShouldBeFalse)
+	test.That(t, f.OnScenes(), test.ShouldResemble, []uint16{5})
+
+	// The fake reports the sign off, which agrees, so a reassert only
+	// re-sends the zone.
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(15, time.Second), test.ShouldBeNil)
+	test.That(t, f.Triggers()[13:], test.ShouldResemble, []StickQuickTrigger{
+		{Scene: 5, ZoneSyncID: 2, Command: StickSceneOn},
+		{Scene: 5, ZoneSyncID: 2, Command: StickColorSet, Blue: 255},
+	})
+}
+
+func TestStick3ClientAddress(t *testing.T) {
+	for _, good := range []string{"192.168.1.60", "::1", "[fe80::1]", "fe80::1%eth0", "stick-de3", "stick3.boat.lan", "broadcast", "BROADCAST"} {
+		test.That(t, ValidateStickHost(good), test.ShouldBeNil)
+	}
+	for _, bad := range []string{"", " ", "192.168.1.60:2430", "-stick", "stick_3", "stick..lan", "[stick]"} {
+		test.That(t, ValidateStickHost(bad), test.ShouldNotBeNil)
+	}
+	_, _, err := (&NicolaudieStick3Config{IP: "sign.local"}).Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	_, _, err = (&NicolaudieStick3Config{IP: "sign local"}).Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	_, _, err = (&NicolaudieStick3Config{IP: "10.0.0.5", Port: 70000}).Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	client, err := NewStick3Client("broadcast", StickDefaultPort, time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+	dest, err := client.address.resolve()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, dest.String(), test.ShouldEqual, "255.255.255.255:2430")
+	test.That(t, stickIsBroadcast(dest), test.ShouldBeTrue)
+
+	client, err = NewStick3Client("[::1]", StickDefaultPort, time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, client.Address(), test.ShouldEqual, "[::1]:2430")
+	dest, err = client.address.resolve()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stickIsBroadcast(dest), test.ShouldBeFalse)
+
+	// A hostname is looked up when sending, and its zoned clients share the
+	// answer.
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	client, err = NewStick3Client("stick-de3", f.Port(), time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+	var lookups []string
+	answer := []net.IPAddr{{IP: net.ParseIP("::1")}, {IP: net.ParseIP("127.0.0.1")}}
+	var lookupErr error
+	client.address.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups = append(lookups, host)
+		return answer, lookupErr
+	}
+
+	test.That(t, client.SceneOn(0, 1), test.ShouldBeNil)
+	test.That(t, client.WithZone(3).SceneOn(0, 2), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(2, time.Second), test.ShouldBeNil)
+	test.That(t, lookups, test.ShouldResemble, []string{"stick-de3"})
+	test.That(t, f.OnScenes(), test.ShouldResemble, []uint16{1, 2})
+
+	// After stickResolveTTL it's looked up again...
+	client.address.resolvedAt = time.Now().Add(-stickResolveTTL)
+	test.That(t, client.SceneOff(0, 1), test.ShouldBeNil)
+	test.That(t, lookups, test.ShouldHaveLength, 2)
+
+	// ...and if that fails, the last answer is kept.
+	client.address.forget()
+	answer, lookupErr = nil, errors.New("no such host")
+	test.That(t, client.SceneOff(0, 2), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(4, time.Second), test.ShouldBeNil)
+	test.That(t, lookups, test.ShouldHaveLength, 3)
+
+	// A name that never resolved fails when sending, not before.
+	client, err = NewStick3Client("nowhere", f.Port(), time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+	client.address.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return nil, errors.New("no such host")
+	}
+	test.That(t, client.SceneOn(0, 1), test.ShouldNotBeNil)
+	_, err = client.QueryStatus()
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err, test.ShouldNotEqual, ErrStickNoStatus)
+}
@@ -0,0 +1,214 @@
+package verhboat
+
+// The Stick3Client send queue. The STICK-DE3 drops packets that arrive too
+// close together (a scene-on straight after a color, say), so every packet a
+// client and its WithZone copies send goes through one queue that spaces
+// them by the pacing interval and, optionally, sends each a few times.
+//
+// Send waits for its packet to go out and returns its error. The client from
+// Coalescing doesn't wait: its packets are queued and its errors only show
+// up in LastSendError. A queued dimmer, speed or color update that hasn't
+// gone out yet is replaced by a newer one for the same scene and zone, so an
+// animation streaming colors faster than they can be paced never backs up.
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+const (
+	// StickDefaultPacing is the default gap between packets.
+	StickDefaultPacing = 20 * time.Millisecond
+
+	stickMaxRepeat = 5
+)
+
+// stickSend is a queued packet and whoever is waiting for it.
+type stickSend struct {
+	client  *Stick3Client
+	packet  []byte
+	waiters []chan error
+}
+
+// stickIsUpdate is whether a packet sets a level or color, which a newer one
+// can replace.
+func stickIsUpdate(packet []byte) bool {
+	switch StickCommand(packet[13]) {
+	case StickDimmerSet, StickSpeedSet, StickColorSet:
+		return true
+	}
+	return false
+}
+
+// sameScene is whether a packet is for the same scene and zone of the same
+// controller as this one.
+func (s *stickSend) sameScene(client *Stick3Client, packet []byte) bool {
+	return s.client.address == client.address && bytes.Equal(s.packet[10:13], packet[10:13])
+}
+
+// stickSendQueue paces the packets for one controller. A goroutine sends
+// them while there are any, and exits when the queue is empty.
+type stickSendQueue struct {
+	mu        sync.Mutex
+	pacing    time.Duration
+	repeat    int
+	pending   []*stickSend
+	running   bool
+	lastSent  time.Time
+	sent      int
+	coalesced int
+	lastErr   error
+	lastErrAt time.Time
+}
+
+func newStickSendQueue() *stickSendQueue {
+	return &stickSendQueue{pacing: StickDefaultPacing, repeat: 1}
+}
+
+// enqueue queues packet, merging it into a pending update it replaces, and
+// returns a channel for the result if wait is set.
+func (q *stickSendQueue) enqueue(client *Stick3Client, packet []byte, wait bool) chan error {
+	var done chan error
+	if wait {
+		done = make(chan error, 1)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Look back for the same update to replace, but not past anything else
+	// sent to the scene, such as turning it on, which has to stay in order.
+	var item *stickSend
+	for i := len(q.pending) - 1; i >= 0 && stickIsUpdate(packet); i-- {
+		p := q.pending[i]
+		if !p.sameScene(client, packet) {
+			continue
+		}
+		if !stickIsUpdate(p.packet) {
+			break
+		}
+		if p.packet[13] == packet[13] {
+			item = p
+			break
+		}
+	}
+	if item != nil {
+		item.packet = packet
+		q.coalesced++
+	} else {
+		item = &stickSend{client: client, packet: packet}
+		q.pending = append(q.pending, item)
+	}
+	if done != nil {
+		item.waiters = append(item.waiters, done)
+	}
+
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+	return done
+}
+
+func (q *stickSendQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		// Wait before taking the next packet, not after, so updates that
+		// arrive meanwhile can still replace it.
+		if wait := time.Until(q.lastSent.Add(q.pacing)); wait > 0 {
+			q.mu.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		item := q.pending[0]
+		q.pending = q.pending[1:]
+		repeat := q.repeat
+		q.mu.Unlock()
+
+		var err error
+		for i := 0; i < repeat; i++ {
+			if i > 0 {
+				q.pace()
+			}
+			if sendErr := item.client.transmit(item.packet); sendErr != nil && err == nil {
+				err = sendErr
+			}
+			q.mu.Lock()
+			q.lastSent = time.Now()
+			q.mu.Unlock()
+		}
+
+		q.mu.Lock()
+		q.sent++
+		if err != nil {
+			q.lastErr, q.lastErrAt = err, time.Now()
+		}
+		waiters := item.waiters
+		q.mu.Unlock()
+
+		for _, w := range waiters {
+			w <- err
+		}
+	}
+}
+
+// pace waits until the pacing interval has passed since the last packet.
+func (q *stickSendQueue) pace() {
+	q.mu.Lock()
+	wait := time.Until(q.lastSent.Add(q.pacing))
+	q.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// SetPacing sets the minimum gap between packets, StickDefaultPacing unless
+// set; 0 sends them as fast as they come. Clients made by WithZone and
+// Coalescing share the queue, so it applies to them all.
+func (c *Stick3Client) SetPacing(gap time.Duration) {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	if gap < 0 {
+		gap = 0
+	}
+	c.queue.pacing = gap
+}
+
+// SetRepeat sets how many times each packet is sent, 1 to 5, for links that
+// lose them. It applies like SetPacing.
+func (c *Stick3Client) SetRepeat(n int) {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	c.queue.repeat = max(1, min(n, stickMaxRepeat))
+}
+
+// Coalescing returns a client for the same controller and zone whose sends
+// are queued without waiting for them, for streams of updates such as
+// animations.
+func (c *Stick3Client) Coalescing() *Stick3Client {
+	nowait := *c
+	nowait.nowait = true
+	return &nowait
+}
+
+// LastSendError is when the most recent error sending to the controller
+// happened, and the error, or nil if there hasn't been one.
+func (c *Stick3Client) LastSendError() (time.Time, error) {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	return c.queue.lastErrAt, c.queue.lastErr
+}
+
+// SendStats is how many packets have gone out (not counting repeats), and
+// how many updates were replaced by newer ones before they could.
+func (c *Stick3Client) SendStats() (sent, coalesced int) {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	return c.queue.sent, c.queue.coalesced
+}
@@ -0,0 +1,109 @@
+package verhboat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestStick3SendQueue(t *testing.T) {
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	client, err := NewStick3Client(f.Host(), f.Port(), time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+
+	// Sends are paced, and Send waits for its packet.
+	client.SetPacing(50 * time.Millisecond)
+	start := time.Now()
+	test.That(t, client.SceneOn(0, 1), test.ShouldBeNil)
+	test.That(t, client.SetColor(0, 1, 255, 0, 0), test.ShouldBeNil)
+	test.That(t, client.SetDimmerPercent(0, 1, 50), test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+	test.That(t, f.WaitForTriggers(3, time.Second), test.ShouldBeNil)
+
+	// Repeats count as one send.
+	client.SetRepeat(3)
+	test.That(t, client.WithZone(2).SceneOff(0, 1), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(6, time.Second), test.ShouldBeNil)
+	for _, tr := range f.Triggers()[3:] {
+		test.That(t, tr, test.ShouldResemble, StickQuickTrigger{Scene: 1, ZoneSyncID: 2, Command: StickSceneOff})
+	}
+	sent, coalesced := client.SendStats()
+	test.That(t, sent, test.ShouldEqual, 4)
+	test.That(t, coalesced, test.ShouldEqual, 0)
+	client.SetRepeat(1)
+
+	// Updates still queued are replaced by newer ones, but not past anything
+	// else sent to the scene.
+	client.SetPacing(100 * time.Millisecond)
+	stream := client.Coalescing()
+	test.That(t, stream.SetColor(0, 1, 1, 0, 0), test.ShouldBeNil)
+	test.That(t, stream.SetColor(0, 1, 2, 0, 0), test.ShouldBeNil)
+	test.That(t, stream.SetDimmerPercent(0, 1, 10), test.ShouldBeNil)
+	test.That(t, stream.SetColor(0, 1, 3, 0, 0), test.ShouldBeNil)
+	test.That(t, stream.SetDimmerPercent(0, 1, 20), test.ShouldBeNil)
+	test.That(t, stream.SceneOn(0, 1), test.ShouldBeNil)
+	test.That(t, stream.SetColor(0, 1, 4, 0, 0), test.ShouldBeNil)
+	test.That(t, client.SetColor(0, 1, 5, 0, 0), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(10, time.Second), test.ShouldBeNil)
+	test.That(t, f.Triggers()[6:], test.ShouldResemble, []StickQuickTrigger{
+		{Scene: 1, Command: StickColorSet, Red: 3},
+		{Scene: 1, Command: StickDimmerSet, Dimmer: 25},
+		{Scene: 1, Command: StickSceneOn},
+		{Scene: 1, Command: StickColorSet, Red: 5},
+	})
+	_, coalesced = client.SendStats()
+	test.That(t, coalesced, test.ShouldEqual, 4)
+
+	_, err = client.LastSendError()
+	test.That(t, err, test.ShouldBeNil)
+}
+
+func TestStick3SendQueueConcurrent(t *testing.T) {
+	f, err := NewFakeStick3("127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+
+	client, err := NewStick3Client(f.Host(), f.Port(), time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+	client.SetPacing(time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(scene int) {
+			defer wg.Done()
+			zoned := client.WithZone(byte(scene))
+			for j := 0; j < 5; j++ {
+				if err := zoned.SceneOn(0, scene); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	test.That(t, f.WaitForTriggers(50, time.Second), test.ShouldBeNil)
+	test.That(t, f.OnScenes(), test.ShouldHaveLength, 10)
+}
+
+func TestStick3LastSendError(t *testing.T) {
+	client, err := NewStick3Client("nowhere", StickDefaultPort, 100*time.Millisecond, false)
+	test.That(t, err, test.ShouldBeNil)
+	client.address.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return nil, errors.New("no such host")
+	}
+
+	// A Coalescing send doesn't see the error, but LastSendError does.
+	test.That(t, client.Coalescing().SceneOn(0, 1), test.ShouldBeNil)
+	test.That(t, client.SceneOff(0, 1), test.ShouldNotBeNil)
+	at, err := client.LastSendError()
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, at.IsZero(), test.ShouldBeFalse)
+}
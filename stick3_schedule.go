@@ -0,0 +1,340 @@
+package verhboat
+
+// Schedules for the nicolaudie-stick3 sign: a list of entries, each saying
+// when it applies (dates, weekdays, holidays, and a daily on window that may
+// be relative to sunrise/sunset) and what the sign shows then. The first
+// entry that applies wins, so specific entries (July 4th) go before general
+// ones (every night).
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	stick3DefaultStart = "sunset-1h"
+	stick3DefaultEnd   = "sunrise"
+)
+
+// Stick3ScheduleEntry is one entry of a nicolaudie-stick3 schedule.
+type Stick3ScheduleEntry struct {
+	Name string `json:"name,omitempty"`
+
+	// From and To limit the entry to a date range, inclusive. Either
+	// "MM-DD" (every year; a range may wrap over new year) or "YYYY-MM-DD".
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Weekdays limits the entry to some days: "mon", "tue", ...
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Holidays limits the entry to named days: built-in ones such as
+	// "independence_day" or "thanksgiving", or ones defined in the config's
+	// holidays.
+	Holidays []string `json:"holidays,omitempty"`
+
+	// Start and End are the daily window the sign is on: "HH:MM", or a sun
+	// event (see SunEvents: sunrise, civil_dusk, solar_noon, ...) with an
+	// optional offset such as "sunset-1h" or
+	// "sunrise+30m". An End before Start is on the next day. Defaults to
+	// sunset-1h until sunrise. Date filters apply to the day the window
+	// starts.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// What the sign shows; unset fields use the component's config.
+	Page   string `json:"page,omitempty"`
+	Scene  int    `json:"scene,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Dimmer *int   `json:"dimmer,omitempty"` // percent
+	Speed  *int   `json:"speed,omitempty"`  // percent
+
+	// Off keeps the sign off while the entry applies.
+	Off bool `json:"off,omitempty"`
+}
+
+func (e *Stick3ScheduleEntry) displayName(i int) string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("entry %d", i)
+}
+
+func (e *Stick3ScheduleEntry) startOrDefault() string {
+	if e.Start == "" {
+		return stick3DefaultStart
+	}
+	return e.Start
+}
+
+func (e *Stick3ScheduleEntry) endOrDefault() string {
+	if e.End == "" {
+		return stick3DefaultEnd
+	}
+	return e.End
+}
+
+func (e *Stick3ScheduleEntry) validate(holidays map[string][]string) error {
+	from, err := parseStick3Date(e.From)
+	if err != nil {
+		return err
+	}
+	to, err := parseStick3Date(e.To)
+	if err != nil {
+		return err
+	}
+	if e.From != "" && e.To != "" && (from.year == 0) != (to.year == 0) {
+		return fmt.Errorf("from and to must both be MM-DD or both be YYYY-MM-DD")
+	}
+
+	for _, d := range e.Weekdays {
+		if _, err := parseWeekday(d); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range e.Holidays {
+		if _, ok := holidays[h]; ok {
+			continue
+		}
+		if _, ok := stick3BuiltinHolidays[h]; !ok {
+			return fmt.Errorf("unknown holiday %q", h)
+		}
+	}
+
+	for _, t := range []string{e.startOrDefault(), e.endOrDefault()} {
+		if _, err := parseSunTime(t); err != nil {
+			return err
+		}
+	}
+
+	return validateStick3Look(e.Page, e.Scene, e.Color, e.Dimmer, e.Speed)
+}
+
+// validateStick3Look checks the fields schedule entries and presets use to
+// say what the sign shows.
+func validateStick3Look(page string, scene int, color string, dimmer, speed *int) error {
+	if page != "" {
+		if _, err := ParseStickPage(page); err != nil {
+			return err
+		}
+	}
+	if scene != 0 && (scene < 1 || scene > 50) {
+		return fmt.Errorf("scene must be between 1 and 50, got %d", scene)
+	}
+	if color != "" {
+		if _, _, _, err := ParseHexColor(color); err != nil {
+			return err
+		}
+	}
+	for _, p := range []*int{dimmer, speed} {
+		if p != nil && (*p < 0 || *p > 100) {
+			return fmt.Errorf("dimmer and speed must be between 0 and 100")
+		}
+	}
+	return nil
+}
+
+// usesSun reports whether the entry's window depends on sunrise/sunset, and
+// so needs a location.
+func (e *Stick3ScheduleEntry) usesSun() bool {
+	for _, t := range []string{e.startOrDefault(), e.endOrDefault()} {
+		if spec, err := parseSunTime(t); err == nil && spec.event != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ---- dates
+
+type stick3Date struct {
+	year, month, day int // year 0 = every year
+}
+
+func parseStick3Date(s string) (stick3Date, error) {
+	if s == "" {
+		return stick3Date{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return stick3Date{t.Year(), int(t.Month()), t.Day()}, nil
+	}
+	if t, err := time.Parse("01-02", s); err == nil {
+		return stick3Date{0, int(t.Month()), t.Day()}, nil
+	}
+	return stick3Date{}, fmt.Errorf("date must be MM-DD or YYYY-MM-DD, got %q", s)
+}
+
+// key orders dates; every-year dates order within the year.
+func (d stick3Date) key() int {
+	return d.year*10000 + d.month*100 + d.day
+}
+
+func dateKey(day time.Time, withYear bool) int {
+	k := int(day.Month())*100 + day.Day()
+	if withYear {
+		k += day.Year() * 10000
+	}
+	return k
+}
+
+func (e *Stick3ScheduleEntry) inDateRange(day time.Time) bool {
+	from, _ := parseStick3Date(e.From)
+	to, _ := parseStick3Date(e.To)
+
+	switch {
+	case e.From == "" && e.To == "":
+		return true
+	case e.To == "":
+		return dateKey(day, from.year != 0) >= from.key()
+	case e.From == "":
+		return dateKey(day, to.year != 0) <= to.key()
+	}
+
+	k := dateKey(day, from.year != 0)
+	if from.key() <= to.key() {
+		return k >= from.key() && k <= to.key()
+	}
+	// An every-year range over new year, like 12-15 to 01-05.
+	return k >= from.key() || k <= to.key()
+}
+
+var stick3Weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) >= 3 {
+		if d, ok := stick3Weekdays[s[:3]]; ok {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", s)
+}
+
+// nthWeekday returns the day of month of the nth (1-based; -1 = last)
+// weekday of a month.
+func nthWeekday(year int, month time.Month, wd time.Weekday, n int) int {
+	if n < 0 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.Day() - (int(last.Weekday())-int(wd)+7)%7
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return 1 + (int(wd)-int(first.Weekday())+7)%7 + 7*(n-1)
+}
+
+// stick3BuiltinHolidays are the US holidays a schedule can name.
+var stick3BuiltinHolidays = map[string]func(day time.Time) bool{
+	"new_years_day":    fixedHoliday(time.January, 1),
+	"valentines_day":   fixedHoliday(time.February, 14),
+	"st_patricks_day":  fixedHoliday(time.March, 17),
+	"memorial_day":     floatingHoliday(time.May, time.Monday, -1),
+	"independence_day": fixedHoliday(time.July, 4),
+	"labor_day":        floatingHoliday(time.September, time.Monday, 1),
+	"halloween":        fixedHoliday(time.October, 31),
+	"thanksgiving":     floatingHoliday(time.November, time.Thursday, 4),
+	"christmas_eve":    fixedHoliday(time.December, 24),
+	"christmas":        fixedHoliday(time.December, 25),
+	"new_years_eve":    fixedHoliday(time.December, 31),
+}
+
+func fixedHoliday(month time.Month, day int) func(time.Time) bool {
+	return func(t time.Time) bool {
+		return t.Month() == month && t.Day() == day
+	}
+}
+
+func floatingHoliday(month time.Month, wd time.Weekday, n int) func(time.Time) bool {
+	return func(t time.Time) bool {
+		return t.Month() == month && t.Day() == nthWeekday(t.Year(), month, wd, n)
+	}
+}
+
+func isHoliday(name string, day time.Time, holidays map[string][]string) bool {
+	if dates, ok := holidays[name]; ok {
+		for _, s := range dates {
+			d, err := parseStick3Date(s)
+			if err != nil {
+				continue
+			}
+			if dateKey(day, d.year != 0) == d.key() {
+				return true
+			}
+		}
+		return false
+	}
+	if f, ok := stick3BuiltinHolidays[name]; ok {
+		return f(day)
+	}
+	return false
+}
+
+// matchesDay reports whether the entry's date filters allow a window starting
+// on day.
+func (e *Stick3ScheduleEntry) matchesDay(day time.Time, holidays map[string][]string) bool {
+	if !e.inDateRange(day) {
+		return false
+	}
+
+	if len(e.Weekdays) > 0 {
+		ok := false
+		for _, s := range e.Weekdays {
+			if wd, err := parseWeekday(s); err == nil && wd == day.Weekday() {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(e.Holidays) > 0 {
+		ok := false
+		for _, h := range e.Holidays {
+			if isHoliday(h, day, holidays) {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// window returns when the entry's window starting on day opens and closes.
+func (e *Stick3ScheduleEntry) window(day time.Time, lat, lng float64) (start, end time.Time, err error) {
+	startSpec, _ := parseSunTime(e.startOrDefault())
+	endSpec, _ := parseSunTime(e.endOrDefault())
+	return sunWindow(day, startSpec, endSpec, lat, lng)
+}
+
+// activeStick3Entry returns the index of the first entry whose window
+// contains now, or -1. Windows can run past midnight, so windows starting
+// yesterday count too. In polar day or night sun-relative windows don't
+// resolve, and those entries are skipped.
+func activeStick3Entry(entries []Stick3ScheduleEntry, holidays map[string][]string, now time.Time, loc *time.Location, lat, lng float64) int {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	for i := range entries {
+		e := &entries[i]
+		for _, day := range []time.Time{today, today.AddDate(0, 0, -1)} {
+			if !e.matchesDay(day, holidays) {
+				continue
+			}
+			start, end, err := e.window(day, lat, lng)
+			if err != nil {
+				continue
+			}
+			if !now.Before(start) && now.Before(end) {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,179 @@
+package verhboat
+
+import (
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestStick3Holidays(t *testing.T) {
+	test.That(t, nthWeekday(2026, time.November, time.Thursday, 4), test.ShouldEqual, 26)
+	test.That(t, nthWeekday(2026, time.May, time.Monday, -1), test.ShouldEqual, 25)
+	test.That(t, nthWeekday(2026, time.September, time.Monday, 1), test.ShouldEqual, 7)
+	test.That(t, nthWeekday(2027, time.November, time.Thursday, 4), test.ShouldEqual, 25)
+
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+	custom := map[string][]string{"game_days": {"2026-09-13", "10-04"}}
+
+	test.That(t, isHoliday("thanksgiving", day(time.November, 26), nil), test.ShouldBeTrue)
+	test.That(t, isHoliday("thanksgiving", day(time.November, 19), nil), test.ShouldBeFalse)
+	test.That(t, isHoliday("independence_day", day(time.July, 4), nil), test.ShouldBeTrue)
+	test.That(t, isHoliday("game_days", day(time.September, 13), custom), test.ShouldBeTrue)
+	test.That(t, isHoliday("game_days", day(time.October, 4), custom), test.ShouldBeTrue)
+	test.That(t, isHoliday("game_days", day(time.September, 14), custom), test.ShouldBeFalse)
+	test.That(t, isHoliday("bogus", day(time.July, 4), custom), test.ShouldBeFalse)
+}
+
+func TestStick3TimeSpecs(t *testing.T) {
+	spec, err := parseSunTime("sunset-1h")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, spec, test.ShouldResemble, sunTimeSpec{event: "sunset", offset: -time.Hour})
+
+	spec, err = parseSunTime("Sunrise + 30m")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, spec, test.ShouldResemble, sunTimeSpec{event: "sunrise", offset: 30 * time.Minute})
+
+	spec, err = parseSunTime("civil_dusk+15m")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, spec, test.ShouldResemble, sunTimeSpec{event: SunEventCivilDusk, offset: 15 * time.Minute})
+
+	spec, err = parseSunTime("solar_noon+2h")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, spec, test.ShouldResemble, sunTimeSpec{event: SunEventSolarNoon, offset: 2 * time.Hour})
+
+	spec, err = parseSunTime("21:15")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, spec, test.ShouldResemble, sunTimeSpec{clock: 21*60 + 15})
+
+	for _, bad := range []string{"dusk", "sunset-1y", "25:00", ""} {
+		_, err = parseSunTime(bad)
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+func TestStick3DateRanges(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	winter := Stick3ScheduleEntry{From: "12-15", To: "01-05"}
+	test.That(t, winter.inDateRange(day(2026, time.December, 20)), test.ShouldBeTrue)
+	test.That(t, winter.inDateRange(day(2027, time.January, 5)), test.ShouldBeTrue)
+	test.That(t, winter.inDateRange(day(2027, time.January, 6)), test.ShouldBeFalse)
+
+	summer := Stick3ScheduleEntry{From: "2026-06-01", To: "2026-08-31"}
+	test.That(t, summer.inDateRange(day(2026, time.July, 1)), test.ShouldBeTrue)
+	test.That(t, summer.inDateRange(day(2027, time.July, 1)), test.ShouldBeFalse)
+
+	from := Stick3ScheduleEntry{From: "2026-06-01"}
+	test.That(t, from.inDateRange(day(2030, time.January, 1)), test.ShouldBeTrue)
+	test.That(t, from.inDateRange(day(2026, time.May, 31)), test.ShouldBeFalse)
+
+	test.That(t, (&Stick3ScheduleEntry{From: "12-15", To: "2027-01-05"}).validate(nil), test.ShouldNotBeNil)
+	test.That(t, (&Stick3ScheduleEntry{Weekdays: []string{"funday"}}).validate(nil), test.ShouldNotBeNil)
+	test.That(t, (&Stick3ScheduleEntry{Holidays: []string{"game_days"}}).validate(nil), test.ShouldNotBeNil)
+	test.That(t, (&Stick3ScheduleEntry{Holidays: []string{"game_days"}}).validate(map[string][]string{"game_days": nil}), test.ShouldBeNil)
+}
+
+func TestActiveStick3Entry(t *testing.T) {
+	lat, lng := 40.7128, -74.0060
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	holidays := map[string][]string{"game_days": {"2026-07-05", "2026-09-13"}}
+	entries := []Stick3ScheduleEntry{
+		{Name: "july4", Holidays: []string{"independence_day"}, Color: "FF0000"},
+		{Name: "game", Holidays: []string{"game_days"}, Weekdays: []string{"sun"}, Start: "12:00", End: "23:00"},
+		{Name: "winter", From: "12-15", To: "01-05", End: "23:30"},
+		{Name: "quiet", Weekdays: []string{"mon"}, Off: true},
+		{Name: "nightly"},
+	}
+
+	at := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, ny) }
+	for _, tc := range []struct {
+		now  time.Time
+		want int
+	}{
+		{at(2026, time.July, 4, 22, 0), 0},  // July 4th evening
+		{at(2026, time.July, 5, 2, 0), 0},   // still the July 4th window after midnight
+		{at(2026, time.July, 4, 15, 0), -1}, // daytime
+		{at(2026, time.July, 5, 14, 0), 1},  // a Sunday game day
+		{at(2026, time.September, 13, 12, 30), 1},
+		{at(2026, time.September, 20, 14, 0), -1}, // a Sunday, not a game day
+		{at(2026, time.December, 31, 22, 0), 2},
+		{at(2026, time.December, 31, 23, 45), 4}, // winter ends at 23:30; nightly takes over
+		{at(2026, time.March, 9, 22, 0), 3},      // Monday
+		{at(2026, time.March, 10, 22, 0), 4},
+		{at(2026, time.March, 10, 12, 0), -1},
+	} {
+		got := activeStick3Entry(entries, holidays, tc.now, ny, lat, lng)
+		test.That(t, got, test.ShouldEqual, tc.want)
+	}
+
+	// Polar summer: sunset never comes, so sun windows never open.
+	test.That(t, activeStick3Entry(entries[4:], nil, at(2026, time.June, 21, 23, 0), ny, 80, 0), test.ShouldEqual, -1)
+}
+
+func TestNicolaudieStick3ScheduleConfig(t *testing.T) {
+	conf := &NicolaudieStick3Config{
+		IP:       "192.168.1.60",
+		Timezone: "America/New_York",
+		Schedule: []Stick3ScheduleEntry{{Name: "evening", Start: "18:00", End: "23:00", Color: "00FF00"}},
+	}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// Sun-relative windows need a GPS.
+	conf.Schedule = append(conf.Schedule, Stick3ScheduleEntry{Name: "night"})
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.MovementSensor = "gps"
+	deps, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"gps"})
+
+	conf.Holidays = map[string][]string{"game_days": {"13-45"}}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.Holidays = nil
+
+	conf.Timezone = "gps"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	conf.MovementSensor = ""
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.MovementSensor = "gps"
+
+	conf.Schedule[0].Dimmer = new(int)
+	*conf.Schedule[0].Dimmer = 150
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestNicolaudieStick3OnRulesConfig(t *testing.T) {
+	conf := &NicolaudieStick3Config{IP: "192.168.1.60", OnAt: "18:00", OffAt: "23:30"}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// Without a GPS, only clock times work.
+	conf.OnAt = ""
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.MovementSensor = "gps"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	conf.OnAt = "dusk"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.OnAt = "nautical_dusk-10m"
+	conf.OffAfterHours = -1
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.OffAfterHours = 4.5
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	rules, err := conf.onRules()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rules.offAfter, test.ShouldEqual, 4*time.Hour+30*time.Minute)
+}
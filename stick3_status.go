@@ -0,0 +1,204 @@
+package verhboat
+
+// STICK-DE3 status readback and discovery.
+//
+// Quick triggers are fire-and-forget, so on their own we only know what we
+// last sent. This is speculative: Nicolaudie doesn't document a status
+// query, and the opcode (stickStatusOpcode) and the reply layout here are
+// guesses modeled on the quick-trigger packet, not taken from a spec or a
+// capture. The query is the quick-trigger header with that opcode and
+// nothing else; the reply is expected in the quick-trigger layout, giving
+// the scene it's playing, whether that's on, and its dimmer, speed and
+// color. Sent to the broadcast address it finds the controllers on the LAN.
+// Controllers that don't answer are simply not found, and nothing depends
+// on an answer; the component only sends the query with status_readback.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	stickStatusOpcode   = uint16(110)
+	stickDeviceIDPrefix = "Stick_"
+
+	// StickBroadcastAddress is where discovery looks by default.
+	StickBroadcastAddress = "255.255.255.255"
+)
+
+// ErrStickNoStatus is returned when a controller doesn't answer a status
+// query, either because it's unreachable or its firmware doesn't support
+// readback.
+var ErrStickNoStatus = errors.New("no status reply from the STICK")
+
+// StickStatus is a controller's answer to a status query.
+type StickStatus struct {
+	Address  string // where the reply came from, "ip:port"
+	DeviceID string // e.g. "Stick_3A"
+	Scene    uint16 // absolute scene number
+	Command  StickCommand
+	Dimmer   uint16
+	Speed    uint16
+	Red      byte
+	Green    byte
+	Blue     byte
+}
+
+// On is whether the scene is playing.
+func (s StickStatus) On() bool {
+	return s.Command == StickSceneOn
+}
+
+// PageScene splits the absolute scene into a zero-based page and a one-based
+// scene, the inverse of StickAbsoluteScene.
+func (s StickStatus) PageScene() (page, scene int) {
+	if s.Scene == 0 {
+		return 0, 0
+	}
+	return int(s.Scene-1) / 50, int(s.Scene-1)%50 + 1
+}
+
+// Color is the reported color as RRGGBB hex.
+func (s StickStatus) Color() string {
+	return fmt.Sprintf("%02X%02X%02X", s.Red, s.Green, s.Blue)
+}
+
+// BuildStickStatusQuery builds a status query packet.
+func BuildStickStatusQuery() []byte {
+	packet := make([]byte, 10)
+	copy(packet[0:8], []byte(stickDeviceID))
+	binary.LittleEndian.PutUint16(packet[8:10], stickStatusOpcode)
+	return packet
+}
+
+// ParseStickStatus parses a status reply; Address is left empty.
+func ParseStickStatus(packet []byte) (StickStatus, error) {
+	if len(packet) < stickPacketSize {
+		return StickStatus{}, fmt.Errorf("status reply too short: %d bytes", len(packet))
+	}
+	if !strings.HasPrefix(string(packet[0:8]), stickDeviceIDPrefix) {
+		return StickStatus{}, fmt.Errorf("status reply has unknown device id % X", packet[0:8])
+	}
+	if op := binary.LittleEndian.Uint16(packet[8:10]); op != stickStatusOpcode {
+		return StickStatus{}, fmt.Errorf("not a status reply: opcode %d", op)
+	}
+
+	return StickStatus{
+		DeviceID: strings.TrimRight(string(packet[0:8]), "\x00"),
+		Scene:    binary.LittleEndian.Uint16(packet[10:12]),
+		Command:  StickCommand(packet[13]),
+		Dimmer:   binary.LittleEndian.Uint16(packet[14:16]),
+		Speed:    binary.LittleEndian.Uint16(packet[16:18]),
+		Red:      packet[20],
+		Green:    packet[21],
+		Blue:     packet[22],
+	}, nil
+}
+
+// BuildStickStatusReply builds the reply a controller sends for status; the
+// counterpart of ParseStickStatus.
+func BuildStickStatusReply(status StickStatus) []byte {
+	packet := BuildStickQuickTrigger(StickQuickTrigger{
+		Scene:   status.Scene,
+		Command: status.Command,
+		Dimmer:  status.Dimmer,
+		Speed:   status.Speed,
+		Red:     status.Red,
+		Green:   status.Green,
+		Blue:    status.Blue,
+	})
+	binary.LittleEndian.PutUint16(packet[8:10], stickStatusOpcode)
+	return packet
+}
+
+// stickStatusQuery sends a status query to dest and passes each valid reply
+// to reply until it returns true or wait is up.
+func stickStatusQuery(dest *net.UDPAddr, wait time.Duration, reply func(StickStatus) bool) error {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return fmt.Errorf("open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(wait)); err != nil {
+		return fmt.Errorf("set UDP deadline: %w", err)
+	}
+	if _, err := conn.WriteToUDP(BuildStickStatusQuery(), dest); err != nil {
+		return fmt.Errorf("send status query to %s: %w", dest, err)
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return fmt.Errorf("read status reply: %w", err)
+		}
+		status, err := ParseStickStatus(buf[:n])
+		if err != nil {
+			continue // our own broadcast, or something else on the port
+		}
+		status.Address = from.String()
+		if reply(status) {
+			return nil
+		}
+	}
+}
+
+// QueryStatus asks the controller what it's showing. It returns
+// ErrStickNoStatus if there's no answer within the client's timeout.
+func (c *Stick3Client) QueryStatus() (StickStatus, error) {
+	dest, err := c.address.resolve()
+	if err != nil {
+		return StickStatus{}, err
+	}
+
+	// Sent to a broadcast address, the first controller to answer will do.
+	anyone := stickIsBroadcast(dest)
+	var found *StickStatus
+	err = stickStatusQuery(dest, c.timeout, func(s StickStatus) bool {
+		if from, err := net.ResolveUDPAddr("udp", s.Address); !anyone && (err != nil || !from.IP.Equal(dest.IP)) {
+			return false
+		}
+		found = &s
+		return true
+	})
+	if err != nil {
+		return StickStatus{}, err
+	}
+	if found == nil {
+		return StickStatus{}, ErrStickNoStatus
+	}
+	if c.debug {
+		fmt.Printf("status from %s: scene %d command %d dimmer %d color %s\n", found.Address, found.Scene, found.Command, found.Dimmer, found.Color())
+	}
+	return *found, nil
+}
+
+// DiscoverStick3 sends a status query to address (usually
+// StickBroadcastAddress or a subnet's broadcast address) on port and returns
+// every controller that answers within wait, once each.
+func DiscoverStick3(address string, port int, wait time.Duration) ([]StickStatus, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid discovery address %q", address)
+	}
+
+	seen := map[string]bool{}
+	var found []StickStatus
+	err := stickStatusQuery(&net.UDPAddr{IP: ip, Port: port}, wait, func(s StickStatus) bool {
+		if !seen[s.Address] {
+			seen[s.Address] = true
+			found = append(found, s)
+		}
+		return false
+	})
+	return found, err
+}
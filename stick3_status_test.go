@@ -0,0 +1,148 @@
+package verhboat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestStickStatusPacket(t *testing.T) {
+	want := StickStatus{DeviceID: stickDeviceID, Scene: 53, Command: StickSceneOn, Dimmer: 127, Speed: 64, Red: 0x0B, Green: 0x22, Blue: 0x65}
+	got, err := ParseStickStatus(BuildStickStatusReply(want))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, got, test.ShouldResemble, want)
+	test.That(t, got.On(), test.ShouldBeTrue)
+	test.That(t, got.Color(), test.ShouldEqual, "0B2265")
+
+	page, scene := got.PageScene()
+	test.That(t, page, test.ShouldEqual, 1)
+	test.That(t, scene, test.ShouldEqual, 3)
+	abs, err := StickAbsoluteScene(page, scene)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, abs, test.ShouldEqual, 53)
+
+	_, err = ParseStickStatus(BuildStickStatusQuery())
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = ParseStickStatus(BuildStickQuickTrigger(StickQuickTrigger{Scene: 1, Command: StickSceneOn}))
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = ParseStickStatus(append([]byte("Nope_3A\x00"), BuildStickStatusReply(want)[8:]...))
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStickStatusQuery(t *testing.T) {
+	f := newTestFakeStick3(t)
+
+	client, err := NewStick3Client(f.Host(), f.Port(), 300*time.Millisecond, false)
+	test.That(t, err, test.ShouldBeNil)
+
+	// Older firmware doesn't answer.
+	f.SetStatusReplies(false)
+	_, err = client.QueryStatus()
+	test.That(t, errors.Is(err, ErrStickNoStatus), test.ShouldBeTrue)
+	found, err := DiscoverStick3(f.Host(), f.Port(), 300*time.Millisecond)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, found, test.ShouldBeEmpty)
+
+	f.SetStatusReplies(true)
+	test.That(t, client.SceneOff(0, 2), test.ShouldBeNil)
+	test.That(t, f.WaitForTriggers(1, time.Second), test.ShouldBeNil)
+	status, err := client.QueryStatus()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status.Scene, test.ShouldEqual, 2)
+	test.That(t, status.On(), test.ShouldBeFalse)
+	test.That(t, status.Address, test.ShouldEqual, f.Addr())
+
+	found, err = DiscoverStick3(f.Host(), f.Port(), 300*time.Millisecond)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(found), test.ShouldEqual, 1)
+	test.That(t, found[0].DeviceID, test.ShouldEqual, stickDeviceID)
+
+	_, err = DiscoverStick3("not-an-ip", f.Port(), time.Millisecond)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStick3Reassert(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFakeStick3(t)
+
+	conf := &NicolaudieStick3Config{IP: f.Host(), Port: f.Port(), Color: "FF0000", ReassertSeconds: -1, StatusReadback: true}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	res, err := newNicolaudieStick3(ctx, nil, resource.Config{
+		Name:                "sign",
+		API:                 generic.API,
+		ConvertedAttributes: conf,
+	}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer res.Close(ctx)
+	s := res.(*NicolaudieStick3)
+	s.client.timeout = 200 * time.Millisecond
+
+	// panel changes the controller behind the component's back, as its own
+	// panel or a power cycle would.
+	panel, err := NewStick3Client(f.Host(), f.Port(), time.Second, false)
+	test.That(t, err, test.ShouldBeNil)
+
+	// Nothing's re-sent until the sign has been turned on or off.
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, 0), test.ShouldBeEmpty)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "on"})
+	test.That(t, err, test.ShouldBeNil)
+
+	// Without a status reply the state is re-sent every time.
+	f.SetStatusReplies(false)
+	n := len(quietTriggers(t, f, 0))
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{1, 0, StickSceneOn, 0}, {1, 0, StickColorSet, 0}})
+
+	// Not if the controller says it's already showing it.
+	f.SetStatusReplies(true)
+	n = len(f.Triggers())
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldBeEmpty)
+
+	// A controller switched off from its panel is put right.
+	test.That(t, panel.SceneOff(0, 1), test.ShouldBeNil)
+	n = len(quietTriggers(t, f, 0))
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{1, 0, StickSceneOn, 0}, {1, 0, StickColorSet, 0}})
+	test.That(t, f.Scene(0, 1).On, test.ShouldBeTrue)
+
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["on"], test.ShouldBeTrue)
+	test.That(t, status["controller_on"], test.ShouldBeFalse)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "off"})
+	test.That(t, err, test.ShouldBeNil)
+	quietTriggers(t, f, 0)
+	test.That(t, panel.SceneOn(0, 1), test.ShouldBeNil)
+	n = len(quietTriggers(t, f, 0))
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{1, 0, StickSceneOff, 0}})
+
+	test.That(t, panel.SetDimmerRaw(0, 1, 127), test.ShouldBeNil)
+	quietTriggers(t, f, 0)
+	status, err = s.DoCommand(ctx, map[string]interface{}{"command": "read_status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["controller_on"], test.ShouldBeFalse)
+	test.That(t, status["controller_scene"], test.ShouldEqual, 1)
+	test.That(t, status["controller_dimmer"], test.ShouldEqual, 100)
+
+	// Without status_readback the controller isn't asked: the state is
+	// re-sent even though it agrees, and read_status is refused.
+	s.conf.StatusReadback = false
+	n = len(f.Triggers())
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{1, 0, StickSceneOff, 0}})
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "read_status"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,167 @@
+package verhboat
+
+// erh:verhboat:nicolaudie-stick3-switch is the nicolaudie-stick3 sign as a
+// switch, so the helm UI, the Viam app and other automations can treat it
+// like any other light. Position 0 is off, 1 is on with the configured look,
+// and each of the config's presets follows. DoCommand is the same as
+// nicolaudie-stick3's for everything else.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var NicolaudieStick3SwitchModel = NamespaceFamily.WithModel("nicolaudie-stick3-switch")
+
+func init() {
+	resource.RegisterComponent(
+		toggleswitch.API,
+		NicolaudieStick3SwitchModel,
+		resource.Registration[toggleswitch.Switch, *NicolaudieStick3Config]{
+			Constructor: newNicolaudieStick3Switch,
+		})
+}
+
+// Stick3Preset is a named look for the sign; unset fields use the
+// component's config.
+type Stick3Preset struct {
+	Name   string `json:"name"`
+	Page   string `json:"page,omitempty"`
+	Scene  int    `json:"scene,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Dimmer *int   `json:"dimmer,omitempty"` // percent
+	Speed  *int   `json:"speed,omitempty"`  // percent
+}
+
+func (p *Stick3Preset) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("preset needs a name")
+	}
+	if p.Name == "off" || p.Name == "on" {
+		return fmt.Errorf("preset can't be called %q", p.Name)
+	}
+	if err := validateStick3Look(p.Page, p.Scene, p.Color, p.Dimmer, p.Speed); err != nil {
+		return fmt.Errorf("preset %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+func newNicolaudieStick3Switch(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
+	res, err := newNicolaudieStick3(ctx, deps, rawConf, logger)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*NicolaudieStick3), nil
+}
+
+// positionNames are "off", "on", then the presets.
+func (s *NicolaudieStick3) positionNames() []string {
+	names := []string{"off", "on"}
+	for _, p := range s.conf.Presets {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// positionLook is what position pos shows: 1 for the configured look, 2 on
+// for the presets.
+func (s *NicolaudieStick3) positionLook(pos int) stick3Look {
+	if pos < 2 {
+		return s.base
+	}
+	p := &s.conf.Presets[pos-2]
+	return s.base.with(p.Page, p.Scene, p.Color, p.Dimmer, p.Speed)
+}
+
+// setPositionLocked turns the sign off (0) or on showing position pos, as a
+// manual override of the schedule (see stick3_override.go).
+func (s *NicolaudieStick3) setPositionLocked(pos int, until string, at time.Time) error {
+	var err error
+	if pos == 0 {
+		err = s.setOnLocked(false)
+	} else {
+		err = s.showLocked(s.positionLook(pos))
+	}
+	if err != nil {
+		return err
+	}
+	preset := ""
+	if pos >= 2 {
+		preset = s.conf.Presets[pos-2].Name
+	}
+	s.overrideLocked(pos != 0, preset, until, at)
+	return nil
+}
+
+// positionLocked is 0 if the sign is off, the first preset that matches what
+// it's showing, and otherwise 1.
+func (s *NicolaudieStick3) positionLocked() int {
+	if !s.on {
+		return 0
+	}
+	for i := range s.conf.Presets {
+		if s.positionLook(i + 2).equal(s.look) {
+			return i + 2
+		}
+	}
+	return 1
+}
+
+// positionByName finds a position from its name in positionNames.
+func (s *NicolaudieStick3) positionByName(name string) (int, error) {
+	for i, n := range s.positionNames() {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown preset %q", name)
+}
+
+// equal is whether two looks show the same thing.
+func (look stick3Look) equal(other stick3Look) bool {
+	samePercent := func(a, b *int) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+	}
+	return look.page == other.page && look.scene == other.scene &&
+		look.red == other.red && look.grn == other.grn && look.blu == other.blu &&
+		samePercent(look.dimmer, other.dimmer) && samePercent(look.speed, other.speed)
+}
+
+// SetPosition turns the sign off (0), on (1) or on showing a preset (2 on),
+// until the schedule next changes or extra's "until", as for DoCommand.
+func (s *NicolaudieStick3) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	if int(position) >= len(s.positionNames()) {
+		return fmt.Errorf("position %d out of range, the sign has %d", position, len(s.positionNames()))
+	}
+
+	loc, err := s.untilLocation(ctx, extra)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, at, err := parseStick3Until(extra, s.now(), loc)
+	if err != nil {
+		return err
+	}
+	return s.setPositionLocked(int(position), until, at)
+}
+
+// GetPosition is 0 if the sign is off, the preset it's showing, or 1 if it's
+// showing something else (the configured look, a schedule entry, a color set
+// by hand, ...).
+func (s *NicolaudieStick3) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint32(s.positionLocked()), nil
+}
+
+func (s *NicolaudieStick3) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
+	names := s.positionNames()
+	return uint32(len(names)), names, nil
+}
@@ -0,0 +1,107 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestStick3SwitchConfig(t *testing.T) {
+	dim := 30
+	good := &NicolaudieStick3Config{IP: "10.0.0.5", Presets: []Stick3Preset{
+		{Name: "party", Scene: 4},
+		{Name: "quiet", Color: "FF8000", Dimmer: &dim},
+	}}
+	_, _, err := good.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	tooBright := 150
+	for _, presets := range [][]Stick3Preset{
+		{{}},
+		{{Name: "off"}},
+		{{Name: "party", Scene: 99}},
+		{{Name: "party", Color: "pink"}},
+		{{Name: "party", Dimmer: &tooBright}},
+		{{Name: "party"}, {Name: "party"}},
+	} {
+		conf := &NicolaudieStick3Config{IP: "10.0.0.5", Presets: presets}
+		_, _, err := conf.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+func TestStick3Switch(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFakeStick3(t)
+
+	dim := 30
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Color: "FFFFFF", ReassertSeconds: -1,
+		Presets: []Stick3Preset{
+			{Name: "party", Page: "B", Scene: 4},
+			{Name: "quiet", Color: "FF8000", Dimmer: &dim},
+		},
+	}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	sw, err := newNicolaudieStick3Switch(ctx, nil, resource.Config{
+		Name:                "sign",
+		API:                 toggleswitch.API,
+		ConvertedAttributes: conf,
+	}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer sw.Close(ctx)
+
+	n, names, err := sw.GetNumberOfPositions(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 4)
+	test.That(t, names, test.ShouldResemble, []string{"off", "on", "party", "quiet"})
+
+	pos, err := sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+
+	test.That(t, sw.SetPosition(ctx, 3, nil), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, 0), test.ShouldResemble, []stickTrigger{
+		{1, 0, StickSceneOn, 0}, {1, 0, StickColorSet, 0}, {1, 0, StickDimmerSet, 38},
+	})
+	pos, err = sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 3)
+
+	// Switching presets switches scenes.
+	mark := len(f.Triggers())
+	test.That(t, sw.SetPosition(ctx, 2, nil), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, mark), test.ShouldResemble, []stickTrigger{
+		{1, 0, StickSceneOff, 0}, {54, 0, StickSceneOn, 0}, {54, 0, StickColorSet, 0},
+	})
+
+	// Changing the look by hand leaves the presets: position 1.
+	_, err = sw.DoCommand(ctx, map[string]interface{}{"command": "set_color", "color": "00FF00"})
+	test.That(t, err, test.ShouldBeNil)
+	pos, err = sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 1)
+
+	status, err := sw.DoCommand(ctx, map[string]interface{}{"command": "preset", "preset": "quiet"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["preset"], test.ShouldEqual, "quiet")
+	status, err = sw.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["preset"], test.ShouldEqual, "quiet")
+	test.That(t, status["dimmer"], test.ShouldEqual, 30)
+
+	test.That(t, sw.SetPosition(ctx, 0, nil), test.ShouldBeNil)
+	pos, err = sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+
+	test.That(t, sw.SetPosition(ctx, 4, nil), test.ShouldNotBeNil)
+	_, err = sw.DoCommand(ctx, map[string]interface{}{"command": "preset", "preset": "disco"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
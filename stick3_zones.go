@@ -0,0 +1,185 @@
+package verhboat
+
+// Zones: other scenes on the same STICK-DE3 as the sign, such as underwater
+// lights or cockpit strips, each switched, colored and dimmed by name from
+// DoCommand. The sign itself is what the schedule drives; zones are only
+// changed by hand. Blackout is the controller's master blackout, so it darkens
+// the sign and every zone together.
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var stick3ZoneNameRE = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Stick3Zone is a named scene on the controller.
+type Stick3Zone struct {
+	// Name addresses the zone in DoCommand, e.g. "underwater".
+	Name string `json:"name"`
+
+	// Page and Scene are as for the sign; the defaults are page A, scene 1.
+	Page  string `json:"page,omitempty"`
+	Scene int    `json:"scene,omitempty"`
+
+	// ZoneSyncID is the STICK zone synchronization ID sent with the zone's
+	// triggers, 0-255.
+	ZoneSyncID int `json:"zone_sync_id,omitempty"`
+
+	// Color is the hex color (RRGGBB) shown when the zone is turned on.
+	Color string `json:"color,omitempty"`
+}
+
+func (z *Stick3Zone) validate() error {
+	if !stick3ZoneNameRE.MatchString(z.Name) {
+		return fmt.Errorf("zone needs a name of lowercase letters, digits, '-' and '_', got %q", z.Name)
+	}
+	if z.Page != "" {
+		if _, err := ParseStickPage(z.Page); err != nil {
+			return fmt.Errorf("zone %s: %w", z.Name, err)
+		}
+	}
+	if z.Scene != 0 && (z.Scene < 1 || z.Scene > 50) {
+		return fmt.Errorf("zone %s: scene must be between 1 and 50, got %d", z.Name, z.Scene)
+	}
+	if err := validateZoneSyncID(z.ZoneSyncID); err != nil {
+		return fmt.Errorf("zone %s: %w", z.Name, err)
+	}
+	if z.Color != "" {
+		if _, _, _, err := ParseHexColor(z.Color); err != nil {
+			return fmt.Errorf("zone %s: %w", z.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateZoneSyncID(id int) error {
+	if id < 0 || id > 255 {
+		return fmt.Errorf("zone_sync_id must be between 0 and 255, got %d", id)
+	}
+	return nil
+}
+
+// stick3ZoneState is a zone's configuration and what it's showing.
+type stick3ZoneState struct {
+	name     string
+	client   *Stick3Client // stamps the zone's sync ID
+	look     stick3Look
+	on       bool
+	asserted bool // whether on has been sent yet
+}
+
+func newStick3ZoneState(z *Stick3Zone, client *Stick3Client) *stick3ZoneState {
+	look := stick3Look{scene: stick3DefaultScene}
+	if z.Page != "" {
+		look.page, _ = ParseStickPage(z.Page)
+	}
+	if z.Scene != 0 {
+		look.scene = z.Scene
+	}
+	if z.Color != "" {
+		look.red, look.grn, look.blu, _ = ParseHexColor(z.Color)
+	}
+	return &stick3ZoneState{
+		name:   z.Name,
+		client: client.WithZone(byte(z.ZoneSyncID)),
+		look:   look,
+	}
+}
+
+// zoneLocked returns the zone a command names with "zone", or nil for the
+// sign if it doesn't.
+func (s *NicolaudieStick3) zoneLocked(cmd map[string]interface{}) (*stick3ZoneState, error) {
+	v, ok := cmd["zone"]
+	if !ok {
+		return nil, nil
+	}
+	name, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("\"zone\" must be a string")
+	}
+	if name == "" {
+		return nil, nil
+	}
+	z, ok := s.zones[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown zone %q", name)
+	}
+	return z, nil
+}
+
+func (z *stick3ZoneState) setOn(on bool) error {
+	if on {
+		if err := z.look.send(z.client); err != nil {
+			return err
+		}
+	} else if err := z.client.SceneOff(z.look.page, z.look.scene); err != nil {
+		return err
+	}
+	z.on = on
+	z.asserted = true
+	return nil
+}
+
+func (z *stick3ZoneState) setColor(red, grn, blu byte) error {
+	z.look.red, z.look.grn, z.look.blu = red, grn, blu
+	if !z.on {
+		return nil
+	}
+	return z.client.SetColor(z.look.page, z.look.scene, red, grn, blu)
+}
+
+// setScene switches the zone to another scene, as for the sign.
+func (z *stick3ZoneState) setScene(page, scene int) error {
+	if z.on && (page != z.look.page || scene != z.look.scene) {
+		if err := z.client.SceneOff(z.look.page, z.look.scene); err != nil {
+			return err
+		}
+	}
+	z.look.page, z.look.scene = page, scene
+	if !z.on {
+		return nil
+	}
+	return z.setOn(true)
+}
+
+func (z *stick3ZoneState) status() map[string]interface{} {
+	res := map[string]interface{}{
+		"on":    z.on,
+		"color": fmt.Sprintf("%02X%02X%02X", z.look.red, z.look.grn, z.look.blu),
+		"page":  z.look.page,
+		"scene": z.look.scene,
+	}
+	z.look.addLevels(res)
+	return res
+}
+
+// setBlackoutLocked turns the controller's master blackout on or off.
+func (s *NicolaudieStick3) setBlackoutLocked(on bool) error {
+	var err error
+	if on {
+		err = s.controller.BlackoutOn()
+	} else {
+		err = s.controller.BlackoutOff()
+	}
+	if err != nil {
+		return err
+	}
+	s.blackout = on
+	return nil
+}
+
+// reassertZonesLocked re-sends each zone's state. Zones can't be checked
+// with a status query, so this always sends.
+func (s *NicolaudieStick3) reassertZonesLocked() error {
+	for _, name := range s.zoneNames {
+		z := s.zones[name]
+		if !z.asserted {
+			continue
+		}
+		if err := z.setOn(z.on); err != nil {
+			return fmt.Errorf("zone %s: %w", name, err)
+		}
+	}
+	return nil
+}
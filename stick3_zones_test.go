@@ -0,0 +1,118 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestStick3ZonesConfig(t *testing.T) {
+	good := &NicolaudieStick3Config{IP: "10.0.0.5", ZoneSyncID: 1, Zones: []Stick3Zone{
+		{Name: "underwater", Page: "B", Scene: 2, ZoneSyncID: 2, Color: "0000FF"},
+		{Name: "cockpit"},
+	}}
+	_, _, err := good.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	for _, zones := range [][]Stick3Zone{
+		{{Name: ""}},
+		{{Name: "Cockpit Strips"}},
+		{{Name: "a", Scene: 51}},
+		{{Name: "a", Page: "?"}},
+		{{Name: "a", ZoneSyncID: 256}},
+		{{Name: "a", Color: "blue"}},
+		{{Name: "a"}, {Name: "a"}},
+	} {
+		conf := &NicolaudieStick3Config{IP: "10.0.0.5", Zones: zones}
+		_, _, err := conf.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+
+	bad := &NicolaudieStick3Config{IP: "10.0.0.5", ZoneSyncID: -1}
+	_, _, err = bad.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStick3Zones(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFakeStick3(t)
+
+	conf := &NicolaudieStick3Config{
+		IP: f.Host(), Port: f.Port(), Color: "FF0000", ZoneSyncID: 1, ReassertSeconds: -1,
+		Zones: []Stick3Zone{
+			{Name: "underwater", Page: "B", Scene: 2, ZoneSyncID: 2, Color: "0000FF"},
+			{Name: "cockpit", Scene: 3},
+		},
+	}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	res, err := newNicolaudieStick3(ctx, nil, resource.Config{
+		Name:                "sign",
+		API:                 generic.API,
+		ConvertedAttributes: conf,
+	}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer res.Close(ctx)
+	s := res.(*NicolaudieStick3)
+	s.client.timeout = 100 * time.Millisecond
+
+	// A zone's triggers carry its scene and sync ID, and leave the sign alone.
+	resp, err := s.DoCommand(ctx, map[string]interface{}{"command": "on", "zone": "underwater"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["zone"], test.ShouldEqual, "underwater")
+	test.That(t, triggersSince(t, f, 0), test.ShouldResemble, []stickTrigger{{52, 2, StickSceneOn, 0}, {52, 2, StickColorSet, 0}})
+	test.That(t, f.Scene(1, 2).Color(), test.ShouldEqual, "0000FF")
+
+	n := len(f.Triggers())
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "on"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{1, 1, StickSceneOn, 0}, {1, 1, StickColorSet, 0}})
+
+	// Color changes to a zone that's off wait until it's on.
+	n = len(f.Triggers())
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "set_color", "zone": "cockpit", "color": "00FF00"})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "on", "zone": "cockpit"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{3, 0, StickSceneOn, 0}, {3, 0, StickColorSet, 0}})
+	test.That(t, f.Scene(0, 3).Color(), test.ShouldEqual, "00FF00")
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "off", "zone": "bilge"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	zones := status["zones"].(map[string]interface{})
+	test.That(t, zones["cockpit"].(map[string]interface{})["color"], test.ShouldEqual, "00FF00")
+	test.That(t, zones["underwater"].(map[string]interface{})["on"], test.ShouldBeTrue)
+	test.That(t, status["blackout"], test.ShouldBeFalse)
+
+	// Reasserting re-sends the zones too.
+	n = len(f.Triggers())
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{
+		{1, 1, StickSceneOn, 0}, {1, 1, StickColorSet, 0},
+		{52, 2, StickSceneOn, 0}, {52, 2, StickColorSet, 0},
+		{3, 0, StickSceneOn, 0}, {3, 0, StickColorSet, 0},
+	})
+
+	// Blackout darkens the whole controller, and is all that's re-sent
+	// until it's lifted.
+	n = len(f.Triggers())
+	resp, err = s.DoCommand(ctx, map[string]interface{}{"command": "blackout"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["blackout"], test.ShouldBeTrue)
+	test.That(t, s.reassert(), test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{0, 0, StickBlackoutOn, 0}, {0, 0, StickBlackoutOn, 0}})
+
+	n = len(f.Triggers())
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "unblackout"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, triggersSince(t, f, n), test.ShouldResemble, []stickTrigger{{0, 0, StickBlackoutOff, 0}})
+}
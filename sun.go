@@ -0,0 +1,179 @@
+package verhboat
+
+// erh:verhboat:sun reports the sun at the boat's GPS position: today's
+// sunrise, sunset and twilight times, whether it's day, twilight or night,
+// and how long until the next of those changes. Anything that cares about
+// daylight (lights, shades, the anchor light) can depend on it instead of
+// doing its own sun math.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var SunModel = NamespaceFamily.WithModel("sun")
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		SunModel,
+		resource.Registration[sensor.Sensor, *SunConfig]{
+			Constructor: newSun,
+		})
+}
+
+type SunConfig struct {
+	// MovementSensor gives the boat's position.
+	MovementSensor string `json:"movement-sensor"`
+
+	// Timezone for the reported times and for which day's times are
+	// reported; defaults to the machine's, "gps" for the time zone at the
+	// boat's position.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (c *SunConfig) Validate(path string) ([]string, []string, error) {
+	if c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("need a movement-sensor")
+	}
+	if _, err := loadTimezone(c.Timezone); err != nil {
+		return nil, nil, err
+	}
+	return []string{c.MovementSensor}, nil, nil
+}
+
+type Sun struct {
+	resource.AlwaysRebuild
+
+	name     resource.Name
+	movement movementsensor.MovementSensor
+	timezone string
+	loc      *time.Location
+
+	now func() time.Time
+}
+
+func newSun(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	conf, err := resource.NativeConfig[*SunConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := loadTimezone(conf.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sun{name: rawConf.ResourceName(), timezone: conf.Timezone, loc: loc, now: time.Now}
+	s.movement, err = movementsensor.FromDependencies(deps, conf.MovementSensor)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sun) Name() resource.Name {
+	return s.name
+}
+
+func (s *Sun) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (s *Sun) Close(ctx context.Context) error {
+	return nil
+}
+
+// Readings are worked out from the current position on every call, so they
+// follow the boat as it moves.
+func (s *Sun) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	point, _, err := s.movement.Position(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading position: %w", err)
+	}
+	loc := zoneAt(s.timezone, s.loc, point.Lat(), point.Lng())
+	return sunReadings(s.now().In(loc), point.Lat(), point.Lng()), nil
+}
+
+// sunState names where the sun is: "day" while it's up, then civil,
+// nautical and astronomical twilight as it goes down past -6°, -12° and
+// -18°, and "night" below that.
+func sunState(elevation float64) string {
+	switch {
+	case elevation > sunHorizonAltitude:
+		return "day"
+	case elevation > -6:
+		return "civil_twilight"
+	case elevation > -12:
+		return "nautical_twilight"
+	case elevation > -18:
+		return "astronomical_twilight"
+	}
+	return "night"
+}
+
+// nextSunTransition returns the first sun event after now that changes
+// sunState (that is, any but solar noon). ok is false if there isn't one in
+// the next two days, as in polar summer or winter.
+func nextSunTransition(now time.Time, lat, lng float64) (event SunEvent, at time.Time, ok bool) {
+	for offset := -1; offset <= 2; offset++ {
+		day := SunDay(localNoon(now).AddDate(0, 0, offset).UTC(), lat, lng)
+		for e, t := range day.Times {
+			if e == SunEventSolarNoon || !t.After(now) {
+				continue
+			}
+			if !ok || t.Before(at) {
+				event, at, ok = e, t, true
+			}
+		}
+	}
+	return event, at, ok
+}
+
+// localNoon is noon on now's date, in now's location. The sun times want a
+// time within the day, and local noon keeps far-east and far-west longitudes
+// on the right date.
+func localNoon(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, now.Location())
+}
+
+// sunReadings are the readings at now, at lat, lng. Times are RFC3339 in
+// now's location.
+func sunReadings(now time.Time, lat, lng float64) map[string]interface{} {
+	azimuth, elevation := SunPosition(now, lat, lng)
+	state := sunState(elevation)
+
+	res := map[string]interface{}{
+		"latitude":      lat,
+		"longitude":     lng,
+		"sun_azimuth":   azimuth,
+		"sun_elevation": elevation,
+		"state":         state,
+		"is_day":        state == "day",
+	}
+
+	if e, at, ok := nextSunTransition(now, lat, lng); ok {
+		res["next_transition"] = string(e)
+		res["next_transition_time"] = at.In(now.Location()).Format(time.RFC3339)
+		res["minutes_to_next_transition"] = at.Sub(now).Minutes()
+	}
+
+	addSunDayReadings(res, now, lat, lng)
+	return res
+}
+
+// addSunDayReadings adds today's SunEvents, by now's local date, and the day
+// length. Events that don't happen are left out.
+func addSunDayReadings(res map[string]interface{}, now time.Time, lat, lng float64) {
+	day := SunDay(localNoon(now).UTC(), lat, lng)
+	for e, t := range day.Times {
+		res[string(e)] = t.In(now.Location()).Format(time.RFC3339)
+	}
+	res["day_length_minutes"] = day.DayLength.Minutes()
+}
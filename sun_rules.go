@@ -0,0 +1,233 @@
+package verhboat
+
+// Sun-relative on/off rules, shared by the nicolaudie-stick3 sign and
+// sun-switch: times of day that are either a clock time or a sun event plus
+// an offset ("sunset-1h", "civil_dusk+15m", "23:30"), and windows between
+// them.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/latlong"
+)
+
+// gpsTimezone as a configured timezone means the time zone at the GPS
+// position: the one kept ashore there, daylight saving and all, or offshore
+// the nautical time zone.
+const gpsTimezone = "gps"
+
+// loadTimezone loads a configured timezone: the machine's if empty, and UTC
+// for gpsTimezone until the position is known (see zoneAt).
+func loadTimezone(name string) (*time.Location, error) {
+	switch name {
+	case "":
+		return time.Local, nil
+	case gpsTimezone:
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("bad timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// zoneAt is loc, the loaded timezone name, or for gpsTimezone the time zone
+// at lat, lng.
+func zoneAt(name string, loc *time.Location, lat, lng float64) *time.Location {
+	if name == gpsTimezone {
+		return zoneAtPosition(lat, lng)
+	}
+	return loc
+}
+
+// positionZones caches zones loaded by zoneAtPosition, which runs on every
+// schedule evaluation.
+var positionZones sync.Map // IANA name -> *time.Location
+
+// zoneAtPosition looks up the time zone at lat, lng, falling back to the
+// nautical time zone out of sight of land or if the zone can't be loaded.
+func zoneAtPosition(lat, lng float64) *time.Location {
+	name := latlong.LookupZoneName(lat, lng)
+	if name == "" {
+		return nauticalZone(lng)
+	}
+	if loc, ok := positionZones.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nauticalZone(lng)
+	}
+	positionZones.Store(name, loc)
+	return loc
+}
+
+// makeSunOnRules parses on and off times and an off-after limit (0 for
+// none).
+func makeSunOnRules(on, off string, offAfterHours float64) (sunOnRules, error) {
+	if offAfterHours < 0 {
+		return sunOnRules{}, fmt.Errorf("off-after hours can't be negative")
+	}
+	var r sunOnRules
+	var err error
+	if r.on, err = parseSunTime(on); err != nil {
+		return sunOnRules{}, err
+	}
+	if r.off, err = parseSunTime(off); err != nil {
+		return sunOnRules{}, err
+	}
+	r.offAfter = time.Duration(offAfterHours * float64(time.Hour))
+	return r, nil
+}
+
+// sunTimeSpec is a time of day: minutes after midnight, or a sun event
+// plus an offset.
+type sunTimeSpec struct {
+	event  SunEvent // "" for a clock time
+	offset time.Duration
+	clock  int
+}
+
+var sunTimeRE = regexp.MustCompile(`^([a-z_]+)(?:([+-])(\S+))?$`)
+
+func parseSunTime(s string) (sunTimeSpec, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+
+	if m := sunTimeRE.FindStringSubmatch(s); m != nil {
+		event, err := ParseSunEvent(m[1])
+		if err != nil {
+			return sunTimeSpec{}, err
+		}
+		spec := sunTimeSpec{event: event}
+		if m[2] != "" {
+			d, err := time.ParseDuration(m[3])
+			if err != nil {
+				return sunTimeSpec{}, fmt.Errorf("bad offset in %q: %w", s, err)
+			}
+			if m[2] == "-" {
+				d = -d
+			}
+			spec.offset = d
+		}
+		return spec, nil
+	}
+
+	clock, err := parseClock(s)
+	if err != nil {
+		return sunTimeSpec{}, fmt.Errorf("time must be HH:MM or a sun event with an offset like sunset-1h, got %q", s)
+	}
+	return sunTimeSpec{clock: clock}, nil
+}
+
+// resolve returns the time on day (midnight, in the rules' location).
+func (t sunTimeSpec) resolve(day time.Time, lat, lng float64) (time.Time, error) {
+	if t.event == "" {
+		// Not day plus minutes: on a daylight saving change that's an hour off.
+		return time.Date(day.Year(), day.Month(), day.Day(), t.clock/60, t.clock%60, 0, 0, day.Location()), nil
+	}
+
+	// The sun times want a time within the day; local noon keeps far-east
+	// and far-west longitudes on the right date.
+	at, err := SunEventTime(day.Add(12*time.Hour).UTC(), lat, lng, t.event)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return at.Add(t.offset).In(day.Location()), nil
+}
+
+// sunWindow returns when a window from startSpec to endSpec, starting on
+// day, opens and closes. An end before the start is on the next day.
+func sunWindow(day time.Time, startSpec, endSpec sunTimeSpec, lat, lng float64) (start, end time.Time, err error) {
+	start, err = startSpec.resolve(day, lat, lng)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err = endSpec.resolve(day, lat, lng)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !end.After(start) {
+		end, err = endSpec.resolve(day.AddDate(0, 0, 1), lat, lng)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return start, end, nil
+}
+
+// sunOnRules say when something is on: from on until off, or for offAfter
+// if that's sooner.
+type sunOnRules struct {
+	on, off  sunTimeSpec
+	offAfter time.Duration // 0 for no limit
+}
+
+func (r sunOnRules) usesSun() bool {
+	return r.on.event != "" || r.off.event != ""
+}
+
+// desiredOn reports whether rules say on right now, based on the sun times
+// at the given location. Clock times are in loc.
+//
+// If the sun never crosses an event's altitude that day, it's on if it
+// stays dark (polar night) and off if it never gets that dark.
+func desiredOn(now time.Time, rules sunOnRules, loc *time.Location, lat, lng float64) (bool, error) {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	// Last night's window may still be open.
+	for _, day := range []time.Time{today, today.AddDate(0, 0, -1)} {
+		start, end, err := rules.window(day, lat, lng)
+		if err != nil {
+			if err == ErrSunAlwaysDown {
+				return true, nil
+			}
+			if err == ErrSunAlwaysUp {
+				return false, nil
+			}
+			return false, err
+		}
+		if !now.Before(start) && now.Before(end) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// window returns when the rules' window starting on day opens and closes.
+func (r sunOnRules) window(day time.Time, lat, lng float64) (start, end time.Time, err error) {
+	start, end, err = sunWindow(day, r.on, r.off, lat, lng)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if r.offAfter > 0 && start.Add(r.offAfter).Before(end) {
+		end = start.Add(r.offAfter)
+	}
+	return start, end, nil
+}
+
+// nextChange returns the next time after now that rules turn on or off, if
+// there is one in the next couple of days.
+func (r sunOnRules) nextChange(now time.Time, loc *time.Location, lat, lng float64) (time.Time, bool) {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	var next time.Time
+	for offset := -1; offset <= 2; offset++ {
+		start, end, err := r.window(today.AddDate(0, 0, offset), lat, lng)
+		if err != nil {
+			continue
+		}
+		for _, t := range []time.Time{start, end} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
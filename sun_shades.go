@@ -0,0 +1,634 @@
+package verhboat
+
+// erh:verhboat:sun-shades lowers and tilts TaHoma shades on whichever side of
+// the boat the sun is shining on, and raises them again when it moves off.
+//
+// The sun's azimuth and elevation come from the GPS position and time; the
+// boat's heading turns that into a bearing relative to the bow, which is
+// compared against each configured side. At anchor the boat swings, so the
+// heading is averaged over a window and a side only changes once the new
+// decision has held for a while, with some hysteresis at the edges of its arc.
+// Shades only move on a change, so moving one by hand sticks until the next
+// one.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var SunShadesModel = NamespaceFamily.WithModel("sun-shades")
+
+const (
+	sunShadesDefaultInterval      = time.Minute
+	sunShadesDefaultHeadingWindow = 5 * time.Minute
+	sunShadesDefaultHold          = 10 * time.Minute
+	sunShadesDefaultWidth         = 60.0
+	sunShadesDefaultMargin        = 10.0
+	sunShadesDefaultMinElevation  = 3.0
+	sunShadesDefaultClosure       = 100.0
+	sunShadesDefaultTempKey       = "temperature"
+)
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		SunShadesModel,
+		resource.Registration[sensor.Sensor, *SunShadesConfig]{
+			Constructor: newSunShades,
+		})
+}
+
+type SunShadesConfig struct {
+	TahomaGatewayConfig `json:",squash"`
+
+	// MovementSensor gives the boat's position and compass heading.
+	MovementSensor string `json:"movement-sensor"`
+
+	Sides []SunShadeSide `json:"sides"`
+
+	// MinElevation and MaxElevation (degrees) bound when the sun counts: below
+	// the minimum it's too low to matter, above the maximum the hardtop
+	// shades the windows anyway. Defaults to 3 and no maximum.
+	MinElevation *float64 `json:"min-elevation,omitempty"`
+	MaxElevation float64  `json:"max-elevation,omitempty"`
+
+	// TemperatureSensor, if set, gates shading on MinTemperature: below it
+	// the sun is welcome. TemperatureKey is the reading to use.
+	TemperatureSensor string  `json:"temperature-sensor,omitempty"`
+	TemperatureKey    string  `json:"temperature-key,omitempty"`
+	MinTemperature    float64 `json:"min-temperature,omitempty"`
+
+	// StartTime and EndTime ("HH:MM", in Timezone: default the machine's,
+	// "gps" for the time zone at the GPS position) limit shading to part of
+	// the day. Outside them shades are raised.
+	StartTime string `json:"start-time,omitempty"`
+	EndTime   string `json:"end-time,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+
+	IntervalSeconds      float64 `json:"interval-seconds,omitempty"`
+	HeadingWindowSeconds float64 `json:"heading-window-seconds,omitempty"`
+	HoldSeconds          float64 `json:"hold-seconds,omitempty"`
+}
+
+// SunShadeSide is a set of shades facing one way.
+type SunShadeSide struct {
+	Name string `json:"name"`
+
+	// Bearing is the direction the side faces, in degrees clockwise from the
+	// bow: 90 is starboard, 180 aft, 270 port.
+	Bearing float64 `json:"bearing"`
+
+	// Width is how far either side of Bearing the sun can be and still
+	// shine in (default 60). Margin is the extra it must move past that
+	// before the shades go back up (default 10).
+	Width  float64  `json:"width,omitempty"`
+	Margin *float64 `json:"margin,omitempty"`
+
+	// Devices are the TaHoma labels of the side's shades.
+	Devices []string `json:"devices"`
+
+	// Closure (default 100) and, for venetian blinds, Tilt are the
+	// percentages the shades go to when the sun is on them.
+	Closure *float64 `json:"closure,omitempty"`
+	Tilt    *float64 `json:"tilt,omitempty"`
+}
+
+func (c *SunShadesConfig) Validate(path string) ([]string, []string, error) {
+	if err := c.TahomaGatewayConfig.validate(); err != nil {
+		return nil, nil, err
+	}
+	if c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("need a movement-sensor")
+	}
+	if len(c.Sides) == 0 {
+		return nil, nil, fmt.Errorf("need at least one side")
+	}
+
+	seen := map[string]bool{}
+	for i, side := range c.Sides {
+		if side.Name == "" {
+			return nil, nil, fmt.Errorf("side %d needs a name", i)
+		}
+		if seen[side.Name] {
+			return nil, nil, fmt.Errorf("duplicate side name [%s]", side.Name)
+		}
+		seen[side.Name] = true
+		if len(side.Devices) == 0 {
+			return nil, nil, fmt.Errorf("side [%s] needs devices", side.Name)
+		}
+		if side.Width < 0 || side.Width > 180 {
+			return nil, nil, fmt.Errorf("side [%s] width must be between 0 and 180", side.Name)
+		}
+		if side.Margin != nil && *side.Margin < 0 {
+			return nil, nil, fmt.Errorf("side [%s] margin cannot be negative", side.Name)
+		}
+		for _, p := range []*float64{side.Closure, side.Tilt} {
+			if p != nil && (*p < 0 || *p > 100) {
+				return nil, nil, fmt.Errorf("side [%s] closure and tilt must be between 0 and 100", side.Name)
+			}
+		}
+	}
+
+	if _, err := loadTimezone(c.Timezone); err != nil {
+		return nil, nil, err
+	}
+	for _, t := range []string{c.StartTime, c.EndTime} {
+		if t == "" {
+			continue
+		}
+		if _, err := parseClock(t); err != nil {
+			return nil, nil, err
+		}
+	}
+	if (c.StartTime == "") != (c.EndTime == "") {
+		return nil, nil, fmt.Errorf("start-time and end-time go together")
+	}
+
+	if c.IntervalSeconds < 0 || c.HeadingWindowSeconds < 0 || c.HoldSeconds < 0 {
+		return nil, nil, fmt.Errorf("interval-seconds, heading-window-seconds and hold-seconds cannot be negative")
+	}
+
+	deps := []string{c.MovementSensor}
+	if c.TemperatureSensor != "" {
+		deps = append(deps, c.TemperatureSensor)
+	}
+	return deps, nil, nil
+}
+
+func (c *SunShadesConfig) minElevation() float64 {
+	if c.MinElevation == nil {
+		return sunShadesDefaultMinElevation
+	}
+	return *c.MinElevation
+}
+
+func (c *SunShadesConfig) temperatureKey() string {
+	if c.TemperatureKey == "" {
+		return sunShadesDefaultTempKey
+	}
+	return c.TemperatureKey
+}
+
+func secondsOr(s float64, def time.Duration) time.Duration {
+	if s == 0 {
+		return def
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+func (s *SunShadeSide) width() float64 {
+	if s.Width == 0 {
+		return sunShadesDefaultWidth
+	}
+	return s.Width
+}
+
+func (s *SunShadeSide) margin() float64 {
+	if s.Margin == nil {
+		return sunShadesDefaultMargin
+	}
+	return *s.Margin
+}
+
+func (s *SunShadeSide) closure() float64 {
+	if s.Closure == nil {
+		return sunShadesDefaultClosure
+	}
+	return *s.Closure
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("time must be HH:MM, got %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// inClockWindow reports whether now falls between start and end (minutes
+// after midnight), which may wrap past midnight.
+func inClockWindow(now time.Time, start, end int) bool {
+	m := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// angleDiff returns b - a folded into [-180, 180).
+func angleDiff(a, b float64) float64 {
+	return math.Mod(math.Mod(b-a+180, 360)+360, 360) - 180
+}
+
+// sideFacesSun reports whether the sun, at relBearing degrees clockwise from
+// the bow, is shining on the side. A side that is already shaded keeps the
+// sun until it is margin degrees past its edge.
+func sideFacesSun(side *SunShadeSide, relBearing float64, shaded bool) bool {
+	limit := side.width()
+	if shaded {
+		limit += side.margin()
+	}
+	return math.Abs(angleDiff(side.Bearing, relBearing)) <= limit
+}
+
+type headingSample struct {
+	at      time.Time
+	heading float64
+}
+
+// headingHistory averages the compass heading over a window, so a boat
+// swinging at anchor is treated as pointing at the middle of its swing.
+type headingHistory struct {
+	window  time.Duration
+	samples []headingSample
+}
+
+func (h *headingHistory) add(now time.Time, heading float64) {
+	h.samples = append(h.samples, headingSample{now, heading})
+	cutoff := now.Add(-h.window)
+	for len(h.samples) > 1 && h.samples[0].at.Before(cutoff) {
+		h.samples = h.samples[1:]
+	}
+}
+
+// mean returns the circular mean of the headings in the window, and their
+// spread: the largest difference of any sample from the mean.
+func (h *headingHistory) mean() (mean, spread float64) {
+	var x, y float64
+	for _, s := range h.samples {
+		x += math.Cos(s.heading * sunDegRad)
+		y += math.Sin(s.heading * sunDegRad)
+	}
+	mean = math.Mod(math.Atan2(y, x)/sunDegRad+360, 360)
+	for _, s := range h.samples {
+		spread = math.Max(spread, math.Abs(angleDiff(mean, s.heading)))
+	}
+	return mean, spread
+}
+
+// sunShadeSideState debounces one side's decision.
+type sunShadeSideState struct {
+	known        bool
+	shaded       bool
+	pendingSince time.Time
+	lastErr      error
+}
+
+// update records the latest decision and reports whether the side should
+// change now: immediately the first time, otherwise once the new decision
+// has held for hold.
+func (st *sunShadeSideState) update(want bool, now time.Time, hold time.Duration) bool {
+	if st.known && want == st.shaded {
+		st.pendingSince = time.Time{}
+		return false
+	}
+	if st.known {
+		if st.pendingSince.IsZero() {
+			st.pendingSince = now
+		}
+		if now.Sub(st.pendingSince) < hold {
+			return false
+		}
+	}
+	st.known = true
+	st.shaded = want
+	st.pendingSince = time.Time{}
+	return true
+}
+
+type SunShades struct {
+	resource.AlwaysRebuild
+
+	name   resource.Name
+	conf   *SunShadesConfig
+	logger logging.Logger
+
+	client      *TahomaClient
+	movement    movementsensor.MovementSensor
+	temperature sensor.Sensor
+	loc         *time.Location
+
+	evalMu   sync.Mutex // one evaluation (and shade move) at a time
+	mu       sync.Mutex
+	enabled  bool
+	headings headingHistory
+	sides    []sunShadeSideState
+	last     map[string]interface{}
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newSunShades(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	conf, err := resource.NativeConfig[*SunShadesConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSunShades(ctx, deps, rawConf.ResourceName(), conf, logger)
+}
+
+func NewSunShades(ctx context.Context, deps resource.Dependencies, name resource.Name, conf *SunShadesConfig, logger logging.Logger) (*SunShades, error) {
+	s, err := makeSunShades(ctx, deps, name, conf, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	bgCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go s.loop(bgCtx)
+
+	return s, nil
+}
+
+// makeSunShades builds a SunShades without starting its loop.
+func makeSunShades(ctx context.Context, deps resource.Dependencies, name resource.Name, conf *SunShadesConfig, logger logging.Logger) (*SunShades, error) {
+	loc, err := loadTimezone(conf.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SunShades{
+		name:     name,
+		conf:     conf,
+		logger:   logger,
+		loc:      loc,
+		enabled:  true,
+		headings: headingHistory{window: secondsOr(conf.HeadingWindowSeconds, sunShadesDefaultHeadingWindow)},
+		sides:    make([]sunShadeSideState, len(conf.Sides)),
+	}
+
+	s.movement, err = movementsensor.FromDependencies(deps, conf.MovementSensor)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.TemperatureSensor != "" {
+		s.temperature, err = sensor.FromDependencies(deps, conf.TemperatureSensor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Shared with any tahoma-shade components on the same gateway.
+	s.client, err = acquireTahomaClient(ctx, conf.TahomaGatewayConfig)
+	if err != nil {
+		return nil, err
+	}
+	for i := range conf.Sides {
+		side := &conf.Sides[i]
+		urls, err := s.client.labelsToUrls(side.Devices)
+		if err == nil {
+			err = s.client.validateCommands(urls, side.commands(true))
+		}
+		if err != nil {
+			releaseTahomaClient(ctx, s.client)
+			return nil, fmt.Errorf("side [%s]: %w", side.Name, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *SunShades) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	if err := s.evaluate(ctx, time.Now()); err != nil {
+		s.logger.Warnf("sun-shades: initial check failed: %v", err)
+	}
+
+	t := time.NewTicker(secondsOr(s.conf.IntervalSeconds, sunShadesDefaultInterval))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.evaluate(ctx, time.Now()); err != nil {
+				s.logger.Warnf("sun-shades: check failed: %v", err)
+			}
+		}
+	}
+}
+
+// gates checks the time-of-day (in loc) and temperature gates, returning why
+// shading is off, or "" if it's allowed.
+func (s *SunShades) gates(ctx context.Context, now time.Time, loc *time.Location, res map[string]interface{}) (string, error) {
+	if s.conf.StartTime != "" {
+		start, _ := parseClock(s.conf.StartTime)
+		end, _ := parseClock(s.conf.EndTime)
+		if !inClockWindow(now.In(loc), start, end) {
+			return "outside start-time/end-time", nil
+		}
+	}
+
+	if s.temperature != nil {
+		readings, err := s.temperature.Readings(ctx, nil)
+		if err != nil {
+			return "", fmt.Errorf("reading temperature: %w", err)
+		}
+		temp, ok := readings[s.conf.temperatureKey()].(float64)
+		if !ok {
+			return "", fmt.Errorf("temperature sensor has no number %q in %v", s.conf.temperatureKey(), readings)
+		}
+		res["temperature"] = temp
+		if temp < s.conf.MinTemperature {
+			return "below min-temperature", nil
+		}
+	}
+
+	return "", nil
+}
+
+// evaluate reads the sensors, decides which sides should be shaded, and moves
+// the shades of any side whose decision has changed.
+func (s *SunShades) evaluate(ctx context.Context, now time.Time) error {
+	s.evalMu.Lock()
+	defer s.evalMu.Unlock()
+
+	point, _, err := s.movement.Position(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("reading position: %w", err)
+	}
+	heading, err := s.movement.CompassHeading(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("reading heading: %w", err)
+	}
+
+	azimuth, elevation := SunPosition(now, point.Lat(), point.Lng())
+
+	res := map[string]interface{}{
+		"sun_azimuth":   azimuth,
+		"sun_elevation": elevation,
+		"heading_now":   heading,
+	}
+
+	loc := zoneAt(s.conf.Timezone, s.loc, point.Lat(), point.Lng())
+	gated, err := s.gates(ctx, now, loc, res)
+	if err != nil {
+		return err
+	}
+	if gated == "" {
+		if elevation < s.conf.minElevation() {
+			gated = "sun below min-elevation"
+		} else if s.conf.MaxElevation > 0 && elevation > s.conf.MaxElevation {
+			gated = "sun above max-elevation"
+		}
+	}
+	res["gated"] = gated
+
+	s.mu.Lock()
+	s.headings.add(now, heading)
+	meanHeading, spread := s.headings.mean()
+	relBearing := math.Mod(azimuth-meanHeading+360, 360)
+	res["heading"] = meanHeading
+	res["heading_spread"] = spread
+	res["sun_bearing_from_bow"] = relBearing
+	res["enabled"] = s.enabled
+
+	hold := secondsOr(s.conf.HoldSeconds, sunShadesDefaultHold)
+	changes := map[int]bool{}
+	for i := range s.conf.Sides {
+		side := &s.conf.Sides[i]
+		st := &s.sides[i]
+		want := gated == "" && sideFacesSun(side, relBearing, st.known && st.shaded)
+		if s.enabled && st.update(want, now, hold) {
+			changes[i] = want
+		}
+	}
+	s.last = res
+	s.mu.Unlock()
+
+	for i, shaded := range changes {
+		side := &s.conf.Sides[i]
+		s.logger.Infof("sun-shades: side [%s] %s (sun %.0f° from bow, elevation %.0f°)",
+			side.Name, shadedName(shaded), relBearing, elevation)
+		err := s.moveSide(ctx, side, shaded)
+
+		s.mu.Lock()
+		s.sides[i].lastErr = err
+		if err != nil {
+			// Try again next time round.
+			s.sides[i].known = false
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			s.logger.Warnf("sun-shades: moving side [%s] failed: %v", side.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func shadedName(shaded bool) string {
+	if shaded {
+		return "shaded"
+	}
+	return "open"
+}
+
+func (s *SunShades) moveSide(ctx context.Context, side *SunShadeSide, shaded bool) error {
+	urls, err := s.client.labelsToUrls(side.Devices)
+	if err != nil {
+		return err
+	}
+
+	label := "Sun off " + side.Name
+	if shaded {
+		label = "Sun on " + side.Name
+	}
+
+	// Each command waits for the last, so the slats tilt once the shade is down.
+	for _, cmd := range side.commands(shaded) {
+		if _, err := s.client.ExecuteAndWait(ctx, urls, []Command{cmd}, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commands returns what to send the side's shades when it becomes shaded or open.
+func (s *SunShadeSide) commands(shaded bool) []Command {
+	if !shaded {
+		return []Command{{Name: "up", Parameters: []interface{}{}}}
+	}
+	cmds := []Command{{Name: "setClosure", Parameters: []interface{}{int(s.closure())}}}
+	if s.Tilt != nil {
+		cmds = append(cmds, Command{Name: "setOrientation", Parameters: []interface{}{int(*s.Tilt)}})
+	}
+	return cmds
+}
+
+func (s *SunShades) Name() resource.Name {
+	return s.name
+}
+
+func (s *SunShades) Close(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return releaseTahomaClient(ctx, s.client)
+}
+
+func (s *SunShades) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := map[string]interface{}{}
+	for k, v := range s.last {
+		res[k] = v
+	}
+	res["enabled"] = s.enabled
+	for i, side := range s.conf.Sides {
+		st := s.sides[i]
+		res["side_"+side.Name] = shadedName(st.known && st.shaded)
+		if st.lastErr != nil {
+			res["side_"+side.Name+"_error"] = st.lastErr.Error()
+		}
+	}
+	return res, nil
+}
+
+// DoCommand supports:
+//
+//	{"command": "enable"}     resume automatic control
+//	{"command": "disable"}    stop moving shades; readings keep updating
+//	{"command": "evaluate"}   check the sun now instead of waiting
+func (s *SunShades) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	command, _ := cmd["command"].(string)
+
+	switch command {
+	case "enable", "disable":
+		s.mu.Lock()
+		s.enabled = command == "enable"
+		if s.enabled {
+			// Re-apply whatever the sun says rather than trusting old state.
+			for i := range s.sides {
+				s.sides[i] = sunShadeSideState{}
+			}
+		}
+		s.mu.Unlock()
+		return map[string]interface{}{"enabled": command == "enable"}, nil
+
+	case "evaluate":
+		if err := s.evaluate(ctx, time.Now()); err != nil {
+			return nil, err
+		}
+		return s.Readings(ctx, nil)
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
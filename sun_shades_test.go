@@ -0,0 +1,243 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+// testGPS is a movement sensor with a fixed position and a settable heading.
+type testGPS struct {
+	movementsensor.MovementSensor
+	lat, lng float64
+	heading  float64
+}
+
+func (g *testGPS) Position(ctx context.Context, extra map[string]interface{}) (*geo.Point, float64, error) {
+	return geo.NewPoint(g.lat, g.lng), 0, nil
+}
+
+func (g *testGPS) CompassHeading(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return g.heading, nil
+}
+
+type testSensor struct {
+	sensor.Sensor
+	readings map[string]interface{}
+}
+
+func (s *testSensor) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	return s.readings, nil
+}
+
+func TestSunShadeGeometry(t *testing.T) {
+	test.That(t, angleDiff(350, 10), test.ShouldEqual, 20)
+	test.That(t, angleDiff(10, 350), test.ShouldEqual, -20)
+	test.That(t, angleDiff(90, 270), test.ShouldEqual, -180)
+
+	stbd := &SunShadeSide{Name: "starboard", Bearing: 90}
+	test.That(t, sideFacesSun(stbd, 100, false), test.ShouldBeTrue)
+	test.That(t, sideFacesSun(stbd, 150, false), test.ShouldBeTrue)
+	test.That(t, sideFacesSun(stbd, 155, false), test.ShouldBeFalse)
+	test.That(t, sideFacesSun(stbd, 155, true), test.ShouldBeTrue) // hysteresis
+	test.That(t, sideFacesSun(stbd, 165, true), test.ShouldBeFalse)
+	test.That(t, sideFacesSun(stbd, 270, false), test.ShouldBeFalse)
+
+	// A boat swinging either side of north averages to north.
+	h := headingHistory{window: 5 * time.Minute}
+	now := time.Date(2026, 7, 26, 13, 0, 0, 0, time.UTC)
+	for i, heading := range []float64{340, 20, 330, 30, 350} {
+		h.add(now.Add(time.Duration(i)*time.Minute), heading)
+	}
+	mean, spread := h.mean()
+	test.That(t, angleDiff(0, mean), test.ShouldAlmostEqual, 0, 5)
+	test.That(t, spread, test.ShouldAlmostEqual, 30, 5)
+
+	// Old samples fall out of the window.
+	h.add(now.Add(20*time.Minute), 180)
+	mean, spread = h.mean()
+	test.That(t, mean, test.ShouldAlmostEqual, 180, 0.001)
+	test.That(t, spread, test.ShouldAlmostEqual, 0, 0.001)
+
+	// Window wrapping midnight.
+	test.That(t, inClockWindow(time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC), 22*60, 2*60), test.ShouldBeTrue)
+	test.That(t, inClockWindow(time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC), 22*60, 2*60), test.ShouldBeTrue)
+	test.That(t, inClockWindow(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), 22*60, 2*60), test.ShouldBeFalse)
+	test.That(t, inClockWindow(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), 9*60, 17*60), test.ShouldBeTrue)
+}
+
+func TestSunShadeSideStateHold(t *testing.T) {
+	now := time.Date(2026, 7, 26, 13, 0, 0, 0, time.UTC)
+	hold := 10 * time.Minute
+	st := sunShadeSideState{}
+
+	test.That(t, st.update(true, now, hold), test.ShouldBeTrue) // first decision applies at once
+	test.That(t, st.update(true, now.Add(time.Minute), hold), test.ShouldBeFalse)
+	test.That(t, st.update(false, now.Add(2*time.Minute), hold), test.ShouldBeFalse)
+	test.That(t, st.update(false, now.Add(5*time.Minute), hold), test.ShouldBeFalse)
+	test.That(t, st.update(true, now.Add(6*time.Minute), hold), test.ShouldBeFalse) // flapped back, resets
+	test.That(t, st.update(false, now.Add(7*time.Minute), hold), test.ShouldBeFalse)
+	test.That(t, st.update(false, now.Add(16*time.Minute), hold), test.ShouldBeFalse)
+	test.That(t, st.update(false, now.Add(17*time.Minute), hold), test.ShouldBeTrue)
+	test.That(t, st.shaded, test.ShouldBeFalse)
+}
+
+func TestSunShadesConfigValidate(t *testing.T) {
+	conf := &SunShadesConfig{
+		TahomaGatewayConfig: TahomaGatewayConfig{ApiKey: "x"},
+		MovementSensor:      "gps",
+		Sides:               []SunShadeSide{{Name: "port", Bearing: 270, Devices: []string{"Port"}}},
+	}
+	deps, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"gps"})
+
+	conf.TemperatureSensor = "temp"
+	deps, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"gps", "temp"})
+
+	conf.StartTime = "09:00"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.EndTime = "25:00"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.EndTime = "18:30"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	conf.Timezone = "Mars/Olympus"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.Timezone = gpsTimezone
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// With "gps", start-time and end-time are local time where the boat is:
+	// 21:30 UTC is 17:30 in New York in July, inside 09:00-18:30.
+	s := &SunShades{conf: conf, loc: time.UTC}
+	now := time.Date(2026, 7, 26, 21, 30, 0, 0, time.UTC)
+	gated, err := s.gates(context.Background(), now, zoneAt(conf.Timezone, s.loc, 40.7128, -74.0060), map[string]interface{}{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, gated, test.ShouldEqual, "")
+	gated, err = s.gates(context.Background(), now, zoneAt(conf.Timezone, s.loc, 43.2965, 5.3698), map[string]interface{}{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, gated, test.ShouldEqual, "outside start-time/end-time")
+	conf.Timezone = "America/New_York"
+
+	conf.Sides[0].Devices = nil
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestSunShadesAgainstFake(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	port := fake.AddShade("Port", true)
+	stbd := fake.AddShade("Starboard", true)
+	ctx := context.Background()
+
+	// New York, mid-morning: the sun is a little south of east and ~40° up.
+	gps := &testGPS{lat: 40.7128, lng: -74.0060}
+	thermo := &testSensor{readings: map[string]interface{}{"temperature": 30.0}}
+	deps := resource.Dependencies{
+		movementsensor.Named("gps"): gps,
+		sensor.Named("thermo"):      thermo,
+	}
+
+	tilt := 60.0
+	conf := &SunShadesConfig{
+		TahomaGatewayConfig:  testTahomaGatewayConfig(fake),
+		MovementSensor:       "gps",
+		TemperatureSensor:    "thermo",
+		MinTemperature:       20,
+		HeadingWindowSeconds: 1,
+		HoldSeconds:          600,
+		Sides: []SunShadeSide{
+			{Name: "port", Bearing: 270, Devices: []string{"Port"}, Tilt: &tilt},
+			{Name: "starboard", Bearing: 90, Devices: []string{"Starboard"}, Tilt: &tilt},
+		},
+	}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	s, err := makeSunShades(ctx, deps, sensor.Named("sun"), conf, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer s.Close(ctx)
+	s.client.eventPoll = 20 * time.Millisecond
+
+	// Heading north: the sun is on the starboard side.
+	now := time.Date(2026, 7, 26, 13, 0, 0, 0, time.UTC)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(stbd), test.ShouldEqual, 100)
+	test.That(t, fake.Orientation(stbd), test.ShouldEqual, 60)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 0)
+
+	// A tahoma-shade on the same gateway shares the client and its event
+	// listener, and closing it leaves them to sun-shades.
+	shadeConf := &TahomaShadeConfig{TahomaGatewayConfig: conf.TahomaGatewayConfig, Device: "Port"}
+	shade, err := NewTahomaShade(ctx, toggleswitch.Named("port"), shadeConf, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, shade.client, test.ShouldEqual, s.client)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 1)
+	test.That(t, shade.Close(ctx), test.ShouldBeNil)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 1)
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["side_starboard"], test.ShouldEqual, "shaded")
+	test.That(t, readings["side_port"], test.ShouldEqual, "open")
+	test.That(t, readings["sun_bearing_from_bow"], test.ShouldBeBetween, 60, 120)
+
+	// The boat swings round; nothing moves until that has held for a while.
+	gps.heading = 180
+	now = now.Add(time.Minute)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(stbd), test.ShouldEqual, 100)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 0)
+
+	now = now.Add(11 * time.Minute)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(stbd), test.ShouldEqual, 0)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 100)
+
+	// Too cool to need shade: after the hold, everything goes up.
+	thermo.readings = map[string]interface{}{"temperature": 15.0}
+	now = now.Add(time.Minute)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	readings, err = s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["gated"], test.ShouldEqual, "below min-temperature")
+	test.That(t, fake.Closure(port), test.ShouldEqual, 100)
+	now = now.Add(11 * time.Minute)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 0)
+
+	// Disabled, nothing moves; enabling re-applies straight away.
+	thermo.readings = map[string]interface{}{"temperature": 30.0}
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "disable"})
+	test.That(t, err, test.ShouldBeNil)
+	now = now.Add(20 * time.Minute)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 0)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "enable"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 100)
+
+	// After dark, everything opens.
+	now = time.Date(2026, 7, 27, 3, 0, 0, 0, time.UTC)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	now = now.Add(11 * time.Minute)
+	test.That(t, s.evaluate(ctx, now), test.ShouldBeNil)
+	test.That(t, fake.Closure(port), test.ShouldEqual, 0)
+	test.That(t, fake.Closure(stbd), test.ShouldEqual, 0)
+}
@@ -0,0 +1,397 @@
+package verhboat
+
+// erh:verhboat:sun-switch wraps another switch (an m4315-pro outlet, a
+// digital-switching relay, ...) and turns it on and off on sun-relative
+// rules at the boat's GPS position: anchor lights from sunset to sunrise,
+// deck courtesy lights from civil dusk until 23:00, and so on.
+//
+// Setting its position by hand overrides the rules, until their next change
+// or for a configured time, after which they take over again. Otherwise the
+// wrapped switch is only set when the rules change, so switching it directly
+// sticks until then too.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var SunSwitchModel = NamespaceFamily.WithModel("sun-switch")
+
+const (
+	sunSwitchInterval    = time.Minute
+	sunSwitchDefaultOn   = "sunset"
+	sunSwitchDefaultOff  = "sunrise"
+	sunSwitchMaxOverride = 24 * time.Hour // when the rules have no next change
+)
+
+func init() {
+	resource.RegisterComponent(
+		toggleswitch.API,
+		SunSwitchModel,
+		resource.Registration[toggleswitch.Switch, *SunSwitchConfig]{
+			Constructor: newSunSwitch,
+		})
+}
+
+type SunSwitchConfig struct {
+	// Switch is the switch to drive; position 1 is on and 0 off.
+	Switch string `json:"switch"`
+
+	// MovementSensor gives the position for sun times. Only needed if the
+	// rules use them.
+	MovementSensor string `json:"movement-sensor,omitempty"`
+
+	// OnAt and OffAt are "HH:MM" or a sun event with an optional offset,
+	// such as "civil_dusk+15m". Default sunset to sunrise. OffAfterHours
+	// turns it off that long after it came on, if that's before OffAt.
+	OnAt          string  `json:"on-at,omitempty"`
+	OffAt         string  `json:"off-at,omitempty"`
+	OffAfterHours float64 `json:"off-after-hours,omitempty"`
+
+	// Timezone for clock times; defaults to the machine's, "gps" for the time
+	// zone at the GPS position.
+	Timezone string `json:"timezone,omitempty"`
+
+	// OverrideMinutes is how long setting the position by hand holds. By
+	// default it holds until the rules next change.
+	OverrideMinutes float64 `json:"override-minutes,omitempty"`
+}
+
+func (c *SunSwitchConfig) Validate(path string) ([]string, []string, error) {
+	if c.Switch == "" {
+		return nil, nil, fmt.Errorf("need a switch")
+	}
+	rules, err := c.rules()
+	if err != nil {
+		return nil, nil, err
+	}
+	if rules.usesSun() && c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("on-at/off-at relative to the sun need a movement-sensor")
+	}
+	if _, err := loadTimezone(c.Timezone); err != nil {
+		return nil, nil, err
+	}
+	if c.Timezone == gpsTimezone && c.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("timezone gps needs a movement-sensor")
+	}
+	if c.OverrideMinutes < 0 {
+		return nil, nil, fmt.Errorf("override-minutes can't be negative")
+	}
+
+	deps := []string{c.Switch}
+	if c.MovementSensor != "" {
+		deps = append(deps, c.MovementSensor)
+	}
+	return deps, nil, nil
+}
+
+func (c *SunSwitchConfig) rules() (sunOnRules, error) {
+	on, off := c.OnAt, c.OffAt
+	if on == "" {
+		on = sunSwitchDefaultOn
+	}
+	if off == "" {
+		off = sunSwitchDefaultOff
+	}
+	return makeSunOnRules(on, off, c.OffAfterHours)
+}
+
+// sunSwitchOverride is a manual position that holds until a time.
+type sunSwitchOverride struct {
+	on    bool
+	until time.Time
+}
+
+type SunSwitch struct {
+	resource.AlwaysRebuild
+
+	name   resource.Name
+	conf   *SunSwitchConfig
+	logger logging.Logger
+
+	sw       toggleswitch.Switch
+	movement movementsensor.MovementSensor
+	rules    sunOnRules
+	loc      *time.Location
+
+	// mu also serializes setting the wrapped switch.
+	mu         sync.Mutex
+	applied    *bool // what we last set the switch to; nil before the first
+	scheduled  bool  // what the rules said at the last evaluation
+	nextChange time.Time
+	override   *sunSwitchOverride
+	lastErr    error
+
+	now func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newSunSwitch(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
+	conf, err := resource.NativeConfig[*SunSwitchConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := makeSunSwitch(deps, rawConf.ResourceName(), conf, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	bgCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go s.loop(bgCtx)
+
+	return s, nil
+}
+
+// makeSunSwitch builds a SunSwitch without starting its loop.
+func makeSunSwitch(deps resource.Dependencies, name resource.Name, conf *SunSwitchConfig, logger logging.Logger) (*SunSwitch, error) {
+	rules, err := conf.rules()
+	if err != nil {
+		return nil, err
+	}
+	loc, err := loadTimezone(conf.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SunSwitch{
+		name:   name,
+		conf:   conf,
+		logger: logger,
+		rules:  rules,
+		loc:    loc,
+		now:    time.Now,
+	}
+
+	s.sw, err = toggleswitch.FromDependencies(deps, conf.Switch)
+	if err != nil {
+		return nil, err
+	}
+	if conf.MovementSensor != "" {
+		s.movement, err = movementsensor.FromDependencies(deps, conf.MovementSensor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *SunSwitch) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	t := time.NewTicker(sunSwitchInterval)
+	defer t.Stop()
+	for {
+		if err := s.evaluate(ctx, s.now()); err != nil {
+			s.logger.Warnf("sun-switch %s: %v", s.name.ShortName(), err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// schedule returns what the rules say at now, and when they next change (zero
+// if not in the next couple of days).
+func (s *SunSwitch) schedule(ctx context.Context, now time.Time) (bool, time.Time, error) {
+	var lat, lng float64
+	if s.movement != nil {
+		point, _, err := s.movement.Position(ctx, nil)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("reading position: %w", err)
+		}
+		lat, lng = point.Lat(), point.Lng()
+	}
+
+	loc := zoneAt(s.conf.Timezone, s.loc, lat, lng)
+	want, err := desiredOn(now, s.rules, loc, lat, lng)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	next, _ := s.rules.nextChange(now, loc, lat, lng)
+	return want, next, nil
+}
+
+// evaluate sets the switch to what the rules (or an override) say, if that's
+// changed.
+func (s *SunSwitch) evaluate(ctx context.Context, now time.Time) error {
+	want, next, err := s.schedule(ctx, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastErr = err
+	if err != nil {
+		return err
+	}
+	s.scheduled = want
+	s.nextChange = next
+
+	if s.override != nil && !now.Before(s.override.until) {
+		s.logger.Infof("sun-switch %s: override expired", s.name.ShortName())
+		s.override = nil
+	}
+	if s.override != nil {
+		want = s.override.on
+	}
+
+	if s.applied != nil && *s.applied == want {
+		return nil
+	}
+	s.logger.Infof("sun-switch %s: turning %s", s.name.ShortName(), onOff(want))
+	return s.setLocked(ctx, want)
+}
+
+func (s *SunSwitch) setLocked(ctx context.Context, on bool) error {
+	var pos uint32
+	if on {
+		pos = 1
+	}
+	if err := s.sw.SetPosition(ctx, pos, nil); err != nil {
+		s.lastErr = err
+		return err
+	}
+	s.applied = &on
+	return nil
+}
+
+// overrideFor sets the switch by hand, holding for d or, if d is 0, until
+// the rules next change.
+func (s *SunSwitch) overrideFor(ctx context.Context, on bool, d time.Duration) error {
+	now := s.now()
+	until := now.Add(d)
+	if d == 0 {
+		_, next, err := s.schedule(ctx, now)
+		if err != nil || next.IsZero() || next.Sub(now) > sunSwitchMaxOverride {
+			next = now.Add(sunSwitchMaxOverride)
+		}
+		until = next
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Only hold the override once the switch has it, so a failed set doesn't
+	// stop the rules from retrying.
+	if err := s.setLocked(ctx, on); err != nil {
+		return err
+	}
+	s.override = &sunSwitchOverride{on: on, until: until}
+	s.logger.Infof("sun-switch %s: overridden %s until %s", s.name.ShortName(), onOff(on), until.Format(time.RFC3339))
+	return nil
+}
+
+func (s *SunSwitch) Name() resource.Name {
+	return s.name
+}
+
+func (s *SunSwitch) Close(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// SetPosition sets the switch by hand, overriding the rules for
+// override-minutes or until they next change.
+func (s *SunSwitch) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	if position > 1 {
+		return fmt.Errorf("sun-switch only supports positions 0 (off) and 1 (on), got %d", position)
+	}
+	return s.overrideFor(ctx, position == 1, time.Duration(s.conf.OverrideMinutes*float64(time.Minute)))
+}
+
+// GetPosition is the wrapped switch's position.
+func (s *SunSwitch) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	return s.sw.GetPosition(ctx, extra)
+}
+
+func (s *SunSwitch) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
+	return 2, []string{"off", "on"}, nil
+}
+
+// DoCommand supports:
+//
+//	{"command": "override", "position": 1, "minutes": 30}
+//	                            set by hand for a while (minutes optional, as SetPosition)
+//	{"command": "clear_override"}  go back to the rules now
+//	{"command": "evaluate"}        check the rules now instead of waiting
+//	{"command": "status"}          report the rules, override and switch state
+func (s *SunSwitch) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	command, _ := cmd["command"].(string)
+
+	switch command {
+	case "override":
+		pos, ok := cmd["position"].(float64)
+		if !ok || (pos != 0 && pos != 1) {
+			return nil, fmt.Errorf("override needs a \"position\" of 0 or 1")
+		}
+		d := time.Duration(s.conf.OverrideMinutes * float64(time.Minute))
+		if v, ok := cmd["minutes"]; ok {
+			mins, ok := v.(float64)
+			if !ok || mins <= 0 {
+				return nil, fmt.Errorf("override needs a positive number \"minutes\"")
+			}
+			d = time.Duration(mins * float64(time.Minute))
+		}
+		if err := s.overrideFor(ctx, pos == 1, d); err != nil {
+			return nil, err
+		}
+		return s.status(), nil
+
+	case "clear_override":
+		s.mu.Lock()
+		s.override = nil
+		s.mu.Unlock()
+		if err := s.evaluate(ctx, s.now()); err != nil {
+			return nil, err
+		}
+		return s.status(), nil
+
+	case "evaluate":
+		if err := s.evaluate(ctx, s.now()); err != nil {
+			return nil, err
+		}
+		return s.status(), nil
+
+	case "status":
+		return s.status(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func (s *SunSwitch) status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := map[string]interface{}{"scheduled": onOff(s.scheduled)}
+	if !s.nextChange.IsZero() {
+		res["next_change"] = s.nextChange.Format(time.RFC3339)
+	}
+	if s.applied != nil {
+		res["switch"] = onOff(*s.applied)
+	}
+	if s.override != nil {
+		res["override"] = onOff(s.override.on)
+		res["override_until"] = s.override.until.Format(time.RFC3339)
+	}
+	if s.lastErr != nil {
+		res["error"] = s.lastErr.Error()
+	}
+	return res
+}
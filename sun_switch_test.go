@@ -0,0 +1,254 @@
+package verhboat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+type testSwitch struct {
+	toggleswitch.Switch
+
+	mu        sync.Mutex
+	positions []uint32
+	fail      error
+}
+
+func (s *testSwitch) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.positions = append(s.positions, position)
+	return nil
+}
+
+func (s *testSwitch) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.positions) == 0 {
+		return 0, nil
+	}
+	return s.positions[len(s.positions)-1], nil
+}
+
+func (s *testSwitch) sets() []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint32{}, s.positions...)
+}
+
+func makeTestSunSwitch(t *testing.T, conf *SunSwitchConfig) (*SunSwitch, *testSwitch, *time.Time) {
+	sw := &testSwitch{}
+	deps := resource.Dependencies{
+		toggleswitch.Named("light"): sw,
+		movementsensor.Named("gps"): &testGPS{lat: 40.7128, lng: -74.0060},
+	}
+	conf.Switch = "light"
+	conf.MovementSensor = "gps"
+	if conf.Timezone == "" {
+		conf.Timezone = "America/New_York"
+	}
+
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	s, err := makeSunSwitch(deps, toggleswitch.Named("anchor"), conf, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+
+	now := new(time.Time)
+	s.now = func() time.Time { return *now }
+	return s, sw, now
+}
+
+func TestSunSwitchConfig(t *testing.T) {
+	good := &SunSwitchConfig{Switch: "light", MovementSensor: "gps"}
+	deps, _, err := good.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"light", "gps"})
+
+	clock := &SunSwitchConfig{Switch: "light", OnAt: "18:00", OffAt: "23:00"}
+	deps, _, err = clock.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"light"})
+
+	for _, bad := range []*SunSwitchConfig{
+		{MovementSensor: "gps"},
+		{Switch: "light"},
+		{Switch: "light", MovementSensor: "gps", OnAt: "noonish"},
+		{Switch: "light", MovementSensor: "gps", OffAfterHours: -1},
+		{Switch: "light", OnAt: "18:00", OffAt: "23:00", Timezone: "gps"},
+		{Switch: "light", MovementSensor: "gps", Timezone: "Mars/Olympus"},
+		{Switch: "light", MovementSensor: "gps", OverrideMinutes: -5},
+	} {
+		_, _, err := bad.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+func TestSunSwitchSchedule(t *testing.T) {
+	ctx := context.Background()
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	// Sunset to sunrise; in New York on the solstice that's about 20:31 to
+	// 05:25 EDT.
+	s, sw, now := makeTestSunSwitch(t, &SunSwitchConfig{})
+
+	*now = time.Date(2026, 6, 21, 14, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0})
+
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["scheduled"], test.ShouldEqual, "off")
+	next, err := time.Parse(time.RFC3339, status["next_change"].(string))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, next.In(ny).Hour(), test.ShouldEqual, 20)
+
+	// Nothing changes until sunset.
+	*now = time.Date(2026, 6, 21, 19, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0})
+
+	*now = time.Date(2026, 6, 21, 21, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	*now = time.Date(2026, 6, 22, 2, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1})
+
+	*now = time.Date(2026, 6, 22, 6, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0})
+
+	pos, err := s.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+}
+
+func TestSunSwitchGPSTimezone(t *testing.T) {
+	ctx := context.Background()
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	// The GPS puts the boat in New York, so the clock times are EDT.
+	s, sw, now := makeTestSunSwitch(t, &SunSwitchConfig{OnAt: "18:00", OffAt: "23:30", Timezone: gpsTimezone})
+	for _, tc := range []struct {
+		hour, min int
+		want      []uint32
+	}{
+		{17, 45, []uint32{0}},
+		{18, 15, []uint32{0, 1}},
+		{23, 15, []uint32{0, 1}},
+		{23, 45, []uint32{0, 1, 0}},
+	} {
+		*now = time.Date(2026, 7, 26, tc.hour, tc.min, 0, 0, ny)
+		test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+		test.That(t, sw.sets(), test.ShouldResemble, tc.want)
+	}
+}
+
+func TestSunSwitchOverride(t *testing.T) {
+	ctx := context.Background()
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	s, sw, now := makeTestSunSwitch(t, &SunSwitchConfig{})
+
+	*now = time.Date(2026, 6, 21, 14, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+
+	// On by hand in the afternoon holds until sunset, which turns it on
+	// anyway, and then the rules take over again.
+	test.That(t, s.SetPosition(ctx, 1, nil), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1})
+	status, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["override"], test.ShouldEqual, "on")
+
+	*now = time.Date(2026, 6, 21, 16, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1})
+
+	*now = time.Date(2026, 6, 21, 21, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	status, err = s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["override"], test.ShouldBeNil)
+
+	*now = time.Date(2026, 6, 22, 6, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0})
+
+	// Off for 30 minutes at night, then back on.
+	*now = time.Date(2026, 6, 22, 22, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "override", "position": 0.0, "minutes": 30.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0, 1, 0})
+
+	*now = time.Date(2026, 6, 22, 22, 20, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0, 1, 0})
+
+	*now = time.Date(2026, 6, 22, 22, 31, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0, 1, 0, 1})
+
+	// clear_override goes straight back to the rules.
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "override", "position": 0.0})
+	test.That(t, err, test.ShouldBeNil)
+	status, err = s.DoCommand(ctx, map[string]interface{}{"command": "clear_override"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["override"], test.ShouldBeNil)
+	test.That(t, status["switch"], test.ShouldEqual, "on")
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0, 1, 0, 1, 0, 1})
+
+	test.That(t, s.SetPosition(ctx, 2, nil), test.ShouldNotBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "override", "position": 1.0, "minutes": -1.0})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// An override the switch didn't take isn't held.
+	sw.mu.Lock()
+	sw.fail = errors.New("relay stuck")
+	sw.mu.Unlock()
+	test.That(t, s.SetPosition(ctx, 0, nil), test.ShouldNotBeNil)
+	status, err = s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["override"], test.ShouldBeNil)
+}
+
+func TestSunSwitchOverrideMinutes(t *testing.T) {
+	ctx := context.Background()
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	s, sw, now := makeTestSunSwitch(t, &SunSwitchConfig{OnAt: "civil_dusk", OffAt: "23:00", OverrideMinutes: 60})
+
+	*now = time.Date(2026, 6, 21, 10, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, s.SetPosition(ctx, 1, nil), test.ShouldBeNil)
+
+	*now = time.Date(2026, 6, 21, 10, 59, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1})
+
+	*now = time.Date(2026, 6, 21, 11, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0})
+
+	*now = time.Date(2026, 6, 21, 22, 0, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	*now = time.Date(2026, 6, 21, 23, 5, 0, 0, ny)
+	test.That(t, s.evaluate(ctx, *now), test.ShouldBeNil)
+	test.That(t, sw.sets(), test.ShouldResemble, []uint32{0, 1, 0, 1, 0})
+}
@@ -0,0 +1,93 @@
+package verhboat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestSunState(t *testing.T) {
+	test.That(t, sunState(30), test.ShouldEqual, "day")
+	test.That(t, sunState(-0.5), test.ShouldEqual, "day")
+	test.That(t, sunState(-3), test.ShouldEqual, "civil_twilight")
+	test.That(t, sunState(-9), test.ShouldEqual, "nautical_twilight")
+	test.That(t, sunState(-15), test.ShouldEqual, "astronomical_twilight")
+	test.That(t, sunState(-40), test.ShouldEqual, "night")
+
+	lat, lng := 40.7128, -74.0060
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+	edt := func(d, h, m int) time.Time { return time.Date(2026, 7, d, h, m, 0, 0, ny) }
+
+	// Sunset ~20:18, civil dusk ~20:49, astronomical dawn ~03:54.
+	for _, tc := range []struct {
+		now   time.Time
+		event SunEvent
+		at    time.Time
+	}{
+		{edt(26, 14, 0), SunEventSunset, edt(26, 20, 18)},
+		{edt(26, 20, 30), SunEventCivilDusk, edt(26, 20, 49)},
+		{edt(26, 23, 30), SunEventAstronomicalDawn, edt(27, 3, 54)},
+	} {
+		e, at, ok := nextSunTransition(tc.now, lat, lng)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, e, test.ShouldEqual, tc.event)
+		test.That(t, within(at, tc.at, 5*time.Minute), test.ShouldBeTrue)
+	}
+
+	// The midnight sun never sets.
+	_, _, ok := nextSunTransition(time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), 78.2, 15.6)
+	test.That(t, ok, test.ShouldBeFalse)
+}
+
+func TestSunSensor(t *testing.T) {
+	ctx := context.Background()
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	conf := &SunConfig{MovementSensor: "gps", Timezone: "America/New_York"}
+	deps, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"gps"})
+	_, _, err = (&SunConfig{MovementSensor: "gps", Timezone: "Mars/Olympus"}).Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	gps := &testGPS{lat: 40.7128, lng: -74.0060}
+	res, err := newSun(ctx, resource.Dependencies{movementsensor.Named("gps"): gps},
+		resource.Config{Name: "sun", API: sensor.API, ConvertedAttributes: conf}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer res.Close(ctx)
+	s := res.(*Sun)
+	s.now = func() time.Time { return time.Date(2026, 7, 26, 20, 30, 0, 0, ny) }
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["state"], test.ShouldEqual, "civil_twilight")
+	test.That(t, readings["is_day"], test.ShouldBeFalse)
+	test.That(t, readings["next_transition"], test.ShouldEqual, "civil_dusk")
+	test.That(t, readings["minutes_to_next_transition"], test.ShouldBeBetween, 15, 25)
+	test.That(t, readings["sunrise"], test.ShouldStartWith, "2026-07-26T05:")
+	test.That(t, readings["sunset"], test.ShouldStartWith, "2026-07-26T20:")
+	test.That(t, readings["sun_elevation"], test.ShouldBeBetween, -6, -0.833)
+
+	// The boat sails east a few hundred miles: the sun has set further.
+	gps.lng = -60
+	readings, err = s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["state"], test.ShouldEqual, "nautical_twilight")
+	test.That(t, readings["longitude"], test.ShouldEqual, -60)
+
+	// "gps" reports times in the zone where the boat is.
+	gps.lng = -74.0060
+	s.timezone, s.loc = gpsTimezone, time.UTC
+	readings, err = s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["sunset"], test.ShouldStartWith, "2026-07-26T20:")
+	test.That(t, readings["sunset"], test.ShouldEndWith, "-04:00")
+}
@@ -1,11 +1,13 @@
 package verhboat
 
-// Sunrise/sunset computation using the standard "sunrise equation"
-// (https://en.wikipedia.org/wiki/Sunrise_equation). Accurate to about a
-// minute, which is plenty for scheduling a sign around dusk and dawn.
+// Sunrise/sunset, twilight and solar noon computation using the standard
+// "sunrise equation" (https://en.wikipedia.org/wiki/Sunrise_equation).
+// Accurate to about a minute, which is plenty for scheduling a sign around
+// dusk and dawn.
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"time"
 )
@@ -34,6 +36,125 @@ func julianToTime(jd float64) time.Time {
 // At high latitudes the sun may not rise or set at all; in that case it
 // returns ErrSunAlwaysDown or ErrSunAlwaysUp.
 func SunTimes(day time.Time, lat, lng float64) (sunrise, sunset time.Time, err error) {
+	return sunAltitudeTimes(day, lat, lng, sunHorizonAltitude)
+}
+
+// SunEvent is a point in the sun's day.
+type SunEvent string
+
+const (
+	SunEventAstronomicalDawn SunEvent = "astronomical_dawn"
+	SunEventNauticalDawn     SunEvent = "nautical_dawn"
+	SunEventCivilDawn        SunEvent = "civil_dawn"
+	SunEventSunrise          SunEvent = "sunrise"
+	SunEventSolarNoon        SunEvent = "solar_noon"
+	SunEventSunset           SunEvent = "sunset"
+	SunEventCivilDusk        SunEvent = "civil_dusk"
+	SunEventNauticalDusk     SunEvent = "nautical_dusk"
+	SunEventAstronomicalDusk SunEvent = "astronomical_dusk"
+)
+
+// SunEvents lists the sun events in the order they come through a day.
+var SunEvents = []SunEvent{
+	SunEventAstronomicalDawn,
+	SunEventNauticalDawn,
+	SunEventCivilDawn,
+	SunEventSunrise,
+	SunEventSolarNoon,
+	SunEventSunset,
+	SunEventCivilDusk,
+	SunEventNauticalDusk,
+	SunEventAstronomicalDusk,
+}
+
+// The sun's center at -0.833° accounts for refraction and its radius.
+const sunHorizonAltitude = -0.833
+
+// sunEventAltitudes are the altitudes (degrees) the sun crosses at each
+// event other than solar noon, and whether it's rising then.
+var sunEventAltitudes = map[SunEvent]struct {
+	altitude float64
+	rising   bool
+}{
+	SunEventAstronomicalDawn: {-18, true},
+	SunEventNauticalDawn:     {-12, true},
+	SunEventCivilDawn:        {-6, true},
+	SunEventSunrise:          {sunHorizonAltitude, true},
+	SunEventSunset:           {sunHorizonAltitude, false},
+	SunEventCivilDusk:        {-6, false},
+	SunEventNauticalDusk:     {-12, false},
+	SunEventAstronomicalDusk: {-18, false},
+}
+
+// ParseSunEvent parses a sun event name such as "civil_dusk".
+func ParseSunEvent(s string) (SunEvent, error) {
+	for _, e := range SunEvents {
+		if string(e) == s {
+			return e, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sun event %q", s)
+}
+
+// SunEventTime returns when event happens on the calendar day containing
+// day, like SunTimes. Solar noon always happens; the others return
+// ErrSunAlwaysDown or ErrSunAlwaysUp if the sun stays below or above their
+// altitude all day.
+func SunEventTime(day time.Time, lat, lng float64, event SunEvent) (time.Time, error) {
+	if event == SunEventSolarNoon {
+		jTransit, _ := solarTransit(day, lng)
+		return julianToTime(jTransit), nil
+	}
+	ev, ok := sunEventAltitudes[event]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown sun event %q", event)
+	}
+	rise, set, err := sunAltitudeTimes(day, lat, lng, ev.altitude)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ev.rising {
+		return rise, nil
+	}
+	return set, nil
+}
+
+// SolarDay is the sun's day at a place.
+type SolarDay struct {
+	// Times holds the events that happen, Errors the ones that don't
+	// (ErrSunAlwaysDown or ErrSunAlwaysUp).
+	Times  map[SunEvent]time.Time
+	Errors map[SunEvent]error
+
+	// DayLength is sunrise to sunset: 0 in polar night, 24h in polar day.
+	DayLength time.Duration
+}
+
+// SunDay returns all the SunEvents on the calendar day containing day, and
+// the day length.
+func SunDay(day time.Time, lat, lng float64) SolarDay {
+	sd := SolarDay{Times: map[SunEvent]time.Time{}, Errors: map[SunEvent]error{}}
+	for _, e := range SunEvents {
+		t, err := SunEventTime(day, lat, lng, e)
+		if err != nil {
+			sd.Errors[e] = err
+			continue
+		}
+		sd.Times[e] = t
+	}
+
+	switch sd.Errors[SunEventSunrise] {
+	case nil:
+		sd.DayLength = sd.Times[SunEventSunset].Sub(sd.Times[SunEventSunrise])
+	case ErrSunAlwaysUp:
+		sd.DayLength = 24 * time.Hour
+	}
+	return sd
+}
+
+// solarTransit returns the Julian date of solar noon on the day containing
+// day, and the sine of the sun's declination then.
+func solarTransit(day time.Time, lng float64) (jTransit, sinDec float64) {
 	// Number of days since J2000.0, for the given day.
 	n := math.Round(julianDate(day) - 2451545.0 + 0.0008)
 
@@ -53,15 +174,26 @@ func SunTimes(day time.Time, lat, lng float64) (sunrise, sunset time.Time, err e
 	lRad := lambda * sunDegRad
 
 	// Solar transit (Julian date of solar noon).
-	jTransit := 2451545.0 + jStar + 0.0053*math.Sin(mRad) - 0.0069*math.Sin(2*lRad)
+	jTransit = 2451545.0 + jStar + 0.0053*math.Sin(mRad) - 0.0069*math.Sin(2*lRad)
 
 	// Declination of the sun.
-	sinDec := math.Sin(lRad) * math.Sin(23.4397*sunDegRad)
+	sinDec = math.Sin(lRad) * math.Sin(23.4397*sunDegRad)
+
+	return jTransit, sinDec
+}
+
+// sunAltitudeTimes is SunTimes for when the sun's center crosses altitude
+// (degrees, negative below the horizon) in the morning and evening: the
+// horizon for sunrise/sunset, -6° for civil dawn/dusk, and so on.
+// ErrSunAlwaysDown and ErrSunAlwaysUp mean the sun stays below or above that
+// altitude all day.
+func sunAltitudeTimes(day time.Time, lat, lng, altitude float64) (rise, set time.Time, err error) {
+	jTransit, sinDec := solarTransit(day, lng)
 	cosDec := math.Cos(math.Asin(sinDec))
 
 	latRad := lat * sunDegRad
-	// Hour angle for the sun's center at -0.833° (accounts for refraction and radius).
-	cosOmega := (math.Sin(-0.833*sunDegRad) - math.Sin(latRad)*sinDec) / (math.Cos(latRad) * cosDec)
+	// Hour angle for the sun's center at altitude.
+	cosOmega := (math.Sin(altitude*sunDegRad) - math.Sin(latRad)*sinDec) / (math.Cos(latRad) * cosDec)
 	if cosOmega > 1 {
 		return time.Time{}, time.Time{}, ErrSunAlwaysDown
 	}
@@ -76,3 +208,62 @@ func SunTimes(day time.Time, lat, lng float64) (sunrise, sunset time.Time, err e
 
 	return julianToTime(jRise), julianToTime(jSet), nil
 }
+
+// SunPosition returns the sun's azimuth (degrees clockwise from true north)
+// and elevation (degrees above the horizon, without refraction) at time t, at
+// the given latitude and longitude (degrees, longitude positive east). Good to
+// a fraction of a degree, which is plenty for deciding which side of the boat
+// the sun is on.
+func SunPosition(t time.Time, lat, lng float64) (azimuth, elevation float64) {
+	d := julianDate(t) - 2451545.0
+	ra, dec := sunEquatorial(d)
+	return horizontalPosition(d, lat, lng, ra, dec)
+}
+
+// sunEquatorial returns the sun's right ascension and declination (radians)
+// d days after J2000.0.
+func sunEquatorial(d float64) (ra, dec float64) {
+	mRad := math.Mod(357.5291+0.98560028*d, 360) * sunDegRad
+	c := 1.9148*math.Sin(mRad) + 0.0200*math.Sin(2*mRad) + 0.0003*math.Sin(3*mRad)
+	lRad := math.Mod(mRad/sunDegRad+c+180+102.9372, 360) * sunDegRad
+	return eclipticToEquatorial(lRad, 0)
+}
+
+// eclipticToEquatorial converts ecliptic longitude and latitude to right
+// ascension and declination (all radians).
+func eclipticToEquatorial(lng, lat float64) (ra, dec float64) {
+	eRad := 23.4397 * sunDegRad
+	dec = math.Asin(math.Sin(lat)*math.Cos(eRad) + math.Cos(lat)*math.Sin(eRad)*math.Sin(lng))
+	ra = math.Atan2(math.Sin(lng)*math.Cos(eRad)-math.Tan(lat)*math.Sin(eRad), math.Cos(lng))
+	return ra, dec
+}
+
+// horizontalPosition returns the azimuth (degrees clockwise from true north)
+// and altitude (degrees) of a body at right ascension ra and declination dec
+// (radians), d days after J2000.0, seen from lat, lng.
+func horizontalPosition(d, lat, lng, ra, dec float64) (azimuth, altitude float64) {
+	// Local hour angle, from the sidereal time.
+	h := (280.16+360.9856235*d+lng)*sunDegRad - ra
+	latRad := lat * sunDegRad
+
+	altitude = math.Asin(math.Sin(latRad)*math.Sin(dec)+math.Cos(latRad)*math.Cos(dec)*math.Cos(h)) / sunDegRad
+
+	// atan2 gives the azimuth measured from south; turn it into a compass bearing.
+	az := math.Atan2(math.Sin(h), math.Cos(h)*math.Sin(latRad)-math.Tan(dec)*math.Cos(latRad)) / sunDegRad
+	azimuth = math.Mod(az+180+360, 360)
+
+	return azimuth, altitude
+}
+
+// nauticalZone returns the nautical time zone for a longitude: whole hours
+// from UTC, one per 15° band centered on the Greenwich meridian, as kept at
+// sea. It ignores national borders and daylight saving time, so ashore use
+// zoneAtPosition.
+func nauticalZone(lng float64) *time.Location {
+	hours := int(math.Round(lng / 15))
+	hours = max(-12, min(12, hours))
+	if hours == 0 {
+		return time.UTC
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%+d", hours), hours*3600)
+}
@@ -24,29 +24,225 @@ func TestSunTimes(t *testing.T) {
 	test.That(t, sunset.After(sunrise), test.ShouldBeTrue)
 }
 
+func TestSunDay(t *testing.T) {
+	// New York City, 2026-07-26. NOAA-published times, EDT (UTC-4).
+	lat, lng := 40.7128, -74.0060
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+	edt := func(d, h, m int) time.Time { return time.Date(2026, 7, d, h, m, 0, 0, ny) }
+
+	day := SunDay(time.Date(2026, 7, 26, 12, 0, 0, 0, time.UTC), lat, lng)
+	test.That(t, day.Errors, test.ShouldBeEmpty)
+	for e, want := range map[SunEvent]time.Time{
+		SunEventAstronomicalDawn: edt(26, 3, 54),
+		SunEventNauticalDawn:     edt(26, 4, 37),
+		SunEventCivilDawn:        edt(26, 5, 20),
+		SunEventSunrise:          edt(26, 5, 53),
+		SunEventSolarNoon:        edt(26, 13, 3),
+		SunEventSunset:           edt(26, 20, 15),
+		SunEventCivilDusk:        edt(26, 20, 47),
+		SunEventNauticalDusk:     edt(26, 21, 25),
+		SunEventAstronomicalDusk: edt(26, 22, 8),
+	} {
+		test.That(t, within(day.Times[e], want, 10*time.Minute), test.ShouldBeTrue)
+	}
+	for i := 1; i < len(SunEvents); i++ {
+		test.That(t, day.Times[SunEvents[i]].After(day.Times[SunEvents[i-1]]), test.ShouldBeTrue)
+	}
+	test.That(t, day.DayLength, test.ShouldAlmostEqual, 14*time.Hour+22*time.Minute, 10*time.Minute)
+
+	// Tromsø at midsummer: the sun never sets, but it still has a noon.
+	day = SunDay(time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), 69.65, 18.96)
+	test.That(t, day.Errors[SunEventSunrise], test.ShouldEqual, ErrSunAlwaysUp)
+	test.That(t, day.Errors[SunEventAstronomicalDusk], test.ShouldEqual, ErrSunAlwaysUp)
+	test.That(t, day.Times[SunEventSolarNoon].Hour(), test.ShouldEqual, 10)
+	test.That(t, day.DayLength, test.ShouldEqual, 24*time.Hour)
+
+	// ... and at midwinter it never rises, though there's civil twilight.
+	day = SunDay(time.Date(2026, 12, 21, 12, 0, 0, 0, time.UTC), 69.65, 18.96)
+	test.That(t, day.Errors[SunEventSunset], test.ShouldEqual, ErrSunAlwaysDown)
+	test.That(t, day.Errors[SunEventCivilDawn], test.ShouldBeNil)
+	test.That(t, day.DayLength, test.ShouldEqual, 0)
+
+	_, err = ParseSunEvent("dusk")
+	test.That(t, err, test.ShouldNotBeNil)
+	e, err := ParseSunEvent("astronomical_dusk")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, e, test.ShouldEqual, SunEventAstronomicalDusk)
+}
+
 func TestDesiredOn(t *testing.T) {
 	// NYC location.
 	lat, lng := 40.7128, -74.0060
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+
+	rules := func(conf NicolaudieStick3Config) sunOnRules {
+		r, err := conf.onRules()
+		test.That(t, err, test.ShouldBeNil)
+		return r
+	}
+	defaults := rules(NicolaudieStick3Config{})
+	edt := func(d, h, m int) time.Time { return time.Date(2026, 7, d, h, m, 0, 0, ny) }
+
+	for _, tc := range []struct {
+		name  string
+		rules sunOnRules
+		now   time.Time
+		want  bool
+	}{
+		{"afternoon", defaults, edt(26, 15, 0), false},
+		{"lead-in to sunset", defaults, edt(26, 19, 30), true},
+		{"late evening", defaults, edt(26, 22, 0), true},
+		{"pre-dawn", defaults, edt(26, 4, 0), true},
+		{"after sunrise", defaults, edt(26, 6, 15), false},
+
+		// Sunset ~20:18, civil dusk ~20:49, nautical dusk ~21:28.
+		{"before civil dusk", rules(NicolaudieStick3Config{OnAt: "civil_dusk"}), edt(26, 20, 30), false},
+		{"after civil dusk", rules(NicolaudieStick3Config{OnAt: "civil_dusk"}), edt(26, 21, 5), true},
+		{"before nautical dusk", rules(NicolaudieStick3Config{OnAt: "nautical_dusk"}), edt(26, 21, 5), false},
+		{"after nautical dusk", rules(NicolaudieStick3Config{OnAt: "nautical_dusk-10m"}), edt(26, 21, 25), true},
+
+		{"before off_at", rules(NicolaudieStick3Config{OffAt: "23:30"}), edt(26, 23, 15), true},
+		{"after off_at", rules(NicolaudieStick3Config{OffAt: "23:30"}), edt(26, 23, 45), false},
+		{"off_at holds overnight", rules(NicolaudieStick3Config{OffAt: "23:30"}), edt(27, 4, 0), false},
 
-	// Mid-afternoon: off.
-	afternoon := time.Date(2026, 7, 26, 19, 0, 0, 0, time.UTC) // 15:00 EDT
-	on, err := desiredOn(afternoon, lat, lng)
+		// On at ~19:18, so off at ~22:18.
+		{"within off_after_hours", rules(NicolaudieStick3Config{OffAfterHours: 3}), edt(26, 22, 0), true},
+		{"past off_after_hours", rules(NicolaudieStick3Config{OffAfterHours: 3}), edt(26, 22, 30), false},
+		{"off_at before off_after_hours", rules(NicolaudieStick3Config{OffAt: "23:30", OffAfterHours: 6}), edt(26, 23, 45), false},
+		{"clock times", rules(NicolaudieStick3Config{OnAt: "18:00", OffAt: "20:00"}), edt(26, 19, 0), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			on, err := desiredOn(tc.now, tc.rules, ny, lat, lng)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, on, test.ShouldEqual, tc.want)
+		})
+	}
+
+	// At 60°N at midsummer it never gets nautically dark, but civil dusk comes.
+	midnight := time.Date(2026, 6, 21, 0, 30, 0, 0, time.UTC)
+	on, err := desiredOn(midnight, rules(NicolaudieStick3Config{OnAt: "nautical_dusk"}), time.UTC, 60, 0)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, on, test.ShouldBeFalse)
-
-	// Late evening (well after sunset): on.
-	evening := time.Date(2026, 7, 27, 2, 0, 0, 0, time.UTC) // 22:00 EDT
-	on, err = desiredOn(evening, lat, lng)
+	on, err = desiredOn(midnight, rules(NicolaudieStick3Config{OnAt: "civil_dusk"}), time.UTC, 60, 0)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, on, test.ShouldBeTrue)
 
-	// Pre-dawn (before sunrise): on.
-	predawn := time.Date(2026, 7, 26, 8, 0, 0, 0, time.UTC) // 04:00 EDT
-	on, err = desiredOn(predawn, lat, lng)
+	// Polar night: on all day.
+	on, err = desiredOn(time.Date(2026, 12, 21, 12, 0, 0, 0, time.UTC), defaults, time.UTC, 80, 0)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, on, test.ShouldBeTrue)
 }
 
+func TestDesiredOnAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	test.That(t, err, test.ShouldBeNil)
+	rules, err := makeSunOnRules("07:00", "23:00", 0)
+	test.That(t, err, test.ShouldBeNil)
+
+	// The clocks go forward at 02:00 on 2026-03-08 and back on 2026-11-01;
+	// 07:00 is still 07:00 on the wall.
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 3, 8, 6, 45, 0, 0, ny), false},
+		{time.Date(2026, 3, 8, 7, 15, 0, 0, ny), true},
+		{time.Date(2026, 3, 8, 22, 45, 0, 0, ny), true},
+		{time.Date(2026, 3, 8, 23, 15, 0, 0, ny), false},
+		{time.Date(2026, 11, 1, 6, 15, 0, 0, ny), false},
+		{time.Date(2026, 11, 1, 7, 15, 0, 0, ny), true},
+		{time.Date(2026, 11, 1, 22, 45, 0, 0, ny), true},
+		{time.Date(2026, 11, 1, 23, 15, 0, 0, ny), false},
+	} {
+		on, err := desiredOn(tc.at, rules, ny, 40.7128, -74.0060)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldEqual, tc.want)
+	}
+}
+
+func TestNauticalZone(t *testing.T) {
+	// Mid-Atlantic, and at sea there's no daylight saving.
+	_, offset := time.Date(2026, 7, 26, 12, 0, 0, 0, nauticalZone(-45.2)).Zone()
+	test.That(t, offset, test.ShouldEqual, -3*3600)
+	_, offset = time.Date(2026, 7, 26, 12, 0, 0, 0, nauticalZone(7.4)).Zone()
+	test.That(t, offset, test.ShouldEqual, 0)
+	_, offset = time.Date(2026, 7, 26, 12, 0, 0, 0, nauticalZone(179.9)).Zone()
+	test.That(t, offset, test.ShouldEqual, 12*3600)
+	test.That(t, nauticalZone(-64.7).String(), test.ShouldEqual, "UTC-4")
+}
+
+func TestZoneAtPosition(t *testing.T) {
+	for _, tc := range []struct {
+		lat, lng float64
+		jan, jul int // UTC offsets in hours
+		name     string
+	}{
+		{40.7128, -74.0060, -5, -4, "America/New_York"},
+		{25.77, -80.13, -5, -4, "America/New_York"}, // Miami Beach
+		{43.2965, 5.3698, 1, 2, "Europe/Paris"},
+		{-33.8688, 151.2093, 11, 10, "Australia/Sydney"},
+		{39, -65, -4, -4, "UTC-4"}, // offshore: nautical time
+	} {
+		loc := zoneAtPosition(tc.lat, tc.lng)
+		test.That(t, loc.String(), test.ShouldEqual, tc.name)
+		_, offset := time.Date(2026, 1, 15, 12, 0, 0, 0, loc).Zone()
+		test.That(t, offset, test.ShouldEqual, tc.jan*3600)
+		_, offset = time.Date(2026, 7, 15, 12, 0, 0, 0, loc).Zone()
+		test.That(t, offset, test.ShouldEqual, tc.jul*3600)
+	}
+	test.That(t, zoneAt(gpsTimezone, time.UTC, 40.7128, -74.0060).String(), test.ShouldEqual, "America/New_York")
+	test.That(t, zoneAt("America/Chicago", time.UTC, 40.7128, -74.0060), test.ShouldEqual, time.UTC)
+
+	// Clock times follow daylight saving: off at 23:30 means 23:30 EDT in New
+	// York in July, not 23:30 in the nautical UTC-5.
+	rules, err := makeSunOnRules("18:00", "23:30", 0)
+	test.That(t, err, test.ShouldBeNil)
+	lat, lng := 40.7128, -74.0060
+	for _, tc := range []struct {
+		utc  time.Time
+		want bool
+	}{
+		{time.Date(2026, 7, 26, 21, 45, 0, 0, time.UTC), false}, // 17:45 EDT
+		{time.Date(2026, 7, 26, 22, 15, 0, 0, time.UTC), true},  // 18:15 EDT
+		{time.Date(2026, 7, 27, 3, 15, 0, 0, time.UTC), true},   // 23:15 EDT
+		{time.Date(2026, 7, 27, 3, 45, 0, 0, time.UTC), false},  // 23:45 EDT
+	} {
+		on, err := desiredOn(tc.utc, rules, zoneAt(gpsTimezone, time.UTC, lat, lng), lat, lng)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldEqual, tc.want)
+	}
+}
+
+func TestSunPosition(t *testing.T) {
+	// New York City, 2026-07-26. Solar noon is ~13:01 EDT (17:01 UTC), when
+	// the sun is due south at ~68.9° (90 - 40.7 + 19.5 declination).
+	lat, lng := 40.7128, -74.0060
+
+	az, el := SunPosition(time.Date(2026, 7, 26, 17, 1, 0, 0, time.UTC), lat, lng)
+	test.That(t, az, test.ShouldAlmostEqual, 180, 2)
+	test.That(t, el, test.ShouldAlmostEqual, 68.9, 1)
+
+	// Mid-morning the sun is in the east, mid-afternoon in the west.
+	az, el = SunPosition(time.Date(2026, 7, 26, 13, 0, 0, 0, time.UTC), lat, lng)
+	test.That(t, az, test.ShouldBeBetween, 90, 135)
+	test.That(t, el, test.ShouldBeBetween, 30, 50)
+
+	az, _ = SunPosition(time.Date(2026, 7, 26, 21, 0, 0, 0, time.UTC), lat, lng)
+	test.That(t, az, test.ShouldBeBetween, 225, 290)
+
+	// At sunrise the sun is on the horizon.
+	sunrise, _, err := SunTimes(time.Date(2026, 7, 26, 12, 0, 0, 0, time.UTC), lat, lng)
+	test.That(t, err, test.ShouldBeNil)
+	_, el = SunPosition(sunrise, lat, lng)
+	test.That(t, el, test.ShouldAlmostEqual, -0.833, 0.5)
+
+	// Middle of the night: well below the horizon.
+	_, el = SunPosition(time.Date(2026, 7, 27, 5, 0, 0, 0, time.UTC), lat, lng)
+	test.That(t, el, test.ShouldBeLessThan, -10)
+}
+
 func within(a, b time.Time, tol time.Duration) bool {
 	d := a.Sub(b)
 	if d < 0 {
@@ -3,15 +3,18 @@ package verhboat
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"go.uber.org/multierr"
-
 	"go.viam.com/rdk/components/switch"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
@@ -29,22 +32,117 @@ func init() {
 }
 
 type TahomaConfig struct {
-	Host   string
-	ApiKey string `json:"api-key"`
+	TahomaGatewayConfig `json:",squash"`
+
+	// Positions are the switch positions, in order. Each one runs its steps
+	// against its devices when selected. Without any, the switch has
+	// tahomaDefaultPositions.
+	Positions []TahomaPosition `json:"positions,omitempty"`
+}
+
+// tahomaDefaultPositions are the positions tahoma-hack had before they could
+// be configured, so configs from then keep working.
+var tahomaDefaultPositions = []TahomaPosition{
+	{Name: "unknown"},
+	{Name: "open", Devices: []string{"Port forward", "Port mid"}, Steps: []TahomaStep{{Command: "up"}}},
+	{Name: "port", Devices: []string{"Port forward", "Port mid"}, Steps: []TahomaStep{
+		{Command: "down"},
+		{Command: "tilt", Parameters: []interface{}{8, 1}},
+	}},
+}
+
+func (tc *TahomaConfig) positions() []TahomaPosition {
+	if len(tc.Positions) == 0 {
+		return tahomaDefaultPositions
+	}
+	return tc.Positions
+}
+
+// TahomaPosition is one named switch position.
+type TahomaPosition struct {
+	Name string `json:"name"`
+
+	// Devices are the labels of the devices the steps apply to.
+	Devices []string `json:"devices,omitempty"`
+
+	Steps []TahomaStep `json:"steps,omitempty"`
+}
+
+// TahomaStep is one step of a position. Command is either "wait" (sleep for
+// Seconds), "setClosure" (with Percent, 0 = open, 100 = closed), "tilt" (an
+// alias for tiltPositive), or any other Somfy command name such as "up",
+// "down" or "tiltNegative", sent with Parameters. A step is sent to every
+// device of its position, in order, unless it lists its own Devices.
+type TahomaStep struct {
+	Command    string        `json:"command"`
+	Parameters []interface{} `json:"parameters,omitempty"`
+	Percent    *float64      `json:"percent,omitempty"`
+	Seconds    float64       `json:"seconds,omitempty"`
+	Devices    []string      `json:"devices,omitempty"`
 }
 
 func (tc *TahomaConfig) Validate(path string) ([]string, []string, error) {
-	if tc.Host == "" {
-		return nil, nil, fmt.Errorf("need a host")
+	if err := tc.TahomaGatewayConfig.validate(); err != nil {
+		return nil, nil, err
 	}
 
-	if tc.ApiKey == "" {
-		return nil, nil, fmt.Errorf("need an api-key")
+	seen := map[string]bool{}
+	for i, p := range tc.Positions {
+		if p.Name == "" {
+			return nil, nil, fmt.Errorf("position %d needs a name", i)
+		}
+		if seen[p.Name] {
+			return nil, nil, fmt.Errorf("duplicate position name [%s]", p.Name)
+		}
+		seen[p.Name] = true
+
+		for j, step := range p.Steps {
+			if err := step.validate(len(p.Devices) > 0); err != nil {
+				return nil, nil, fmt.Errorf("position [%s] step %d: %w", p.Name, j, err)
+			}
+		}
 	}
 
 	return []string{}, nil, nil
 }
 
+func (s *TahomaStep) validate(positionHasDevices bool) error {
+	switch s.Command {
+	case "":
+		return fmt.Errorf("need a command")
+	case "wait":
+		if s.Seconds <= 0 {
+			return fmt.Errorf("wait needs positive seconds")
+		}
+		return nil
+	case "setClosure":
+		if s.Percent == nil || *s.Percent < 0 || *s.Percent > 100 {
+			return fmt.Errorf("setClosure needs a percent between 0 and 100")
+		}
+	}
+
+	if !positionHasDevices && len(s.Devices) == 0 {
+		return fmt.Errorf("%s needs devices", s.Command)
+	}
+	return nil
+}
+
+// command returns the Somfy command for a non-wait step.
+func (s *TahomaStep) command() Command {
+	params := s.Parameters
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	switch s.Command {
+	case "setClosure":
+		return Command{Name: "setClosure", Parameters: []interface{}{int(*s.Percent)}}
+	case "tilt":
+		return Command{Name: "tiltPositive", Parameters: params}
+	}
+	return Command{Name: s.Command, Parameters: params}
+}
+
 type TahomaClient struct {
 	resource.AlwaysRebuild
 
@@ -54,16 +152,68 @@ type TahomaClient struct {
 
 	httpClient *http.Client
 
-	devices      map[string]Device
+	hostMu        sync.Mutex
+	host          string
+	port          int
+	discoveredPin string
+
+	// discover is discoverGateway, replaced in tests.
+	discover           func(ctx context.Context, conf *TahomaGatewayConfig, logger logging.Logger) (TahomaGateway, error)
+	rediscoverMu       sync.Mutex
+	rediscoverInterval time.Duration
+	lastRediscover     time.Time
+	lastRediscoverErr  error
+
+	devicesMu    sync.Mutex
+	devices      map[string]Device // by label
 	lastPosition uint32
+
+	eventPoll    time.Duration
+	eventsMu     sync.Mutex
+	listenerID   string
+	execStates   map[string]tahomaExecState
+	awaiting     map[string]struct{} // execIds someone will wait on
+	execChanged  chan struct{}       // closed and replaced whenever execStates changes
+	eventsCancel context.CancelFunc
+	eventsWg     sync.WaitGroup
 }
 
 // ------
 // these are all part of the API
 
 type Device struct {
-	DeviceURL string `json:"deviceURL"`
-	Label     string `json:"label"`
+	DeviceURL        string           `json:"deviceURL"`
+	Label            string           `json:"label"`
+	ControllableName string           `json:"controllableName"`
+	Available        bool             `json:"available"`
+	Enabled          bool             `json:"enabled"`
+	Definition       DeviceDefinition `json:"definition"`
+	States           []DeviceState    `json:"states"`
+}
+
+type DeviceDefinition struct {
+	Commands   []CommandDefinition `json:"commands"`
+	States     []StateDefinition   `json:"states"`
+	WidgetName string              `json:"widgetName"`
+	UIClass    string              `json:"uiClass"`
+	Type       string              `json:"type"`
+}
+
+type CommandDefinition struct {
+	CommandName string `json:"commandName"`
+	Nparams     int    `json:"nparams"`
+}
+
+type StateDefinition struct {
+	QualifiedName string   `json:"qualifiedName"`
+	Type          string   `json:"type,omitempty"`
+	Values        []string `json:"values,omitempty"`
+}
+
+type DeviceState struct {
+	Name  string      `json:"name"`
+	Type  int         `json:"type"`
+	Value interface{} `json:"value"`
 }
 
 type Command struct {
@@ -85,6 +235,41 @@ type ExecutionResponse struct {
 	ExecID string `json:"execId"`
 }
 
+// CommandDefinition returns the definition of the named command, if the
+// device has it.
+func (d Device) CommandDefinition(name string) (CommandDefinition, bool) {
+	for _, c := range d.Definition.Commands {
+		if c.CommandName == name {
+			return c, true
+		}
+	}
+	return CommandDefinition{}, false
+}
+
+// ValidateCommand checks a command against the device's definition: the
+// device must have it, and it can't be given more parameters than it takes.
+// Devices whose definition lists no commands aren't checked.
+func (d Device) ValidateCommand(cmd Command) error {
+	if len(d.Definition.Commands) == 0 {
+		return nil
+	}
+	def, ok := d.CommandDefinition(cmd.Name)
+	if !ok {
+		return fmt.Errorf("device [%s] (%s) doesn't support %s", d.Label, d.Definition.UIClass, cmd.Name)
+	}
+	if len(cmd.Parameters) > def.Nparams {
+		return fmt.Errorf("device [%s]: %s takes %d parameters, got %d", d.Label, cmd.Name, def.Nparams, len(cmd.Parameters))
+	}
+	return nil
+}
+
+// ActionGroup is a scenario defined in the TaHoma app.
+type ActionGroup struct {
+	OID     string   `json:"oid"`
+	Label   string   `json:"label"`
+	Actions []Action `json:"actions"`
+}
+
 // --- end api ---
 
 func newTahomaHack(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
@@ -98,44 +283,189 @@ func newTahomaHack(ctx context.Context, deps resource.Dependencies, rawConf reso
 
 func NewTahomaClient(conf *TahomaConfig, name resource.Name, logger logging.Logger) (*TahomaClient, error) {
 	tc := &TahomaClient{
-		name: name,
-		conf: conf,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-				DisableKeepAlives: true,
-			},
-		},
-		devices: map[string]Device{},
-		logger:  logger,
+		name:               name,
+		conf:               conf,
+		host:               conf.Host,
+		port:               tahomaDefaultPort,
+		discover:           discoverGateway,
+		rediscoverInterval: tahomaRediscoverInterval,
+		eventPoll:          tahomaEventPollInterval,
+		devices:            map[string]Device{},
+		logger:             logger,
+		execStates:         map[string]tahomaExecState{},
+		awaiting:           map[string]struct{}{},
+		execChanged:        make(chan struct{}),
 	}
 
-	devices, err := tc.GetDevices()
+	tlsConfig, err := conf.tlsConfig(tc.certName, logger)
 	if err != nil {
 		return nil, err
 	}
+	if conf.Insecure && conf.CACert == "" && conf.CertFingerprint == "" {
+		logger.Warnf("insecure is set; not verifying the TaHoma gateway's certificate")
+	}
+	tc.httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		},
+	}
 
-	for _, d := range devices {
-		tc.devices[d.Label] = d
+	if h, p, err := net.SplitHostPort(conf.Host); err == nil {
+		if port, err := strconv.Atoi(p); err == nil {
+			tc.host, tc.port = h, port
+		}
+	}
+
+	if tc.host == "" {
+		if err := tc.rediscover(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tc.refreshDevices(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range conf.Positions {
+		if _, err := tc.labelsToUrls(p.Devices); err != nil {
+			return nil, fmt.Errorf("position [%s]: %w", p.Name, err)
+		}
+		for i, step := range p.Steps {
+			if step.Command == "wait" {
+				continue
+			}
+			labels := step.Devices
+			if len(labels) == 0 {
+				labels = p.Devices
+			}
+			urls, err := tc.labelsToUrls(labels)
+			if err != nil {
+				return nil, fmt.Errorf("position [%s]: %w", p.Name, err)
+			}
+			if err := tc.validateCommands(urls, []Command{step.command()}); err != nil {
+				return nil, fmt.Errorf("position [%s] step %d: %w", p.Name, i, err)
+			}
+		}
 	}
 
 	return tc, nil
 }
 
+// rediscover looks the gateway up with mDNS and switches to its address.
+func (c *TahomaClient) rediscover() error {
+	g, err := c.discover(context.Background(), &c.conf.TahomaGatewayConfig, c.logger)
+	if err != nil {
+		return err
+	}
+
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+	if g.Host() != c.host || g.Port != c.port {
+		c.logger.Infof("using TaHoma gateway %s at %s:%d", g.Pin, g.Host(), g.Port)
+	}
+	c.host = g.Host()
+	c.port = g.Port
+	c.discoveredPin = g.Pin
+	return nil
+}
+
+// rediscoverAfter is rediscover for a request that started at started and
+// couldn't reach the gateway. Requests failing together share one lookup,
+// and none starts within rediscoverInterval of the last, so a gateway that's
+// off isn't browsed for on every event poll. retry is whether the request
+// should be tried again.
+func (c *TahomaClient) rediscoverAfter(started time.Time) (retry bool, err error) {
+	c.rediscoverMu.Lock()
+	defer c.rediscoverMu.Unlock()
+
+	if c.lastRediscover.After(started) {
+		// Looked up while this request was failing; use that answer.
+		return c.lastRediscoverErr == nil, c.lastRediscoverErr
+	}
+	if !c.lastRediscover.IsZero() && time.Since(c.lastRediscover) < c.rediscoverInterval {
+		return false, nil
+	}
+
+	c.logger.Infof("TaHoma gateway at %s unreachable, rediscovering", c.Host())
+	err = c.rediscover()
+	c.lastRediscover, c.lastRediscoverErr = time.Now(), err
+	return err == nil, err
+}
+
+// certName is the name the gateway's certificate must be for: from
+// gateway-pin, the PIN discovery found, or host if it's a name.
+func (c *TahomaClient) certName() string {
+	if c.conf.GatewayPin != "" {
+		return gatewayCertName(c.conf.GatewayPin)
+	}
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+	if c.discoveredPin != "" {
+		return gatewayCertName(c.discoveredPin)
+	}
+	return gatewayNameFromHost(c.host)
+}
+
+// Host returns the gateway address the client is currently using.
+func (c *TahomaClient) Host() string {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+	return c.host
+}
+
 func (c *TahomaClient) makeRequest(method, endpoint string, body interface{}) ([]byte, error) {
-	var reqBody io.Reader
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request: %w", err)
 		}
+	}
+
+	started := time.Now()
+	respBody, err := c.doRequest(method, endpoint, jsonData)
+	var netErr *tahomaConnError
+	if errors.As(err, &netErr) && c.conf.canRediscover() {
+		// The gateway may have a new DHCP address; look for it and retry once.
+		retry, discErr := c.rediscoverAfter(started)
+		if discErr != nil {
+			return nil, fmt.Errorf("%w (rediscovery failed: %v)", err, discErr)
+		}
+		if retry {
+			return c.doRequest(method, endpoint, jsonData)
+		}
+	}
+	return respBody, err
+}
+
+// tahomaConnError is a failure to reach the gateway at all, as opposed to an
+// error response from it.
+type tahomaConnError struct {
+	err error
+}
+
+func (e *tahomaConnError) Error() string {
+	return fmt.Sprintf("request failed: %v", e.err)
+}
+
+func (e *tahomaConnError) Unwrap() error {
+	return e.err
+}
+
+func (c *TahomaClient) doRequest(method, endpoint string, jsonData []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if jsonData != nil {
 		reqBody = bytes.NewBuffer(jsonData)
 	}
 
-	req, err := http.NewRequest(method, fmt.Sprintf("https://%s:8443/enduser-mobile-web/1/enduserAPI%s", c.conf.Host, endpoint), reqBody)
+	c.hostMu.Lock()
+	base := fmt.Sprintf("https://%s/enduser-mobile-web/1/enduserAPI", net.JoinHostPort(c.host, strconv.Itoa(c.port)))
+	c.hostMu.Unlock()
+
+	req, err := http.NewRequest(method, base+endpoint, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -145,7 +475,11 @@ func (c *TahomaClient) makeRequest(method, endpoint string, body interface{}) ([
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		var certErr *tahomaCertError
+		if errors.As(err, &certErr) {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		return nil, &tahomaConnError{err}
 	}
 	defer resp.Body.Close()
 
@@ -167,8 +501,6 @@ func (c *TahomaClient) GetDevices() ([]Device, error) {
 		return nil, err
 	}
 
-	//fmt.Printf("%s\n", string(respBody)) // TODO - add more things to Device
-
 	var devices []Device
 	if err := json.Unmarshal(respBody, &devices); err != nil {
 		return nil, fmt.Errorf("failed to parse devices: %w", err)
@@ -177,7 +509,105 @@ func (c *TahomaClient) GetDevices() ([]Device, error) {
 	return devices, nil
 }
 
+// GetDeviceStates returns the current states of one device, e.g.
+// core:ClosureState and core:SlateOrientationState for a shade.
+func (c *TahomaClient) GetDeviceStates(deviceURL string) ([]DeviceState, error) {
+	respBody, err := c.makeRequest("GET", "/setup/devices/"+url.QueryEscape(deviceURL)+"/states", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []DeviceState
+	if err := json.Unmarshal(respBody, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse device states: %w", err)
+	}
+
+	return states, nil
+}
+
+// refreshDevices reloads the gateway's devices, so ones paired since the
+// client was made can be found.
+func (c *TahomaClient) refreshDevices() ([]Device, error) {
+	devices, err := c.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	byLabel := make(map[string]Device, len(devices))
+	for _, d := range devices {
+		byLabel[d.Label] = d
+	}
+	c.devicesMu.Lock()
+	c.devices = byLabel
+	c.devicesMu.Unlock()
+	return devices, nil
+}
+
+// FindDevice looks a device up by label, or by deviceURL if it looks like one.
+// A device the client doesn't know yet is looked for again on the gateway.
+func (c *TahomaClient) FindDevice(labelOrURL string) (Device, error) {
+	find := func() (Device, bool) {
+		if strings.Contains(labelOrURL, "://") {
+			return c.deviceByURL(labelOrURL)
+		}
+		return c.deviceByLabel(labelOrURL)
+	}
+	if d, ok := find(); ok {
+		return d, nil
+	}
+	if _, err := c.refreshDevices(); err != nil {
+		return Device{}, err
+	}
+	if d, ok := find(); ok {
+		return d, nil
+	}
+	if strings.Contains(labelOrURL, "://") {
+		return Device{}, fmt.Errorf("no device with url [%s]", labelOrURL)
+	}
+	return Device{}, fmt.Errorf("no device called [%s]", labelOrURL)
+}
+
+func (c *TahomaClient) deviceByLabel(label string) (Device, bool) {
+	c.devicesMu.Lock()
+	defer c.devicesMu.Unlock()
+	d, ok := c.devices[label]
+	return d, ok
+}
+
+func (c *TahomaClient) deviceByURL(deviceURL string) (Device, bool) {
+	c.devicesMu.Lock()
+	defer c.devicesMu.Unlock()
+	for _, d := range c.devices {
+		if d.DeviceURL == deviceURL {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// validateCommands checks commands against each device's definition, so a
+// command a device doesn't have (say tiltPositive on a roller shade) is
+// caught before anything is sent. Devices the client doesn't know about are
+// left for the gateway to judge.
+func (c *TahomaClient) validateCommands(deviceURLs []string, commands []Command) error {
+	for _, u := range deviceURLs {
+		d, ok := c.deviceByURL(u)
+		if !ok {
+			continue
+		}
+		for _, cmd := range commands {
+			if err := d.ValidateCommand(cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *TahomaClient) ExecuteCommands(deviceURL string, commands []Command, label string) (string, error) {
+	if err := c.validateCommands([]string{deviceURL}, commands); err != nil {
+		return "", err
+	}
+
 	execReq := ExecutionRequest{
 		Label: label,
 		Actions: []Action{
@@ -203,15 +633,57 @@ func (c *TahomaClient) ExecuteCommands(deviceURL string, commands []Command, lab
 	return execResp.ExecID, nil
 }
 
-func (c *TahomaClient) LiftShadeByLabel(label string) error {
-	d, ok := c.devices[label]
+// GetScenarios returns the scenarios (action groups) defined on the gateway.
+func (c *TahomaClient) GetScenarios() ([]ActionGroup, error) {
+	respBody, err := c.makeRequest("GET", "/actionGroups", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []ActionGroup
+	if err := json.Unmarshal(respBody, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse scenarios: %w", err)
+	}
+	return groups, nil
+}
+
+// FindScenario looks a scenario up by label or oid.
+func (c *TahomaClient) FindScenario(labelOrOID string) (ActionGroup, error) {
+	groups, err := c.GetScenarios()
+	if err != nil {
+		return ActionGroup{}, err
+	}
+	for _, g := range groups {
+		if g.Label == labelOrOID || g.OID == labelOrOID {
+			return g, nil
+		}
+	}
+	return ActionGroup{}, fmt.Errorf("no scenario called [%s]", labelOrOID)
+}
+
+// ExecuteScenario starts a scenario by oid and returns its execId.
+func (c *TahomaClient) ExecuteScenario(oid string) (string, error) {
+	respBody, err := c.makeRequest("POST", "/exec/"+url.PathEscape(oid), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var execResp ExecutionResponse
+	if err := json.Unmarshal(respBody, &execResp); err != nil {
+		return "", fmt.Errorf("failed to parse execution response: %w", err)
+	}
+	return execResp.ExecID, nil
+}
+
+func (c *TahomaClient) LiftShadeByLabel(ctx context.Context, label string) error {
+	d, ok := c.deviceByLabel(label)
 	if !ok {
 		return fmt.Errorf("no device called [%s]", label)
 	}
-	return c.LiftShadeByUrl(d.DeviceURL)
+	return c.LiftShadeByUrl(ctx, d.DeviceURL)
 }
 
-func (c *TahomaClient) LiftShadeByUrl(deviceURL string) error {
+func (c *TahomaClient) LiftShadeByUrl(ctx context.Context, deviceURL string) error {
 	commands := []Command{
 		{
 			Name:       "up",
@@ -219,16 +691,16 @@ func (c *TahomaClient) LiftShadeByUrl(deviceURL string) error {
 		},
 	}
 
-	_, err := c.ExecuteCommands(deviceURL, commands, "Raise shade")
+	_, err := c.ExecuteAndWait(ctx, []string{deviceURL}, commands, "Raise shade")
 	return err
 }
 
-func (c *TahomaClient) LowerAndTiltShadeByLabels(labels []string) error {
+func (c *TahomaClient) LowerAndTiltShadeByLabels(ctx context.Context, labels []string) error {
 	urls, err := c.labelsToUrls(labels)
 	if err != nil {
 		return err
 	}
-	return c.LowerAndTiltShadeByUrls(urls)
+	return c.LowerAndTiltShadeByUrls(ctx, urls)
 
 }
 
@@ -236,9 +708,9 @@ func (c *TahomaClient) labelsToUrls(labels []string) ([]string, error) {
 	urls := []string{}
 
 	for _, l := range labels {
-		d, ok := c.devices[l]
-		if !ok {
-			return nil, fmt.Errorf("no device called [%s]", l)
+		d, err := c.FindDevice(l)
+		if err != nil {
+			return nil, err
 		}
 		urls = append(urls, d.DeviceURL)
 	}
@@ -246,7 +718,7 @@ func (c *TahomaClient) labelsToUrls(labels []string) ([]string, error) {
 	return urls, nil
 }
 
-func (c *TahomaClient) LowerAndTiltShadeByUrls(urls []string) error {
+func (c *TahomaClient) LowerAndTiltShadeByUrls(ctx context.Context, urls []string) error {
 	commands := []Command{
 		{
 			Name:       "down",
@@ -254,15 +726,6 @@ func (c *TahomaClient) LowerAndTiltShadeByUrls(urls []string) error {
 		},
 	}
 
-	for _, u := range urls {
-		_, err := c.ExecuteCommands(u, commands, "Lower shade")
-		if err != nil {
-			return fmt.Errorf("failed to lower shade (url: %s): %w", u, err)
-		}
-	}
-
-	time.Sleep(20 * time.Second) // Wait for the shade(s) to fully lower
-
 	tiltCommands := []Command{
 		{
 			Name:       "tiltPositive",
@@ -270,17 +733,22 @@ func (c *TahomaClient) LowerAndTiltShadeByUrls(urls []string) error {
 		},
 	}
 
-	for _, u := range urls {
-		_, err := c.ExecuteCommands(u, tiltCommands, "Tilt shade up")
-		if err != nil {
-			return fmt.Errorf("failed to tilt shade (url: %s): %w", u, err)
-		}
+	// Don't lower shades that won't then tilt.
+	if err := c.validateCommands(urls, tiltCommands); err != nil {
+		return err
 	}
 
-	return nil
+	// Waits for the shade(s) to fully lower before tilting.
+	if _, err := c.ExecuteAndWait(ctx, urls, commands, "Lower shade"); err != nil {
+		return err
+	}
+
+	_, err := c.ExecuteAndWait(ctx, urls, tiltCommands, "Tilt shade up")
+	return err
 }
 
 func (c *TahomaClient) Close(ctx context.Context) error {
+	c.stopEvents()
 	c.httpClient.CloseIdleConnections()
 	return nil
 }
@@ -289,39 +757,172 @@ func (c *TahomaClient) Name() resource.Name {
 	return c.name
 }
 
+// DoCommand drives any device or scenario on the gateway:
+//
+//	{"command": "list_devices"}
+//	{"command": "exec", "device": "Port forward",
+//	 "commands": [{"name": "setClosure", "parameters": [40]}]}
+//	{"command": "list_scenarios"}
+//	{"command": "run_scenario", "scenario": "Night"}
+//
+// device is a label or deviceURL, scenario a label or oid. exec and
+// run_scenario wait for the execution to finish and return its "exec_id" and
+// final "state"; a FAILED execution also has a "failure". Only failing to
+// start or follow the execution is an error.
 func (c *TahomaClient) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	return map[string]interface{}{}, nil
-}
+	command, _ := cmd["command"].(string)
 
-func (c *TahomaClient) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
-	// TODO - this is all hacked for now
+	switch command {
+	case "list_devices":
+		devices, err := c.refreshDevices()
+		if err != nil {
+			return nil, err
+		}
+		res := []interface{}{}
+		for _, d := range devices {
+			commands := []interface{}{}
+			for _, c := range d.Definition.Commands {
+				commands = append(commands, c.CommandName)
+			}
+			res = append(res, map[string]interface{}{
+				"label":            d.Label,
+				"deviceURL":        d.DeviceURL,
+				"controllableName": d.ControllableName,
+				"uiClass":          d.Definition.UIClass,
+				"commands":         commands,
+			})
+		}
+		return map[string]interface{}{"devices": res}, nil
 
-	switch position {
-	case 0:
-		c.lastPosition = position
-		return nil
-	case 1:
-		err := multierr.Combine(
-			c.LiftShadeByLabel("Port forward"),
-			c.LiftShadeByLabel("Port mid"),
-		)
+	case "exec":
+		name, _ := cmd["device"].(string)
+		d, err := c.FindDevice(name)
 		if err != nil {
-			c.lastPosition = 0
-			return err
+			return nil, err
 		}
-		c.lastPosition = position
-		return nil
-	case 2:
-		err := c.LowerAndTiltShadeByLabels([]string{"Port forward", "Port mid"})
+		commands, err := parseCommands(cmd["commands"])
+		if err != nil {
+			return nil, err
+		}
+		return execResult(c.executeAndWaitState(ctx, func() (string, error) {
+			return c.ExecuteCommands(d.DeviceURL, commands, "DoCommand "+d.Label)
+		}))
+
+	case "list_scenarios":
+		groups, err := c.GetScenarios()
+		if err != nil {
+			return nil, err
+		}
+		res := []interface{}{}
+		for _, g := range groups {
+			res = append(res, map[string]interface{}{"label": g.Label, "oid": g.OID})
+		}
+		return map[string]interface{}{"scenarios": res}, nil
+
+	case "run_scenario":
+		name, _ := cmd["scenario"].(string)
+		g, err := c.FindScenario(name)
+		if err != nil {
+			return nil, err
+		}
+		return execResult(c.executeAndWaitState(ctx, func() (string, error) {
+			return c.ExecuteScenario(g.OID)
+		}))
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// parseCommands reads DoCommand's "commands": a list of {"name", "parameters"}.
+func parseCommands(raw interface{}) ([]Command, error) {
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("need a list of \"commands\"")
+	}
+
+	commands := []Command{}
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("command %d must be an object", i)
+		}
+		name, _ := m["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("command %d needs a name", i)
+		}
+		params := []interface{}{}
+		if p, ok := m["parameters"]; ok {
+			params, ok = p.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("command %d parameters must be a list", i)
+			}
+		}
+		commands = append(commands, Command{Name: name, Parameters: params})
+	}
+	return commands, nil
+}
+
+func execResult(execID string, st tahomaExecState, err error) (map[string]interface{}, error) {
+	if err != nil {
+		if execID != "" {
+			return nil, fmt.Errorf("execution %s: %w", execID, err)
+		}
+		return nil, err
+	}
+	res := map[string]interface{}{"exec_id": execID, "state": st.state}
+	if st.state == tahomaExecFailed {
+		res["failure"] = st.failureType
+	}
+	return res, nil
+}
+
+// runPosition runs each step of a position in order.
+func (c *TahomaClient) runPosition(ctx context.Context, p TahomaPosition) error {
+	for i, step := range p.Steps {
+		if step.Command == "wait" {
+			t := time.NewTimer(time.Duration(step.Seconds * float64(time.Second)))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+			continue
+		}
+
+		labels := step.Devices
+		if len(labels) == 0 {
+			labels = p.Devices
+		}
+		urls, err := c.labelsToUrls(labels)
 		if err != nil {
-			c.lastPosition = 0
 			return err
 		}
-		c.lastPosition = position
-		return nil
+
+		// Each step runs on all its devices at once, and the next step only
+		// starts once they have all finished.
+		cmd := step.command()
+		if _, err := c.ExecuteAndWait(ctx, urls, []Command{cmd}, p.Name); err != nil {
+			return fmt.Errorf("position [%s] step %d (%s): %w", p.Name, i, cmd.Name, err)
+		}
 	}
+	return nil
+}
 
-	return fmt.Errorf("don't know how to go to position %d", position)
+func (c *TahomaClient) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	positions := c.conf.positions()
+	if int(position) >= len(positions) {
+		return fmt.Errorf("don't know how to go to position %d", position)
+	}
+
+	err := c.runPosition(ctx, positions[position])
+	if err != nil {
+		c.lastPosition = 0
+		return err
+	}
+	c.lastPosition = position
+	return nil
 }
 
 func (c *TahomaClient) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
@@ -329,5 +930,10 @@ func (c *TahomaClient) GetPosition(ctx context.Context, extra map[string]interfa
 }
 
 func (c *TahomaClient) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
-	return 3, []string{"unknown", "open", "port"}, nil
+	positions := c.conf.positions()
+	names := make([]string, len(positions))
+	for i, p := range positions {
+		names[i] = p.Name
+	}
+	return uint32(len(names)), names, nil
 }
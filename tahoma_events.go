@@ -0,0 +1,382 @@
+package verhboat
+
+// TaHoma local API event listener. Executions started with /exec/apply only
+// return an execId; the outcome arrives later as ExecutionStateChangedEvents
+// on a registered event listener. The client registers one listener the first
+// time it needs to wait on an execution, polls it in the background, and
+// re-registers if the gateway forgets it (listeners expire after ~10 minutes
+// without a fetch, or when the gateway reboots).
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	tahomaEventPollInterval  = time.Second
+	tahomaExecutionTimeout   = 2 * time.Minute
+	tahomaExecStateRetention = 10 * time.Minute
+
+	tahomaExecCompleted = "COMPLETED"
+	tahomaExecFailed    = "FAILED"
+)
+
+// ------
+// these are all part of the API
+
+type EventListener struct {
+	ID string `json:"id"`
+}
+
+type Execution struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+}
+
+type Event struct {
+	Name         string        `json:"name"`
+	ExecID       string        `json:"execId,omitempty"`
+	OldState     string        `json:"oldState,omitempty"`
+	NewState     string        `json:"newState,omitempty"`
+	FailureType  string        `json:"failureType,omitempty"`
+	DeviceURL    string        `json:"deviceURL,omitempty"`
+	DeviceStates []DeviceState `json:"deviceStates,omitempty"`
+}
+
+// --- end api ---
+
+type tahomaExecState struct {
+	state       string
+	failureType string
+	updated     time.Time
+}
+
+func (s tahomaExecState) done() bool {
+	return s.state == tahomaExecCompleted || s.state == tahomaExecFailed
+}
+
+func (s tahomaExecState) err() error {
+	if s.state == tahomaExecFailed {
+		if s.failureType != "" {
+			return fmt.Errorf("execution failed: %s", s.failureType)
+		}
+		return fmt.Errorf("execution failed")
+	}
+	return nil
+}
+
+func (c *TahomaClient) registerEventListener() (string, error) {
+	respBody, err := c.makeRequest("POST", "/events/register", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var l EventListener
+	if err := json.Unmarshal(respBody, &l); err != nil {
+		return "", fmt.Errorf("failed to parse event listener: %w", err)
+	}
+	if l.ID == "" {
+		return "", fmt.Errorf("gateway returned an empty event listener id")
+	}
+	return l.ID, nil
+}
+
+// FetchEvents returns the events queued on an event listener since the last fetch.
+func (c *TahomaClient) FetchEvents(listenerID string) ([]Event, error) {
+	respBody, err := c.makeRequest("POST", "/events/"+listenerID+"/fetch", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	if err := json.Unmarshal(respBody, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse events: %w", err)
+	}
+	return events, nil
+}
+
+// startEvents registers the event listener and starts polling it, if that
+// hasn't happened yet. It must be called before an execution is started so
+// none of its events are missed.
+func (c *TahomaClient) startEvents() error {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	if c.eventsCancel != nil {
+		return nil
+	}
+
+	id, err := c.registerEventListener()
+	if err != nil {
+		return fmt.Errorf("registering event listener: %w", err)
+	}
+	c.listenerID = id
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.eventsCancel = cancel
+	c.eventsWg.Add(1)
+	go c.eventLoop(ctx)
+
+	return nil
+}
+
+func (c *TahomaClient) stopEvents() {
+	c.eventsMu.Lock()
+	cancel := c.eventsCancel
+	c.eventsMu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	c.eventsWg.Wait()
+
+	c.eventsMu.Lock()
+	id := c.listenerID
+	c.listenerID = ""
+	c.eventsCancel = nil
+	c.eventsMu.Unlock()
+
+	if id != "" {
+		if _, err := c.makeRequest("POST", "/events/"+id+"/unregister", nil); err != nil {
+			c.logger.Debugf("unregistering event listener: %v", err)
+		}
+	}
+}
+
+func (c *TahomaClient) eventLoop(ctx context.Context) {
+	defer c.eventsWg.Done()
+	t := time.NewTicker(c.eventPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.pollEvents(); err != nil {
+				c.logger.Debugf("polling events: %v", err)
+			}
+		}
+	}
+}
+
+// pollEvents fetches and handles one batch of events, re-registering the
+// listener if the gateway no longer knows it.
+func (c *TahomaClient) pollEvents() error {
+	c.eventsMu.Lock()
+	id := c.listenerID
+	c.eventsMu.Unlock()
+
+	if id == "" {
+		newID, err := c.registerEventListener()
+		if err != nil {
+			return fmt.Errorf("re-registering event listener: %w", err)
+		}
+		c.logger.Infof("re-registered tahoma event listener")
+		c.eventsMu.Lock()
+		c.listenerID = newID
+		c.eventsMu.Unlock()
+		id = newID
+
+		if err := c.reconcileAwaited(); err != nil {
+			return err
+		}
+	}
+
+	events, err := c.FetchEvents(id)
+	if err != nil {
+		c.eventsMu.Lock()
+		if c.listenerID == id {
+			c.listenerID = ""
+		}
+		c.eventsMu.Unlock()
+		return err
+	}
+
+	c.handleEvents(events, time.Now())
+	return nil
+}
+
+func (c *TahomaClient) handleEvents(events []Event, now time.Time) {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	changed := false
+	for _, e := range events {
+		if e.Name != "ExecutionStateChangedEvent" || e.ExecID == "" {
+			continue
+		}
+		c.logger.Debugf("execution %s: %s -> %s %s", e.ExecID, e.OldState, e.NewState, e.FailureType)
+		c.execStates[e.ExecID] = tahomaExecState{state: e.NewState, failureType: e.FailureType, updated: now}
+		changed = true
+	}
+
+	// Forget executions nobody waited for, e.g. ones started from the Somfy app.
+	for id, st := range c.execStates {
+		if now.Sub(st.updated) > tahomaExecStateRetention {
+			delete(c.execStates, id)
+		}
+	}
+
+	if changed {
+		close(c.execChanged)
+		c.execChanged = make(chan struct{})
+	}
+}
+
+// GetCurrentExecutions returns the executions the gateway is running now.
+func (c *TahomaClient) GetCurrentExecutions() ([]Execution, error) {
+	respBody, err := c.makeRequest("GET", "/exec/current", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var execs []Execution
+	if err := json.Unmarshal(respBody, &execs); err != nil {
+		return nil, fmt.Errorf("failed to parse executions: %w", err)
+	}
+	return execs, nil
+}
+
+// reconcileAwaited runs after a new listener is registered. Events for
+// executions that finished while there was no listener are lost, so any
+// awaited execution the gateway is no longer running is assumed complete.
+func (c *TahomaClient) reconcileAwaited() error {
+	execs, err := c.GetCurrentExecutions()
+	if err != nil {
+		return fmt.Errorf("listing current executions: %w", err)
+	}
+
+	running := map[string]bool{}
+	for _, e := range execs {
+		running[e.ID] = true
+	}
+
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	now := time.Now()
+	changed := false
+	for id := range c.awaiting {
+		if running[id] {
+			continue
+		}
+		if st, ok := c.execStates[id]; ok && st.done() {
+			continue
+		}
+		c.logger.Debugf("execution %s finished while the event listener was gone, assuming completed", id)
+		c.execStates[id] = tahomaExecState{state: tahomaExecCompleted, updated: now}
+		changed = true
+	}
+	if changed {
+		close(c.execChanged)
+		c.execChanged = make(chan struct{})
+	}
+	return nil
+}
+
+// WaitForExecution blocks until the execution completes or fails, ctx is done,
+// or it has taken longer than tahomaExecutionTimeout.
+func (c *TahomaClient) WaitForExecution(ctx context.Context, execID string) error {
+	st, err := c.waitForExecutionState(ctx, execID)
+	if err != nil {
+		return err
+	}
+	return st.err()
+}
+
+// waitForExecutionState is WaitForExecution, returning the final state.
+func (c *TahomaClient) waitForExecutionState(ctx context.Context, execID string) (tahomaExecState, error) {
+	ctx, cancel := context.WithTimeout(ctx, tahomaExecutionTimeout)
+	defer cancel()
+
+	c.eventsMu.Lock()
+	c.awaiting[execID] = struct{}{}
+	c.eventsMu.Unlock()
+	defer func() {
+		c.eventsMu.Lock()
+		delete(c.awaiting, execID)
+		c.eventsMu.Unlock()
+	}()
+
+	for {
+		c.eventsMu.Lock()
+		st, ok := c.execStates[execID]
+		changed := c.execChanged
+		if ok && st.done() {
+			delete(c.execStates, execID)
+		}
+		c.eventsMu.Unlock()
+
+		if ok && st.done() {
+			return st, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return tahomaExecState{}, fmt.Errorf("waiting for execution %s: %w", execID, ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// executeAndWaitState starts an execution with start and waits for it to
+// finish, returning its execId and final state. Like ExecuteAndWait, the
+// listener is started first so none of the execution's events are missed.
+func (c *TahomaClient) executeAndWaitState(ctx context.Context, start func() (string, error)) (string, tahomaExecState, error) {
+	if err := c.startEvents(); err != nil {
+		return "", tahomaExecState{}, err
+	}
+
+	execID, err := start()
+	if err != nil {
+		return "", tahomaExecState{}, err
+	}
+	c.eventsMu.Lock()
+	c.awaiting[execID] = struct{}{}
+	c.eventsMu.Unlock()
+
+	st, err := c.waitForExecutionState(ctx, execID)
+	return execID, st, err
+}
+
+// ExecuteAndWait runs commands on each device in parallel and waits for all of
+// the executions to finish, returning their execIds. If one can't be started,
+// the rest aren't, but the ones already started are still waited for.
+func (c *TahomaClient) ExecuteAndWait(ctx context.Context, deviceURLs []string, commands []Command, label string) ([]string, error) {
+	// Check every device up front so none moves if another can't.
+	if err := c.validateCommands(deviceURLs, commands); err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+
+	if err := c.startEvents(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	execIDs := []string{}
+	for _, u := range deviceURLs {
+		execID, startErr := c.ExecuteCommands(u, commands, label)
+		if startErr != nil {
+			// Start no more, but the devices already moving are still waited
+			// for, so their results are reported along with this.
+			err = fmt.Errorf("%s failed (url: %s): %w", label, u, startErr)
+			break
+		}
+		c.eventsMu.Lock()
+		c.awaiting[execID] = struct{}{}
+		c.eventsMu.Unlock()
+		execIDs = append(execIDs, execID)
+	}
+
+	for i, execID := range execIDs {
+		if waitErr := c.WaitForExecution(ctx, execID); waitErr != nil {
+			err = multierr.Append(err, fmt.Errorf("%s failed (url: %s): %w", label, deviceURLs[i], waitErr))
+		}
+	}
+	return execIDs, err
+}
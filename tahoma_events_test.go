@@ -0,0 +1,272 @@
+package verhboat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+// scriptedTahoma is a bare TaHoma local API whose executions only finish
+// when a test says so, for the event listener tests.
+type scriptedTahoma struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	listener  string // "" once the gateway has forgotten it
+	registers int
+	events    []Event
+	running   []string
+	applied   int
+	failApply map[string]bool // deviceURL -> /exec/apply fails
+}
+
+func newScriptedTahoma(t *testing.T) *scriptedTahoma {
+	g := &scriptedTahoma{failApply: map[string]bool{}}
+	g.srv = httptest.NewTLSServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.srv.Close)
+	return g
+}
+
+func (g *scriptedTahoma) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/enduser-mobile-web/1/enduserAPI")
+	reply := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	switch {
+	case path == "/setup/devices":
+		reply([]Device{})
+	case path == "/events/register":
+		g.registers++
+		g.listener = fmt.Sprintf("listener-%d", g.registers)
+		reply(EventListener{ID: g.listener})
+	case strings.HasSuffix(path, "/fetch"):
+		if path != "/events/"+g.listener+"/fetch" {
+			http.Error(w, `{"error":"Invalid event listener id"}`, http.StatusBadRequest)
+			return
+		}
+		reply(g.events)
+		g.events = nil
+	case strings.HasSuffix(path, "/unregister"):
+		reply(struct{}{})
+	case path == "/exec/apply":
+		var req ExecutionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Actions) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if g.failApply[req.Actions[0].DeviceURL] {
+			http.Error(w, `{"error":"device busy"}`, http.StatusBadRequest)
+			return
+		}
+		g.applied++
+		id := fmt.Sprintf("exec-%d", g.applied)
+		g.running = append(g.running, id)
+		reply(ExecutionResponse{ExecID: id})
+	case path == "/exec/current":
+		execs := []Execution{}
+		for _, id := range g.running {
+			execs = append(execs, Execution{ID: id, State: "IN_PROGRESS"})
+		}
+		reply(execs)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// finish ends a running execution, queuing its event if there's a listener
+// to get it.
+func (g *scriptedTahoma) finish(execID, state, failure string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, id := range g.running {
+		if id == execID {
+			g.running = append(g.running[:i], g.running[i+1:]...)
+			break
+		}
+	}
+	if g.listener != "" {
+		g.events = append(g.events, Event{
+			Name: "ExecutionStateChangedEvent", ExecID: execID,
+			OldState: "IN_PROGRESS", NewState: state, FailureType: failure,
+		})
+	}
+}
+
+// forget drops the event listener, as a gateway reboot does.
+func (g *scriptedTahoma) forget() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.listener = ""
+	g.events = nil
+}
+
+func (g *scriptedTahoma) numRunning() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.running)
+}
+
+func (g *scriptedTahoma) numRegisters() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.registers
+}
+
+func (g *scriptedTahoma) client(t *testing.T) *TahomaClient {
+	t.Helper()
+	sum := sha256.Sum256(g.srv.Certificate().Raw)
+	conf := &TahomaConfig{TahomaGatewayConfig: TahomaGatewayConfig{
+		Host:            strings.TrimPrefix(g.srv.URL, "https://"),
+		ApiKey:          "token",
+		CertFingerprint: hex.EncodeToString(sum[:]),
+	}}
+	client, err := NewTahomaClient(conf, toggleswitch.Named("shades"), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	client.eventPoll = 10 * time.Millisecond
+	t.Cleanup(func() { client.Close(context.Background()) })
+	return client
+}
+
+type executeResult struct {
+	ids []string
+	err error
+}
+
+// executeInBackground runs ExecuteAndWait and waits for running executions
+// to start on the gateway.
+func executeInBackground(t *testing.T, ctx context.Context, g *scriptedTahoma, c *TahomaClient, urls []string, running int) chan executeResult {
+	t.Helper()
+	done := make(chan executeResult, 1)
+	go func() {
+		ids, err := c.ExecuteAndWait(ctx, urls, []Command{{Name: "open", Parameters: []interface{}{}}}, "Open")
+		done <- executeResult{ids, err}
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for g.numRunning() < running {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d executions started", g.numRunning())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return done
+}
+
+func waitResult(t *testing.T, done chan executeResult) executeResult {
+	t.Helper()
+	select {
+	case res := <-done:
+		return res
+	case <-time.After(2 * time.Second):
+		t.Fatal("ExecuteAndWait never returned")
+		return executeResult{}
+	}
+}
+
+func stillWaiting(t *testing.T, done chan executeResult) {
+	t.Helper()
+	select {
+	case res := <-done:
+		t.Fatalf("ExecuteAndWait returned early: %v %v", res.ids, res.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTahomaExecuteAndWait(t *testing.T) {
+	ctx := context.Background()
+	g := newScriptedTahoma(t)
+	c := g.client(t)
+
+	done := executeInBackground(t, ctx, g, c, []string{"io://a", "io://b"}, 2)
+	g.finish("exec-1", tahomaExecCompleted, "")
+	stillWaiting(t, done)
+	g.finish("exec-2", tahomaExecFailed, "CMDCANCELLED")
+	res := waitResult(t, done)
+	test.That(t, res.ids, test.ShouldResemble, []string{"exec-1", "exec-2"})
+	test.That(t, res.err, test.ShouldNotBeNil)
+	test.That(t, res.err.Error(), test.ShouldContainSubstring, "io://b")
+	test.That(t, res.err.Error(), test.ShouldContainSubstring, "CMDCANCELLED")
+	test.That(t, res.err.Error(), test.ShouldNotContainSubstring, "io://a")
+
+	// One listener serves every execution.
+	done = executeInBackground(t, ctx, g, c, []string{"io://a"}, 1)
+	g.finish("exec-3", tahomaExecCompleted, "")
+	test.That(t, waitResult(t, done).err, test.ShouldBeNil)
+	test.That(t, g.numRegisters(), test.ShouldEqual, 1)
+}
+
+func TestTahomaExecuteAndWaitStartFails(t *testing.T) {
+	ctx := context.Background()
+	g := newScriptedTahoma(t)
+	c := g.client(t)
+	g.failApply["io://b"] = true
+
+	// a starts, b doesn't, c is never tried; a is still seen through.
+	done := executeInBackground(t, ctx, g, c, []string{"io://a", "io://b", "io://c"}, 1)
+	stillWaiting(t, done)
+	test.That(t, g.numRunning(), test.ShouldEqual, 1)
+	g.finish("exec-1", tahomaExecFailed, "WHILEEXEC_OTHER")
+	res := waitResult(t, done)
+	test.That(t, res.ids, test.ShouldResemble, []string{"exec-1"})
+	test.That(t, res.err, test.ShouldNotBeNil)
+	test.That(t, res.err.Error(), test.ShouldContainSubstring, "device busy")
+	test.That(t, res.err.Error(), test.ShouldContainSubstring, "WHILEEXEC_OTHER")
+	test.That(t, res.err.Error(), test.ShouldNotContainSubstring, "io://c")
+}
+
+func TestTahomaExecutionFinishedWithoutListener(t *testing.T) {
+	ctx := context.Background()
+	g := newScriptedTahoma(t)
+	c := g.client(t)
+
+	done := executeInBackground(t, ctx, g, c, []string{"io://a", "io://b"}, 2)
+
+	// The gateway reboots: the listener is gone, and a finishes with no one
+	// to hear it. The new listener finds a is no longer running.
+	g.forget()
+	g.finish("exec-1", tahomaExecCompleted, "")
+	deadline := time.Now().Add(2 * time.Second)
+	for g.numRegisters() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("event listener never re-registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	stillWaiting(t, done)
+
+	// b's event arrives on the new listener.
+	g.finish("exec-2", tahomaExecCompleted, "")
+	test.That(t, waitResult(t, done).err, test.ShouldBeNil)
+}
+
+func TestTahomaExecuteAndWaitTimeout(t *testing.T) {
+	g := newScriptedTahoma(t)
+	c := g.client(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	done := executeInBackground(t, ctx, g, c, []string{"io://a"}, 1)
+	res := waitResult(t, done)
+	test.That(t, errors.Is(res.err, context.DeadlineExceeded), test.ShouldBeTrue)
+
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	test.That(t, c.awaiting, test.ShouldBeEmpty)
+}
@@ -0,0 +1,587 @@
+package verhboat
+
+// In-process fake of the TaHoma local API (enduser-mobile-web), used by the
+// tests and by cmd/tahoma -fake so the tahoma models can be exercised without
+// a gateway.
+//
+// It serves devices, device states, scenarios, /exec/apply with executions
+// that run over time, and event listeners, all behind bearer auth on a
+// self-signed HTTPS server. Shades move at a configurable speed, so a "down" takes a while and
+// emits the same execution and device state events a real gateway would.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tahomaAPIPrefix         = "/enduser-mobile-web/1/enduserAPI"
+	fakeTahomaTick          = 10 * time.Millisecond
+	fakeTahomaDefaultTravel = 2 * time.Second
+	fakeTahomaTiltStep      = 10.0 // orientation percent per 0.1s of tiltPositive/tiltNegative
+)
+
+var (
+	fakeTahomaShadeCommands = []string{"up", "down", "open", "close", "stop", "setClosure"}
+	fakeTahomaTiltCommands  = []string{"tiltPositive", "tiltNegative", "setOrientation"}
+)
+
+// FakeTahoma is a fake TaHoma gateway.
+type FakeTahoma struct {
+	server *httptest.Server
+	token  string
+
+	mu        sync.Mutex
+	devices   []*fakeTahomaDevice
+	scenarios []ActionGroup
+	travel    time.Duration
+	nextID    int
+	execs     []*fakeTahomaExec
+	listeners map[string][]Event
+	failNext  map[string]string
+	commands  []string
+	lastTick  time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type fakeTahomaDevice struct {
+	url              string
+	label            string
+	controllableName string
+	uiClass          string
+	widget           string
+	commands         []string
+	tilt             bool
+
+	closure, targetClosure         float64
+	orientation, targetOrientation float64
+	moving                         bool
+}
+
+type fakeTahomaExec struct {
+	id      string
+	label   string
+	state   string
+	actions []*fakeTahomaAction
+}
+
+type fakeTahomaAction struct {
+	dev   *fakeTahomaDevice
+	queue []Command
+}
+
+// NewFakeTahoma starts a fake gateway that accepts the given bearer token.
+func NewFakeTahoma(token string) *FakeTahoma {
+	f := &FakeTahoma{
+		token:     token,
+		scenarios: []ActionGroup{},
+		travel:    fakeTahomaDefaultTravel,
+		listeners: map[string][]Event{},
+		failNext:  map[string]string{},
+		lastTick:  time.Now(),
+	}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.serveHTTP))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.wg.Add(1)
+	go f.simulate(ctx)
+
+	return f
+}
+
+// Host returns the host:port to use as the gateway's host.
+func (f *FakeTahoma) Host() string {
+	return strings.TrimPrefix(f.server.URL, "https://")
+}
+
+// CertFingerprint returns the fingerprint of the fake's self-signed certificate.
+func (f *FakeTahoma) CertFingerprint() string {
+	return CertFingerprint(f.server.Certificate().Raw)
+}
+
+// Close stops the fake.
+func (f *FakeTahoma) Close() {
+	f.cancel()
+	f.wg.Wait()
+	f.server.Close()
+}
+
+// AddShade adds a roller shade (or, with tilt, a venetian blind) that starts
+// fully open, and returns its deviceURL.
+func (f *FakeTahoma) AddShade(label string, tilt bool) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d := &fakeTahomaDevice{
+		url:              fmt.Sprintf("io://1234-5678-9012/%d", 10000000+len(f.devices)),
+		label:            label,
+		controllableName: "io:RollerShutterGenericIOComponent",
+		uiClass:          "RollerShutter",
+		widget:           "PositionableRollerShutter",
+		commands:         fakeTahomaShadeCommands,
+		tilt:             tilt,
+	}
+	if tilt {
+		d.controllableName = "io:ExteriorVenetianBlindIOComponent"
+		d.uiClass = "ExteriorVenetianBlind"
+		d.widget = "PositionableExteriorVenetianBlind"
+		d.commands = append(append([]string{}, fakeTahomaShadeCommands...), fakeTahomaTiltCommands...)
+	}
+	f.devices = append(f.devices, d)
+	return d.url
+}
+
+// AddScenario adds a scenario that runs actions, and returns its oid.
+func (f *FakeTahoma) AddScenario(label string, actions []Action) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Round-trip through JSON so parameters look as they would off the wire.
+	var stored []Action
+	b, _ := json.Marshal(actions)
+	_ = json.Unmarshal(b, &stored)
+
+	oid := fmt.Sprintf("%08x-0000-4000-8000-%012x", len(f.scenarios)+1, len(f.scenarios)+1)
+	f.scenarios = append(f.scenarios, ActionGroup{OID: oid, Label: label, Actions: stored})
+	return oid
+}
+
+// SetTravelTime sets how long a shade takes to go from open to closed.
+func (f *FakeTahoma) SetTravelTime(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.travel = d
+}
+
+// Closure returns a shade's current closure percentage.
+func (f *FakeTahoma) Closure(deviceURL string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d := f.findLocked(deviceURL); d != nil {
+		return d.closure
+	}
+	return 0
+}
+
+// Orientation returns a shade's current slat orientation percentage.
+func (f *FakeTahoma) Orientation(deviceURL string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d := f.findLocked(deviceURL); d != nil {
+		return d.orientation
+	}
+	return 0
+}
+
+// SetClosure moves a shade instantly, as if someone used the Somfy remote.
+func (f *FakeTahoma) SetClosure(deviceURL string, percent float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d := f.findLocked(deviceURL); d != nil {
+		d.closure, d.targetClosure = percent, percent
+		f.broadcastLocked(f.deviceStateEventLocked(d))
+	}
+}
+
+// FailNext makes the next execution on deviceURL fail with failureType.
+func (f *FakeTahoma) FailNext(deviceURL, failureType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failNext[deviceURL] = failureType
+}
+
+// DropEventListeners forgets every event listener, as a gateway reboot would.
+func (f *FakeTahoma) DropEventListeners() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listeners = map[string][]Event{}
+}
+
+// NumEventListeners returns the number of registered event listeners.
+func (f *FakeTahoma) NumEventListeners() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.listeners)
+}
+
+// Commands returns every command the fake has run, as "label: name params".
+func (f *FakeTahoma) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+func (f *FakeTahoma) findLocked(deviceURL string) *fakeTahomaDevice {
+	for _, d := range f.devices {
+		if d.url == deviceURL {
+			return d
+		}
+	}
+	return nil
+}
+
+func (f *FakeTahoma) broadcastLocked(e Event) {
+	for id, events := range f.listeners {
+		f.listeners[id] = append(events, e)
+	}
+}
+
+// ---- simulation
+
+func (f *FakeTahoma) simulate(ctx context.Context) {
+	defer f.wg.Done()
+	t := time.NewTicker(fakeTahomaTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			f.tick(now)
+		}
+	}
+}
+
+func (f *FakeTahoma) tick(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dt := now.Sub(f.lastTick)
+	f.lastTick = now
+
+	step := 100.0
+	if f.travel > 0 {
+		step = 100 * dt.Seconds() / f.travel.Seconds()
+	}
+
+	for _, d := range f.devices {
+		d.closure = moveToward(d.closure, d.targetClosure, step)
+		d.orientation = moveToward(d.orientation, d.targetOrientation, step)
+		moving := d.closure != d.targetClosure || d.orientation != d.targetOrientation
+		if moving != d.moving {
+			d.moving = moving
+			f.broadcastLocked(f.deviceStateEventLocked(d))
+		}
+	}
+
+	running := f.execs[:0]
+	for _, e := range f.execs {
+		f.advanceLocked(e)
+		if e.state == tahomaExecCompleted || e.state == tahomaExecFailed {
+			continue
+		}
+		running = append(running, e)
+	}
+	f.execs = running
+}
+
+func moveToward(cur, target, step float64) float64 {
+	if math.Abs(target-cur) <= step {
+		return target
+	}
+	if target > cur {
+		return cur + step
+	}
+	return cur - step
+}
+
+// advanceLocked starts each action's next command once its device is idle,
+// and finishes the execution when every action is done.
+func (f *FakeTahoma) advanceLocked(e *fakeTahomaExec) {
+	done := true
+	for _, a := range e.actions {
+		if a.dev.moving || a.dev.closure != a.dev.targetClosure || a.dev.orientation != a.dev.targetOrientation {
+			done = false
+			continue
+		}
+		if len(a.queue) == 0 {
+			continue
+		}
+		done = false
+
+		if failure, ok := f.failNext[a.dev.url]; ok {
+			delete(f.failNext, a.dev.url)
+			f.setExecStateLocked(e, tahomaExecFailed, failure)
+			return
+		}
+
+		cmd := a.queue[0]
+		a.queue = a.queue[1:]
+		f.commands = append(f.commands, fmt.Sprintf("%s: %s %v", a.dev.label, cmd.Name, cmd.Parameters))
+		if err := a.dev.apply(cmd); err != nil {
+			f.setExecStateLocked(e, tahomaExecFailed, "CMDCANCELLED")
+			return
+		}
+	}
+
+	if e.state == "INITIALIZED" {
+		f.setExecStateLocked(e, "IN_PROGRESS", "")
+	}
+	if done {
+		f.setExecStateLocked(e, tahomaExecCompleted, "")
+	}
+}
+
+func (f *FakeTahoma) setExecStateLocked(e *fakeTahomaExec, state, failureType string) {
+	old := e.state
+	e.state = state
+	f.broadcastLocked(Event{
+		Name:        "ExecutionStateChangedEvent",
+		ExecID:      e.id,
+		OldState:    old,
+		NewState:    state,
+		FailureType: failureType,
+	})
+}
+
+func paramPercent(cmd Command, i int) (float64, error) {
+	if len(cmd.Parameters) <= i {
+		return 0, fmt.Errorf("%s needs %d parameters", cmd.Name, i+1)
+	}
+	p, ok := cmd.Parameters[i].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s parameter %d must be a number", cmd.Name, i)
+	}
+	return p, nil
+}
+
+func (d *fakeTahomaDevice) supports(name string) bool {
+	for _, c := range d.commands {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *fakeTahomaDevice) apply(cmd Command) error {
+	if !d.supports(cmd.Name) {
+		return fmt.Errorf("%s doesn't support %s", d.label, cmd.Name)
+	}
+
+	switch cmd.Name {
+	case "up", "open":
+		d.targetClosure = 0
+	case "down", "close":
+		d.targetClosure = 100
+	case "stop":
+		d.targetClosure, d.targetOrientation = d.closure, d.orientation
+	case "setClosure":
+		p, err := paramPercent(cmd, 0)
+		if err != nil {
+			return err
+		}
+		d.targetClosure = math.Max(0, math.Min(100, p))
+	case "setOrientation":
+		p, err := paramPercent(cmd, 0)
+		if err != nil {
+			return err
+		}
+		d.targetOrientation = math.Max(0, math.Min(100, p))
+	case "tiltPositive", "tiltNegative":
+		dur, err := paramPercent(cmd, 0)
+		if err != nil {
+			return err
+		}
+		delta := dur * fakeTahomaTiltStep
+		if cmd.Name == "tiltNegative" {
+			delta = -delta
+		}
+		d.targetOrientation = math.Max(0, math.Min(100, d.orientation+delta))
+	}
+	return nil
+}
+
+// ---- API
+
+func (d *fakeTahomaDevice) states() []DeviceState {
+	openClosed := "open"
+	if d.closure >= 100 {
+		openClosed = "closed"
+	}
+	states := []DeviceState{
+		{Name: "core:StatusState", Type: 3, Value: "available"},
+		{Name: tahomaClosureState, Type: 1, Value: math.Round(d.closure)},
+		{Name: "core:OpenClosedState", Type: 3, Value: openClosed},
+		{Name: tahomaMovingState, Type: 6, Value: d.moving},
+	}
+	if d.tilt {
+		states = append(states, DeviceState{Name: tahomaOrientationState, Type: 1, Value: math.Round(d.orientation)})
+	}
+	return states
+}
+
+func (d *fakeTahomaDevice) json() map[string]interface{} {
+	commands := []map[string]interface{}{}
+	for _, c := range d.commands {
+		nparams := 0
+		switch c {
+		case "setClosure", "setOrientation":
+			nparams = 1
+		case "tiltPositive", "tiltNegative":
+			nparams = 2
+		}
+		commands = append(commands, map[string]interface{}{"commandName": c, "nparams": nparams})
+	}
+	stateNames := []map[string]interface{}{}
+	for _, s := range d.states() {
+		stateNames = append(stateNames, map[string]interface{}{"qualifiedName": s.Name})
+	}
+	return map[string]interface{}{
+		"deviceURL":        d.url,
+		"label":            d.label,
+		"controllableName": d.controllableName,
+		"available":        true,
+		"enabled":          true,
+		"type":             1,
+		"definition": map[string]interface{}{
+			"commands":   commands,
+			"states":     stateNames,
+			"widgetName": d.widget,
+			"uiClass":    d.uiClass,
+			"type":       "ACTUATOR",
+		},
+		"states": d.states(),
+	}
+}
+
+func (f *FakeTahoma) deviceStateEventLocked(d *fakeTahomaDevice) Event {
+	return Event{Name: "DeviceStateChangedEvent", DeviceURL: d.url, DeviceStates: d.states()}
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code, msg string) {
+	writeFakeJSON(w, status, map[string]string{"errorCode": code, "error": msg})
+}
+
+func (f *FakeTahoma) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		writeFakeError(w, http.StatusUnauthorized, "RESOURCE_ACCESS_DENIED", "Not authenticated")
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), tahomaAPIPrefix+"/")
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "UNSPECIFIED_ERROR", "Unknown path")
+		return
+	}
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if u, err := url.PathUnescape(p); err == nil {
+			parts[i] = u
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "setup" && parts[1] == "devices":
+		res := []map[string]interface{}{}
+		for _, d := range f.devices {
+			res = append(res, d.json())
+		}
+		writeFakeJSON(w, http.StatusOK, res)
+
+	case r.Method == "GET" && len(parts) >= 3 && parts[0] == "setup" && parts[1] == "devices":
+		d := f.findLocked(parts[2])
+		if d == nil {
+			writeFakeError(w, http.StatusBadRequest, "UNSPECIFIED_ERROR", "Unknown device")
+			return
+		}
+		if len(parts) == 4 && parts[3] == "states" {
+			writeFakeJSON(w, http.StatusOK, d.states())
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, d.json())
+
+	case r.Method == "POST" && len(parts) == 2 && parts[0] == "exec" && parts[1] == "apply":
+		var req ExecutionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeFakeError(w, http.StatusBadRequest, "UNSPECIFIED_ERROR", err.Error())
+			return
+		}
+		f.applyLocked(w, req.Label, req.Actions)
+
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "actionGroups":
+		writeFakeJSON(w, http.StatusOK, f.scenarios)
+
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "exec" && parts[1] == "current":
+		res := []map[string]interface{}{}
+		for _, e := range f.execs {
+			res = append(res, map[string]interface{}{"id": e.id, "state": e.state, "label": e.label})
+		}
+		writeFakeJSON(w, http.StatusOK, res)
+
+	case r.Method == "POST" && len(parts) == 2 && parts[0] == "exec":
+		for _, g := range f.scenarios {
+			if g.OID == parts[1] {
+				f.applyLocked(w, g.Label, g.Actions)
+				return
+			}
+		}
+		writeFakeError(w, http.StatusBadRequest, "UNSPECIFIED_ERROR", "Unknown action group "+parts[1])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[0] == "events" && parts[1] == "register":
+		f.nextID++
+		id := fmt.Sprintf("listener-%d", f.nextID)
+		f.listeners[id] = []Event{}
+		writeFakeJSON(w, http.StatusOK, EventListener{ID: id})
+
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "events":
+		events, ok := f.listeners[parts[1]]
+		if !ok {
+			writeFakeError(w, http.StatusBadRequest, "UNSPECIFIED_ERROR", "Invalid event listener id : "+parts[1])
+			return
+		}
+		switch parts[2] {
+		case "fetch":
+			f.listeners[parts[1]] = []Event{}
+			writeFakeJSON(w, http.StatusOK, events)
+		case "unregister":
+			delete(f.listeners, parts[1])
+			writeFakeJSON(w, http.StatusOK, map[string]interface{}{})
+		default:
+			writeFakeError(w, http.StatusNotFound, "UNSPECIFIED_ERROR", "Unknown path")
+		}
+
+	default:
+		writeFakeError(w, http.StatusNotFound, "UNSPECIFIED_ERROR", "Unknown path")
+	}
+}
+
+func (f *FakeTahoma) applyLocked(w http.ResponseWriter, label string, actions []Action) {
+	f.nextID++
+	e := &fakeTahomaExec{
+		id:    fmt.Sprintf("exec-%d", f.nextID),
+		label: label,
+		state: "INITIALIZED",
+	}
+	for _, a := range actions {
+		d := f.findLocked(a.DeviceURL)
+		if d == nil {
+			writeFakeError(w, http.StatusBadRequest, "UNSPECIFIED_ERROR", "Unknown device "+a.DeviceURL)
+			return
+		}
+		e.actions = append(e.actions, &fakeTahomaAction{dev: d, queue: a.Commands})
+	}
+	f.execs = append(f.execs, e)
+	f.broadcastLocked(Event{Name: "ExecutionRegisteredEvent", ExecID: e.id})
+	writeFakeJSON(w, http.StatusOK, ExecutionResponse{ExecID: e.id})
+}
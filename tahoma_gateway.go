@@ -0,0 +1,395 @@
+package verhboat
+
+// Finding and trusting a TaHoma gateway on the LAN.
+//
+// Gateways with developer mode on advertise _kizboxdev._tcp over mDNS, with
+// their PIN in a gateway_pin TXT record. Their HTTPS certificate is issued by
+// Somfy's local CA for gateway-<pin>.local, which rarely matches the address
+// we dial, so instead of Go's hostname check the certificate is verified
+// against the configured CA and the gateway's PIN-derived name, and/or pinned
+// by its SHA-256 fingerprint. With neither, the first certificate seen is
+// trusted from then on, with a warning; not verifying it at all has to be
+// asked for.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viamrobotics/zeroconf"
+
+	"go.viam.com/rdk/logging"
+)
+
+const (
+	tahomaMDNSService        = "_kizboxdev._tcp"
+	tahomaDefaultPort        = 8443
+	tahomaDiscoveryDuration  = 5 * time.Second
+	tahomaRediscoverInterval = time.Minute
+)
+
+// TahomaGatewayConfig is how to reach and trust a TaHoma gateway. It is shared
+// by the tahoma models.
+type TahomaGatewayConfig struct {
+	// Host is the gateway's address, optionally with a port (default 8443).
+	// If empty, the gateway is found with mDNS.
+	Host   string `json:"host,omitempty"`
+	ApiKey string `json:"api-key"`
+
+	// GatewayPin (e.g. 1234-5678-9012) picks the gateway when discovering, and
+	// lets the client rediscover it if its address changes.
+	GatewayPin string `json:"gateway-pin,omitempty"`
+
+	// CACert is a PEM file with the Somfy local CA used to verify the gateway.
+	CACert string `json:"ca-cert,omitempty"`
+
+	// CertFingerprint is the SHA-256 fingerprint (hex, colons optional) of the
+	// gateway's certificate.
+	CertFingerprint string `json:"cert-fingerprint,omitempty"`
+
+	// Insecure skips checking the gateway's certificate. Without it, CACert or
+	// CertFingerprint, the first certificate seen is trusted.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+func (c *TahomaGatewayConfig) validate() error {
+	if c.ApiKey == "" {
+		return fmt.Errorf("need an api-key")
+	}
+
+	if c.CertFingerprint != "" {
+		if _, err := parseCertFingerprint(c.CertFingerprint); err != nil {
+			return err
+		}
+	}
+
+	if c.CACert != "" && c.CertFingerprint == "" && c.GatewayPin == "" && c.Host != "" && gatewayNameFromHost(c.Host) == "" {
+		return fmt.Errorf("with ca-cert and an IP address for host, need a gateway-pin to check it's the right gateway")
+	}
+
+	return nil
+}
+
+// gatewayCertName is the name on the certificate of the gateway with pin.
+func gatewayCertName(pin string) string {
+	return "gateway-" + strings.ToLower(pin) + ".local"
+}
+
+// gatewayNameFromHost is host, without any port, if it's a name rather than
+// an IP address, or "".
+func gatewayNameFromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// canRediscover reports whether the gateway's address may be looked up again
+// with mDNS when it stops answering.
+func (c *TahomaGatewayConfig) canRediscover() bool {
+	return c.Host == "" || c.GatewayPin != ""
+}
+
+func parseCertFingerprint(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("cert-fingerprint must be a hex SHA-256 fingerprint, got %q", s)
+	}
+	return b, nil
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of a DER certificate, in
+// the colon-separated form accepted by cert-fingerprint.
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// tlsConfig builds the TLS config for talking to the gateway. certName gives
+// the name the certificate must be for when it's checked against the CA; it
+// can change as the gateway is discovered.
+func (c *TahomaGatewayConfig) tlsConfig(certName func() string, logger logging.Logger) (*tls.Config, error) {
+	var roots *x509.CertPool
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca-cert: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca-cert %s", c.CACert)
+		}
+	}
+
+	var pin []byte
+	if c.CertFingerprint != "" {
+		var err error
+		pin, err = parseCertFingerprint(c.CertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if roots == nil && pin == nil {
+		if c.Insecure {
+			return &tls.Config{InsecureSkipVerify: true}, nil
+		}
+		return trustOnFirstUse(logger), nil
+	}
+
+	return &tls.Config{
+		// Go's own verification checks the dialed hostname, which is usually
+		// an IP; VerifyPeerCertificate does the real checks.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if err := verifyGatewayCert(rawCerts, roots, certName(), pin); err != nil {
+				return &tahomaCertError{err}
+			}
+			return nil
+		},
+	}, nil
+}
+
+// trustOnFirstUse is the TLS config when nothing was configured to check the
+// gateway's certificate against: the first one seen is pinned, so at least a
+// different device answering later is caught.
+func trustOnFirstUse(logger logging.Logger) *tls.Config {
+	var mu sync.Mutex
+	var pin []byte
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return &tahomaCertError{fmt.Errorf("gateway sent no certificate")}
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			mu.Lock()
+			defer mu.Unlock()
+			if pin == nil {
+				pin = sum[:]
+				logger.Warnf("no ca-cert or cert-fingerprint configured, so trusting the TaHoma gateway's certificate "+
+					"as first seen; to check it properly, add \"cert-fingerprint\": %q to the config",
+					CertFingerprint(rawCerts[0]))
+				return nil
+			}
+			if !bytes.Equal(sum[:], pin) {
+				return &tahomaCertError{fmt.Errorf("gateway certificate fingerprint %s isn't the one first seen; "+
+					"set cert-fingerprint if the gateway really changed", CertFingerprint(rawCerts[0]))}
+			}
+			return nil
+		},
+	}
+}
+
+// tahomaCertError is a gateway certificate that failed verification. Unlike
+// a tahomaConnError it doesn't lead to rediscovery: something answered, just
+// not the configured gateway.
+type tahomaCertError struct {
+	err error
+}
+
+func (e *tahomaCertError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tahomaCertError) Unwrap() error {
+	return e.err
+}
+
+func verifyGatewayCert(rawCerts [][]byte, roots *x509.CertPool, dnsName string, pin []byte) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("gateway sent no certificate")
+	}
+
+	if pin != nil {
+		sum := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(sum[:], pin) {
+			return fmt.Errorf("gateway certificate fingerprint %s doesn't match cert-fingerprint", CertFingerprint(rawCerts[0]))
+		}
+	}
+
+	if roots != nil {
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parsing gateway certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("verifying gateway certificate: %w", err)
+		}
+
+		// Any gateway's certificate chains to the CA, so check it's this one.
+		if pin == nil {
+			if dnsName == "" {
+				return fmt.Errorf("don't know which gateway to expect; set gateway-pin")
+			}
+			if err := certs[0].VerifyHostname(dnsName); err != nil {
+				// Go only checks SANs; a certificate without any names the
+				// gateway in its CN.
+				if len(certs[0].DNSNames) > 0 || !strings.EqualFold(certs[0].Subject.CommonName, dnsName) {
+					return fmt.Errorf("gateway certificate is not for %s: %w", dnsName, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// FetchCertFingerprint connects to the gateway and returns its certificate's
+// fingerprint, for pinning with cert-fingerprint.
+func FetchCertFingerprint(host string, port int) (string, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: tahomaDiscoveryDuration}, "tcp", addr,
+		&tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("%s sent no certificate", addr)
+	}
+	return CertFingerprint(certs[0].Raw), nil
+}
+
+// TahomaGateway is a gateway found with mDNS.
+type TahomaGateway struct {
+	Pin        string
+	HostName   string
+	Addr       string
+	Port       int
+	APIVersion string
+	FwVersion  string
+}
+
+// Host returns the best address to dial the gateway at: its IP if known,
+// since .local names often don't resolve outside of mDNS-aware resolvers.
+func (g TahomaGateway) Host() string {
+	if g.Addr != "" {
+		return g.Addr
+	}
+	return g.HostName
+}
+
+// DiscoverTahomaGateways browses mDNS for TaHoma gateways until ctx is done.
+func DiscoverTahomaGateways(ctx context.Context, logger logging.Logger) ([]TahomaGateway, error) {
+	resolver, err := zeroconf.NewResolver(logger.AsZap())
+	if err != nil {
+		return nil, fmt.Errorf("starting mDNS resolver: %w", err)
+	}
+	defer resolver.Shutdown()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, tahomaMDNSService, "local.", entries); err != nil {
+		return nil, fmt.Errorf("browsing mDNS: %w", err)
+	}
+
+	gateways := []TahomaGateway{}
+	seen := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return gateways, nil
+		case e, ok := <-entries:
+			if !ok {
+				return gateways, nil
+			}
+			g := gatewayFromEntry(e)
+			key := g.Pin + "/" + g.Host()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			gateways = append(gateways, g)
+		}
+	}
+}
+
+func gatewayFromEntry(e *zeroconf.ServiceEntry) TahomaGateway {
+	g := TahomaGateway{
+		HostName: strings.TrimSuffix(e.HostName, "."),
+		Port:     e.Port,
+	}
+	if len(e.AddrIPv4) > 0 {
+		g.Addr = e.AddrIPv4[0].String()
+	}
+	for _, txt := range e.Text {
+		k, v, ok := strings.Cut(txt, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "gateway_pin":
+			g.Pin = v
+		case "api_version":
+			g.APIVersion = v
+		case "fw_version":
+			g.FwVersion = v
+		}
+	}
+	if g.Port == 0 {
+		g.Port = tahomaDefaultPort
+	}
+	return g
+}
+
+// discoverGateway finds the configured gateway: the one with the configured
+// PIN, or the only one on the LAN if no PIN is configured.
+func discoverGateway(ctx context.Context, conf *TahomaGatewayConfig, logger logging.Logger) (TahomaGateway, error) {
+	ctx, cancel := context.WithTimeout(ctx, tahomaDiscoveryDuration)
+	defer cancel()
+
+	gateways, err := DiscoverTahomaGateways(ctx, logger)
+	if err != nil {
+		return TahomaGateway{}, err
+	}
+
+	if conf.GatewayPin != "" {
+		for _, g := range gateways {
+			if strings.EqualFold(g.Pin, conf.GatewayPin) {
+				return g, nil
+			}
+		}
+		return TahomaGateway{}, fmt.Errorf("no TaHoma gateway with pin [%s] found (saw %d)", conf.GatewayPin, len(gateways))
+	}
+
+	switch len(gateways) {
+	case 0:
+		return TahomaGateway{}, fmt.Errorf("no TaHoma gateway found; is developer mode on?")
+	case 1:
+		return gateways[0], nil
+	}
+	return TahomaGateway{}, fmt.Errorf("found %d TaHoma gateways; set gateway-pin to pick one", len(gateways))
+}
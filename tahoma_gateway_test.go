@@ -0,0 +1,233 @@
+package verhboat
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+// testCA issues certificates like Somfy's local CA does for gateways.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.That(t, err, test.ShouldBeNil)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	test.That(t, err, test.ShouldBeNil)
+	cert, err := x509.ParseCertificate(der)
+	test.That(t, err, test.ShouldBeNil)
+	return &testCA{cert: cert, key: key}
+}
+
+// writePEM writes the CA certificate to a file for ca-cert.
+func (ca *testCA) writePEM(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	test.That(t, os.WriteFile(path, data, 0o600), test.ShouldBeNil)
+	return path
+}
+
+// gateway starts a TLS server whose certificate has name as its CN, and as
+// its SAN too if san is set.
+func (ca *testCA) gateway(t *testing.T, name string, san bool) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.That(t, err, test.ShouldBeNil)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if san {
+		tmpl.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	test.That(t, err, test.ShouldBeNil)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTahomaGatewayCA(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := ca.writePEM(t)
+	logger := logging.NewTestLogger(t)
+
+	connect := func(srv *httptest.Server, pin string) error {
+		conf := &TahomaConfig{TahomaGatewayConfig: TahomaGatewayConfig{
+			Host:       strings.TrimPrefix(srv.URL, "https://"),
+			ApiKey:     "token",
+			GatewayPin: pin,
+			CACert:     caFile,
+		}}
+		client, err := NewTahomaClient(conf, toggleswitch.Named("shades"), logger)
+		if err != nil {
+			return err
+		}
+		return client.Close(context.Background())
+	}
+
+	gw := ca.gateway(t, "gateway-1111-2222-3333.local", true)
+	test.That(t, connect(gw, "1111-2222-3333"), test.ShouldBeNil)
+
+	// Another gateway's certificate chains to the same CA, but isn't this one.
+	err := connect(gw, "9999-8888-7777")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "not for gateway-9999-8888-7777.local")
+
+	// Without a PIN there's no telling which gateway it is.
+	err = connect(gw, "")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "gateway-pin")
+	conf := &TahomaConfig{TahomaGatewayConfig: TahomaGatewayConfig{Host: "192.168.1.20", ApiKey: "token", CACert: caFile}}
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.Host = "gateway-1111-2222-3333.local"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// A certificate that names the gateway only in its CN.
+	cnOnly := ca.gateway(t, "gateway-4444-5555-6666.local", false)
+	test.That(t, connect(cnOnly, "4444-5555-6666"), test.ShouldBeNil)
+	test.That(t, connect(cnOnly, "1111-2222-3333"), test.ShouldNotBeNil)
+
+	// A certificate from some other CA.
+	other := newTestCA(t).gateway(t, "gateway-1111-2222-3333.local", true)
+	err = connect(other, "1111-2222-3333")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "verifying gateway certificate")
+}
+
+func TestGatewayNameFromHost(t *testing.T) {
+	for _, tc := range []struct {
+		host, want string
+	}{
+		{"gateway-1111-2222-3333.local", "gateway-1111-2222-3333.local"},
+		{"Gateway-1111-2222-3333.local.:8443", "gateway-1111-2222-3333.local"},
+		{"192.168.1.20", ""},
+		{"192.168.1.20:8443", ""},
+		{"[fe80::1]:8443", ""},
+		{"", ""},
+	} {
+		test.That(t, gatewayNameFromHost(tc.host), test.ShouldEqual, tc.want)
+	}
+}
+
+func TestTahomaRediscoverThrottled(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	fake.AddShade("Left", true)
+	conf := &TahomaConfig{TahomaGatewayConfig: TahomaGatewayConfig{
+		Host:       fake.Host(),
+		ApiKey:     testTahomaToken,
+		GatewayPin: "1111-2222-3333",
+		Insecure:   true,
+	}}
+	client, err := NewTahomaClient(conf, toggleswitch.Named("shades"), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer client.Close(context.Background())
+
+	var mu sync.Mutex
+	lookups := 0
+	found := fake.Host()
+	client.discover = func(ctx context.Context, conf *TahomaGatewayConfig, logger logging.Logger) (TahomaGateway, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		time.Sleep(50 * time.Millisecond) // mDNS takes a while
+		host, port := splitTestHost(t, found)
+		return TahomaGateway{Pin: conf.GatewayPin, Addr: host, Port: port}, nil
+	}
+	numLookups := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return lookups
+	}
+
+	// The gateway goes away; requests failing together share a lookup.
+	fake.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetDevices(); err == nil {
+				t.Error("request to a closed gateway succeeded")
+			}
+		}()
+	}
+	wg.Wait()
+	test.That(t, numLookups(), test.ShouldEqual, 1)
+
+	// And for a while after, failures don't look again.
+	for i := 0; i < 5; i++ {
+		_, err := client.GetDevices()
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+	test.That(t, numLookups(), test.ShouldEqual, 1)
+
+	// Once the interval is up, a lookup that finds it at a new address lets
+	// the request through.
+	moved := newTestFakeTahoma(t)
+	moved.AddShade("Left", true)
+	mu.Lock()
+	found = moved.Host()
+	mu.Unlock()
+	client.rediscoverMu.Lock()
+	client.lastRediscover = time.Now().Add(-tahomaRediscoverInterval)
+	client.rediscoverMu.Unlock()
+	devices, err := client.GetDevices()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(devices), test.ShouldEqual, 1)
+	test.That(t, numLookups(), test.ShouldEqual, 2)
+}
+
+func splitTestHost(t *testing.T, hostPort string) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(hostPort)
+	test.That(t, err, test.ShouldBeNil)
+	port, err := strconv.Atoi(portStr)
+	test.That(t, err, test.ShouldBeNil)
+	return host, port
+}
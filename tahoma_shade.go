@@ -0,0 +1,421 @@
+package verhboat
+
+// erh:verhboat:tahoma-shade is one Somfy shade behind a TaHoma gateway, as a
+// switch whose positions are closure percentages. Unlike tahoma-hack, the
+// position reported is where the shade actually is: device states are polled
+// from the gateway, so moves made with the Somfy remote show up within the
+// poll interval. Shades on the same gateway share one TahomaClient, so there
+// is one event listener and one rediscovery however many shades there are.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var TahomaShadeModel = NamespaceFamily.WithModel("tahoma-shade")
+
+const (
+	tahomaShadeDefaultPoll = 30 * time.Second
+
+	tahomaClosureState     = "core:ClosureState"
+	tahomaOrientationState = "core:SlateOrientationState"
+	tahomaMovingState      = "core:MovingState"
+)
+
+var tahomaShadeDefaultClosures = []float64{0, 25, 50, 75, 100}
+
+func init() {
+	resource.RegisterComponent(
+		toggleswitch.API,
+		TahomaShadeModel,
+		resource.Registration[toggleswitch.Switch, *TahomaShadeConfig]{
+			Constructor: newTahomaShade,
+		})
+}
+
+type TahomaShadeConfig struct {
+	TahomaGatewayConfig `json:",squash"`
+
+	// Device is the shade's label, or its deviceURL (e.g. io://1234-5678-9012/12345678).
+	Device string `json:"device"`
+
+	// PollSeconds is how often device states are read. Defaults to 30.
+	PollSeconds float64 `json:"poll-seconds,omitempty"`
+
+	// Closures are the closure percentages (0 = open, 100 = closed) offered as
+	// switch positions, in order. Defaults to 0, 25, 50, 75, 100.
+	Closures []float64 `json:"closures,omitempty"`
+}
+
+func (c *TahomaShadeConfig) Validate(path string) ([]string, []string, error) {
+	if err := c.TahomaGatewayConfig.validate(); err != nil {
+		return nil, nil, err
+	}
+	if c.Device == "" {
+		return nil, nil, fmt.Errorf("need a device")
+	}
+	if c.PollSeconds < 0 {
+		return nil, nil, fmt.Errorf("poll-seconds cannot be negative")
+	}
+	for _, p := range c.Closures {
+		if p < 0 || p > 100 {
+			return nil, nil, fmt.Errorf("closures must be between 0 and 100, got %v", p)
+		}
+	}
+	return nil, nil, nil
+}
+
+func (c *TahomaShadeConfig) pollInterval() time.Duration {
+	if c.PollSeconds == 0 {
+		return tahomaShadeDefaultPoll
+	}
+	return time.Duration(c.PollSeconds * float64(time.Second))
+}
+
+func (c *TahomaShadeConfig) closures() []float64 {
+	if len(c.Closures) == 0 {
+		return tahomaShadeDefaultClosures
+	}
+	return c.Closures
+}
+
+type TahomaShade struct {
+	resource.AlwaysRebuild
+
+	name   resource.Name
+	conf   *TahomaShadeConfig
+	logger logging.Logger
+
+	client *TahomaClient
+	device Device
+
+	mu       sync.Mutex
+	closure  float64
+	tilt     float64
+	hasTilt  bool
+	moving   bool
+	states   map[string]interface{}
+	lastPoll time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newTahomaShade(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
+	conf, err := resource.NativeConfig[*TahomaShadeConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTahomaShade(ctx, rawConf.ResourceName(), conf, logger)
+}
+
+// tahomaSharedClients are the clients tahoma-shade and sun-shades components
+// share, one per gateway config.
+var tahomaSharedClients = struct {
+	mu      sync.Mutex
+	clients map[TahomaGatewayConfig]*tahomaSharedClient
+}{clients: map[TahomaGatewayConfig]*tahomaSharedClient{}}
+
+type tahomaSharedClient struct {
+	ready  chan struct{} // closed once client or err is set
+	client *TahomaClient
+	err    error
+	refs   int
+}
+
+// tahomaSharedLogger is the shared clients' logger; they outlive whichever
+// component made them, so they can't use its logger.
+var tahomaSharedLogger = sync.OnceValue(func() logging.Logger {
+	return logging.NewLogger("tahoma-gateway")
+})
+
+// acquireTahomaClient returns the shared client for conf, making it if no
+// component is using one. Each call that succeeds needs a
+// releaseTahomaClient. Making a client talks to the gateway, so it's done
+// outside the lock: a gateway that's down only holds up its own components.
+func acquireTahomaClient(ctx context.Context, conf TahomaGatewayConfig) (*TahomaClient, error) {
+	tahomaSharedClients.mu.Lock()
+	shared, ok := tahomaSharedClients.clients[conf]
+	if ok {
+		shared.refs++
+		tahomaSharedClients.mu.Unlock()
+		select {
+		case <-shared.ready:
+		case <-ctx.Done():
+			releaseTahomaRef(shared)
+			return nil, ctx.Err()
+		}
+		if shared.err != nil {
+			return nil, shared.err
+		}
+		return shared.client, nil
+	}
+	shared = &tahomaSharedClient{ready: make(chan struct{}), refs: 1}
+	tahomaSharedClients.clients[conf] = shared
+	tahomaSharedClients.mu.Unlock()
+
+	name := toggleswitch.Named("tahoma-gateway")
+	client, err := NewTahomaClient(&TahomaConfig{TahomaGatewayConfig: conf}, name, tahomaSharedLogger())
+
+	tahomaSharedClients.mu.Lock()
+	shared.client, shared.err = client, err
+	if err != nil && tahomaSharedClients.clients[conf] == shared {
+		// The next component tries afresh.
+		delete(tahomaSharedClients.clients, conf)
+	}
+	tahomaSharedClients.mu.Unlock()
+	close(shared.ready)
+	return client, err
+}
+
+// releaseTahomaRef drops a reference from a component that gave up waiting
+// for the client to be made. The maker still has one, so nothing is closed.
+func releaseTahomaRef(shared *tahomaSharedClient) {
+	tahomaSharedClients.mu.Lock()
+	defer tahomaSharedClients.mu.Unlock()
+	shared.refs--
+}
+
+// releaseTahomaClient gives up a client from acquireTahomaClient, closing it
+// when the last shade using it is done.
+func releaseTahomaClient(ctx context.Context, client *TahomaClient) error {
+	tahomaSharedClients.mu.Lock()
+	defer tahomaSharedClients.mu.Unlock()
+
+	for conf, shared := range tahomaSharedClients.clients {
+		if shared.client == nil || shared.client != client {
+			continue
+		}
+		shared.refs--
+		if shared.refs > 0 {
+			return nil
+		}
+		delete(tahomaSharedClients.clients, conf)
+		break
+	}
+	return client.Close(ctx)
+}
+
+func NewTahomaShade(ctx context.Context, name resource.Name, conf *TahomaShadeConfig, logger logging.Logger) (*TahomaShade, error) {
+	client, err := acquireTahomaClient(ctx, conf.TahomaGatewayConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := client.FindDevice(conf.Device)
+	if err != nil {
+		releaseTahomaClient(ctx, client)
+		return nil, err
+	}
+
+	bgCtx, cancel := context.WithCancel(context.Background())
+	s := &TahomaShade{
+		name:   name,
+		conf:   conf,
+		logger: logger,
+		client: client,
+		device: device,
+		cancel: cancel,
+	}
+
+	if err := s.refresh(); err != nil {
+		cancel()
+		releaseTahomaClient(ctx, client)
+		return nil, fmt.Errorf("tahoma-shade [%s]: initial state read failed: %w", device.Label, err)
+	}
+
+	s.wg.Add(1)
+	go s.pollLoop(bgCtx)
+
+	return s, nil
+}
+
+// refresh reads the device's states from the gateway and updates the cache.
+func (s *TahomaShade) refresh() error {
+	states, err := s.client.GetDeviceStates(s.device.DeviceURL)
+	if err != nil {
+		return err
+	}
+
+	m := map[string]interface{}{}
+	for _, st := range states {
+		m[st.Name] = st.Value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states = m
+	s.lastPoll = time.Now()
+	if v, ok := m[tahomaClosureState].(float64); ok {
+		if v != s.closure {
+			s.logger.Debugf("tahoma-shade [%s]: closure %v -> %v", s.device.Label, s.closure, v)
+		}
+		s.closure = v
+	}
+	s.tilt, s.hasTilt = m[tahomaOrientationState].(float64)
+	s.moving, _ = m[tahomaMovingState].(bool)
+	return nil
+}
+
+func (s *TahomaShade) pollLoop(ctx context.Context) {
+	defer s.wg.Done()
+	t := time.NewTicker(s.conf.pollInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.refresh(); err != nil {
+				s.logger.Warnf("tahoma-shade [%s]: state poll failed: %v", s.device.Label, err)
+			}
+		}
+	}
+}
+
+func (s *TahomaShade) setClosure(ctx context.Context, percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("closure must be between 0 and 100, got %v", percent)
+	}
+	return s.execute(ctx, Command{Name: "setClosure", Parameters: []interface{}{int(percent)}}, "Set closure")
+}
+
+func (s *TahomaShade) setTilt(ctx context.Context, percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("tilt must be between 0 and 100, got %v", percent)
+	}
+	return s.execute(ctx, Command{Name: "setOrientation", Parameters: []interface{}{int(percent)}}, "Set tilt")
+}
+
+// execute runs one command on the shade, waits for it to finish, and then
+// re-reads the shade's states so the new position shows up immediately.
+func (s *TahomaShade) execute(ctx context.Context, cmd Command, label string) error {
+	if _, err := s.client.ExecuteAndWait(ctx, []string{s.device.DeviceURL}, []Command{cmd}, label); err != nil {
+		return err
+	}
+	if err := s.refresh(); err != nil {
+		s.logger.Warnf("tahoma-shade [%s]: state read after %s failed: %v", s.device.Label, cmd.Name, err)
+	}
+	return nil
+}
+
+// nearestClosure returns the index of the closure closest to percent.
+func nearestClosure(closures []float64, percent float64) uint32 {
+	best := 0
+	for i, c := range closures {
+		if math.Abs(c-percent) < math.Abs(closures[best]-percent) {
+			best = i
+		}
+	}
+	return uint32(best)
+}
+
+func closureName(percent float64) string {
+	switch percent {
+	case 0:
+		return "open"
+	case 100:
+		return "closed"
+	}
+	return fmt.Sprintf("%g%% closed", percent)
+}
+
+func (s *TahomaShade) Name() resource.Name {
+	return s.name
+}
+
+func (s *TahomaShade) Close(ctx context.Context) error {
+	s.cancel()
+	s.wg.Wait()
+	return releaseTahomaClient(ctx, s.client)
+}
+
+// DoCommand supports:
+//
+//	{"command": "status"}                       closure, tilt, moving and raw states
+//	{"command": "refresh"}                      read states from the gateway now
+//	{"command": "set_closure", "percent": 40}   0 = open, 100 = closed
+//	{"command": "set_tilt", "percent": 80}      slat orientation
+func (s *TahomaShade) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	command, _ := cmd["command"].(string)
+
+	switch command {
+	case "status":
+		return s.status(), nil
+
+	case "refresh":
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+		return s.status(), nil
+
+	case "set_closure", "set_tilt":
+		percent, ok := cmd["percent"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a number \"percent\"", command)
+		}
+		var err error
+		if command == "set_closure" {
+			err = s.setClosure(ctx, percent)
+		} else {
+			err = s.setTilt(ctx, percent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"percent": percent}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func (s *TahomaShade) status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := map[string]interface{}{
+		"device":    s.device.Label,
+		"deviceURL": s.device.DeviceURL,
+		"closure":   s.closure,
+		"moving":    s.moving,
+		"states":    s.states,
+		"last_poll": s.lastPoll.UTC().Format(time.RFC3339),
+	}
+	if s.hasTilt {
+		res["tilt"] = s.tilt
+	}
+	return res
+}
+
+func (s *TahomaShade) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	closures := s.conf.closures()
+	if int(position) >= len(closures) {
+		return fmt.Errorf("don't know how to go to position %d", position)
+	}
+	return s.setClosure(ctx, closures[position])
+}
+
+func (s *TahomaShade) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return nearestClosure(s.conf.closures(), s.closure), nil
+}
+
+func (s *TahomaShade) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
+	closures := s.conf.closures()
+	names := make([]string, len(closures))
+	for i, c := range closures {
+		names[i] = closureName(c)
+	}
+	return uint32(len(names)), names, nil
+}
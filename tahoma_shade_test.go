@@ -0,0 +1,211 @@
+package verhboat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+func TestNearestClosure(t *testing.T) {
+	for _, tc := range []struct {
+		closures []float64
+		percent  float64
+		want     uint32
+	}{
+		{tahomaShadeDefaultClosures, 0, 0},
+		{tahomaShadeDefaultClosures, 100, 4},
+		{tahomaShadeDefaultClosures, 60, 2},
+		{tahomaShadeDefaultClosures, 63, 3},
+		{tahomaShadeDefaultClosures, 12.5, 0}, // a tie goes to the first
+		{[]float64{100, 0}, 10, 1},
+		{[]float64{40}, 100, 0},
+	} {
+		test.That(t, nearestClosure(tc.closures, tc.percent), test.ShouldEqual, tc.want)
+	}
+}
+
+func TestClosureName(t *testing.T) {
+	for _, tc := range []struct {
+		percent float64
+		want    string
+	}{
+		{0, "open"},
+		{100, "closed"},
+		{25, "25% closed"},
+		{33.5, "33.5% closed"},
+	} {
+		test.That(t, closureName(tc.percent), test.ShouldEqual, tc.want)
+	}
+}
+
+func TestTahomaShadeValidation(t *testing.T) {
+	ctx := context.Background()
+	// Nothing here reaches the gateway, so the shade needs no client.
+	s := &TahomaShade{conf: &TahomaShadeConfig{Closures: []float64{0, 50, 100}}}
+
+	for _, tc := range []struct {
+		name string
+		cmd  map[string]interface{}
+	}{
+		{"closure too low", map[string]interface{}{"command": "set_closure", "percent": -1.0}},
+		{"closure too high", map[string]interface{}{"command": "set_closure", "percent": 100.5}},
+		{"closure not a number", map[string]interface{}{"command": "set_closure", "percent": "50"}},
+		{"closure missing", map[string]interface{}{"command": "set_closure"}},
+		{"tilt too low", map[string]interface{}{"command": "set_tilt", "percent": -10.0}},
+		{"tilt too high", map[string]interface{}{"command": "set_tilt", "percent": 101.0}},
+		{"tilt missing", map[string]interface{}{"command": "set_tilt"}},
+		{"unknown command", map[string]interface{}{"command": "spin"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.DoCommand(ctx, tc.cmd)
+			test.That(t, err, test.ShouldNotBeNil)
+		})
+	}
+
+	test.That(t, s.SetPosition(ctx, 3, nil), test.ShouldNotBeNil)
+	test.That(t, s.SetPosition(ctx, 1000, nil), test.ShouldNotBeNil)
+
+	for _, bad := range []TahomaShadeConfig{
+		{TahomaGatewayConfig: TahomaGatewayConfig{ApiKey: "k"}},
+		{TahomaGatewayConfig: TahomaGatewayConfig{ApiKey: "k"}, Device: "Left", PollSeconds: -1},
+		{TahomaGatewayConfig: TahomaGatewayConfig{ApiKey: "k"}, Device: "Left", Closures: []float64{0, 101}},
+	} {
+		_, _, err := bad.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+func TestTahomaShadesShareClient(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	left := fake.AddShade("Left", true)
+	right := fake.AddShade("Right", true)
+	ctx := context.Background()
+	logger := logging.NewTestLogger(t)
+
+	newShade := func(name, device string) *TahomaShade {
+		conf := &TahomaShadeConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake), Device: device}
+		_, _, err := conf.Validate("")
+		test.That(t, err, test.ShouldBeNil)
+		shade, err := NewTahomaShade(ctx, toggleswitch.Named(name), conf, logger)
+		test.That(t, err, test.ShouldBeNil)
+		return shade
+	}
+
+	a := newShade("left", "Left")
+	b := newShade("right", "Right")
+	test.That(t, a.client, test.ShouldEqual, b.client)
+	// The client isn't the first shade's; it outlives it.
+	test.That(t, a.client.Name().ShortName(), test.ShouldEqual, "tahoma-gateway")
+	a.client.eventPoll = 20 * time.Millisecond
+
+	test.That(t, a.SetPosition(ctx, 4, nil), test.ShouldBeNil)
+	test.That(t, b.SetPosition(ctx, 2, nil), test.ShouldBeNil)
+	test.That(t, fake.Closure(left), test.ShouldEqual, 100)
+	test.That(t, fake.Closure(right), test.ShouldEqual, 50)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 1)
+
+	// The client outlives the first shade closed...
+	test.That(t, a.Close(ctx), test.ShouldBeNil)
+	test.That(t, b.SetPosition(ctx, 0, nil), test.ShouldBeNil)
+	test.That(t, fake.Closure(right), test.ShouldEqual, 0)
+
+	// ...but not the last, and a new shade gets a new one.
+	test.That(t, b.Close(ctx), test.ShouldBeNil)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 0)
+	c := newShade("left", "Left")
+	defer c.Close(ctx)
+	test.That(t, c.client, test.ShouldNotEqual, b.client)
+
+	// A device the gateway doesn't have doesn't leak a reference.
+	conf := &TahomaShadeConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake), Device: "Aft"}
+	_, err := NewTahomaShade(ctx, toggleswitch.Named("aft"), conf, logger)
+	test.That(t, err, test.ShouldNotBeNil)
+	tahomaSharedClients.mu.Lock()
+	test.That(t, tahomaSharedClients.clients[conf.TahomaGatewayConfig].refs, test.ShouldEqual, 1)
+	tahomaSharedClients.mu.Unlock()
+
+	// Once it's paired, the shared client finds it.
+	fake.AddShade("Aft", true)
+	aft := newShade("aft", "Aft")
+	defer aft.Close(ctx)
+	test.That(t, aft.client, test.ShouldEqual, c.client)
+}
+
+func TestTahomaSharedClientSlowGateway(t *testing.T) {
+	ctx := context.Background()
+
+	// A gateway that accepts connections and never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	test.That(t, err, test.ShouldBeNil)
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	hung := TahomaGatewayConfig{Host: l.Addr().String(), ApiKey: "token", Insecure: true}
+
+	made := make(chan error, 1)
+	go func() {
+		client, err := acquireTahomaClient(ctx, hung)
+		if err == nil {
+			releaseTahomaClient(ctx, client)
+		}
+		made <- err
+	}()
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("never connected to the gateway")
+	}
+
+	// Shades on other gateways aren't held up...
+	fake := newTestFakeTahoma(t)
+	fake.AddShade("Left", true)
+	done := make(chan error, 1)
+	go func() {
+		conf := &TahomaShadeConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake), Device: "Left"}
+		shade, err := NewTahomaShade(ctx, toggleswitch.Named("left"), conf, logging.NewTestLogger(t))
+		if err == nil {
+			err = shade.Close(ctx)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		test.That(t, err, test.ShouldBeNil)
+	case <-time.After(2 * time.Second):
+		t.Fatal("a shade on another gateway waited for the slow one")
+	}
+
+	// ...and ones on the same gateway can give up waiting.
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = acquireTahomaClient(waitCtx, hung)
+	test.That(t, errors.Is(err, context.DeadlineExceeded), test.ShouldBeTrue)
+
+	// When it fails, the next try starts afresh.
+	test.That(t, l.Close(), test.ShouldBeNil)
+	test.That(t, conn.Close(), test.ShouldBeNil)
+	select {
+	case err := <-made:
+		test.That(t, err, test.ShouldNotBeNil)
+	case <-time.After(5 * time.Second):
+		t.Fatal("making the client never failed")
+	}
+	tahomaSharedClients.mu.Lock()
+	_, ok := tahomaSharedClients.clients[hung]
+	tahomaSharedClients.mu.Unlock()
+	test.That(t, ok, test.ShouldBeFalse)
+}
@@ -0,0 +1,418 @@
+package verhboat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+const testTahomaToken = "test-token"
+
+func newTestFakeTahoma(t *testing.T) *FakeTahoma {
+	t.Helper()
+	fake := NewFakeTahoma(testTahomaToken)
+	fake.SetTravelTime(200 * time.Millisecond)
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func testTahomaGatewayConfig(fake *FakeTahoma) TahomaGatewayConfig {
+	return TahomaGatewayConfig{
+		Host:            fake.Host(),
+		ApiKey:          testTahomaToken,
+		CertFingerprint: fake.CertFingerprint(),
+	}
+}
+
+func newTestTahomaClient(t *testing.T, fake *FakeTahoma, positions []TahomaPosition) *TahomaClient {
+	t.Helper()
+	conf := &TahomaConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake), Positions: positions}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	client, err := NewTahomaClient(conf, toggleswitch.Named("shades"), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	client.eventPoll = 20 * time.Millisecond
+	t.Cleanup(func() { client.Close(context.Background()) })
+	return client
+}
+
+func percent(p float64) *float64 {
+	return &p
+}
+
+func TestTahomaConfigValidate(t *testing.T) {
+	conf := &TahomaConfig{}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// Configs from before certificates were checked still work.
+	conf.ApiKey = "x"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	conf.Insecure = true
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	conf.CertFingerprint = "nope"
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	conf.CertFingerprint = ""
+
+	for _, bad := range [][]TahomaPosition{
+		{{Devices: []string{"a"}}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Steps: []TahomaStep{{Command: "up"}}}},
+		{{Name: "a", Devices: []string{"a"}, Steps: []TahomaStep{{Command: "wait"}}}},
+		{{Name: "a", Devices: []string{"a"}, Steps: []TahomaStep{{Command: "setClosure", Percent: percent(120)}}}},
+	} {
+		conf.Positions = bad
+		_, _, err = conf.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+func TestTahomaClientAgainstFake(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	left := fake.AddShade("Left", true)
+	right := fake.AddShade("Right", false)
+
+	client := newTestTahomaClient(t, fake, nil)
+
+	devices, err := client.GetDevices()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(devices), test.ShouldEqual, 2)
+	test.That(t, devices[0].Label, test.ShouldEqual, "Left")
+	test.That(t, devices[0].DeviceURL, test.ShouldEqual, left)
+
+	d, err := client.FindDevice(left)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.Label, test.ShouldEqual, "Left")
+	_, err = client.FindDevice("Middle")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	states, err := client.GetDeviceStates(left)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(states), test.ShouldBeGreaterThan, 0)
+
+	ctx := context.Background()
+	test.That(t, client.LowerAndTiltShadeByLabels(ctx, []string{"Left"}), test.ShouldBeNil)
+	test.That(t, fake.Closure(left), test.ShouldEqual, 100)
+	test.That(t, fake.Orientation(left), test.ShouldEqual, 80)
+
+	test.That(t, client.LiftShadeByLabel(ctx, "Left"), test.ShouldBeNil)
+	test.That(t, fake.Closure(left), test.ShouldEqual, 0)
+
+	// Right can't tilt, so it isn't lowered either.
+	err = client.LowerAndTiltShadeByLabels(ctx, []string{"Right"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "doesn't support tiltPositive")
+	test.That(t, fake.Closure(right), test.ShouldEqual, 0)
+	test.That(t, len(fake.Commands()), test.ShouldEqual, 3)
+}
+
+func TestTahomaClientAuthAndTLS(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	fake.AddShade("Left", true)
+	logger := logging.NewTestLogger(t)
+
+	conf := &TahomaConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake)}
+	conf.ApiKey = "wrong"
+	_, err := NewTahomaClient(conf, toggleswitch.Named("shades"), logger)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "401")
+
+	conf = &TahomaConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake)}
+	conf.CertFingerprint = strings.Repeat("00", 32)
+	_, err = NewTahomaClient(conf, toggleswitch.Named("shades"), logger)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "fingerprint")
+
+	// Without a fingerprint or CA the first certificate seen is trusted, and
+	// a gateway with another one after that isn't.
+	conf = &TahomaConfig{TahomaGatewayConfig: testTahomaGatewayConfig(fake)}
+	conf.CertFingerprint = ""
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	observed, logs := logging.NewObservedTestLogger(t)
+	client, err := NewTahomaClient(conf, toggleswitch.Named("shades"), observed)
+	test.That(t, err, test.ShouldBeNil)
+	defer client.Close(context.Background())
+	test.That(t, logs.FilterMessageSnippet(fake.CertFingerprint()).Len(), test.ShouldEqual, 1)
+	_, err = client.GetDevices()
+	test.That(t, err, test.ShouldBeNil)
+
+	other := newTestCA(t).gateway(t, "gateway-1111-2222-3333.local", true)
+	client.host, client.port = splitTestHost(t, strings.TrimPrefix(other.URL, "https://"))
+	_, err = client.GetDevices()
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "isn't the one first seen")
+
+	conf.Insecure = true
+	_, _, err = conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	client, err = NewTahomaClient(conf, toggleswitch.Named("shades"), logger)
+	test.That(t, err, test.ShouldBeNil)
+	client.Close(context.Background())
+}
+
+func TestTahomaPositions(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	left := fake.AddShade("Left", true)
+	right := fake.AddShade("Right", true)
+
+	client := newTestTahomaClient(t, fake, []TahomaPosition{
+		{Name: "up", Devices: []string{"Left", "Right"}, Steps: []TahomaStep{{Command: "up"}}},
+		{Name: "shade", Devices: []string{"Left", "Right"}, Steps: []TahomaStep{
+			{Command: "setClosure", Percent: percent(50)},
+			{Command: "wait", Seconds: 0.01},
+			{Command: "setOrientation", Parameters: []interface{}{30}, Devices: []string{"Right"}},
+		}},
+	})
+	ctx := context.Background()
+
+	n, names, err := client.GetNumberOfPositions(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 2)
+	test.That(t, names, test.ShouldResemble, []string{"up", "shade"})
+
+	test.That(t, client.SetPosition(ctx, 1, nil), test.ShouldBeNil)
+	test.That(t, fake.Closure(left), test.ShouldEqual, 50)
+	test.That(t, fake.Closure(right), test.ShouldEqual, 50)
+	test.That(t, fake.Orientation(left), test.ShouldEqual, 0)
+	test.That(t, fake.Orientation(right), test.ShouldEqual, 30)
+	pos, err := client.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 1)
+
+	fake.FailNext(right, "WHILEEXEC_BLOCKED_BY_HAZARD")
+	err = client.SetPosition(ctx, 0, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "WHILEEXEC_BLOCKED_BY_HAZARD")
+	test.That(t, err.Error(), test.ShouldContainSubstring, right)
+	pos, err = client.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+
+	test.That(t, client.SetPosition(ctx, 2, nil), test.ShouldNotBeNil)
+}
+
+func TestTahomaDefaultPositions(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	fwd := fake.AddShade("Port forward", true)
+	mid := fake.AddShade("Port mid", true)
+
+	// A config from before positions were configurable.
+	client := newTestTahomaClient(t, fake, nil)
+	ctx := context.Background()
+
+	n, names, err := client.GetNumberOfPositions(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 3)
+	test.That(t, names, test.ShouldResemble, []string{"unknown", "open", "port"})
+
+	test.That(t, client.SetPosition(ctx, 2, nil), test.ShouldBeNil)
+	for _, u := range []string{fwd, mid} {
+		test.That(t, fake.Closure(u), test.ShouldEqual, 100)
+		test.That(t, fake.Orientation(u), test.ShouldEqual, 80)
+	}
+	test.That(t, client.SetPosition(ctx, 1, nil), test.ShouldBeNil)
+	test.That(t, fake.Closure(fwd), test.ShouldEqual, 0)
+	test.That(t, fake.Closure(mid), test.ShouldEqual, 0)
+
+	commands := len(fake.Commands())
+	test.That(t, client.SetPosition(ctx, 0, nil), test.ShouldBeNil)
+	test.That(t, len(fake.Commands()), test.ShouldEqual, commands)
+	test.That(t, client.SetPosition(ctx, 3, nil), test.ShouldNotBeNil)
+}
+
+func TestTahomaEventListenerReregisters(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	left := fake.AddShade("Left", false)
+	client := newTestTahomaClient(t, fake, nil)
+	ctx := context.Background()
+
+	test.That(t, client.LiftShadeByUrl(ctx, left), test.ShouldBeNil)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 1)
+
+	fake.DropEventListeners()
+	test.That(t, client.LiftShadeByUrl(ctx, left), test.ShouldBeNil)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 1)
+
+	test.That(t, client.Close(ctx), test.ShouldBeNil)
+	test.That(t, fake.NumEventListeners(), test.ShouldEqual, 0)
+}
+
+func TestTahomaShadeAgainstFake(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	left := fake.AddShade("Left", true)
+	ctx := context.Background()
+
+	conf := &TahomaShadeConfig{
+		TahomaGatewayConfig: testTahomaGatewayConfig(fake),
+		Device:              "Left",
+		PollSeconds:         0.02,
+	}
+	_, _, err := conf.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	shade, err := NewTahomaShade(ctx, toggleswitch.Named("left"), conf, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer shade.Close(ctx)
+	shade.client.eventPoll = 20 * time.Millisecond
+
+	n, names, err := shade.GetNumberOfPositions(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 5)
+	test.That(t, names[0], test.ShouldEqual, "open")
+	test.That(t, names[4], test.ShouldEqual, "closed")
+
+	test.That(t, shade.SetPosition(ctx, 2, nil), test.ShouldBeNil)
+	test.That(t, fake.Closure(left), test.ShouldEqual, 50)
+	pos, err := shade.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 2)
+
+	_, err = shade.DoCommand(ctx, map[string]interface{}{"command": "set_tilt", "percent": 40.0})
+	test.That(t, err, test.ShouldBeNil)
+	status, err := shade.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, status["tilt"], test.ShouldEqual, 40.0)
+
+	// Someone uses the Somfy remote; the poll picks it up.
+	fake.SetClosure(left, 100)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pos, err = shade.GetPosition(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		if pos == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("shade never noticed the remote, position %d", pos)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = shade.DoCommand(ctx, map[string]interface{}{"command": "set_closure", "percent": 120.0})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = shade.DoCommand(ctx, map[string]interface{}{"command": "bogus"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestTahomaDoCommand(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	left := fake.AddShade("Left", true)
+	right := fake.AddShade("Right", false)
+	fake.AddScenario("Night", []Action{
+		{DeviceURL: left, Commands: []Command{{Name: "down", Parameters: []interface{}{}}}},
+		{DeviceURL: right, Commands: []Command{{Name: "setClosure", Parameters: []interface{}{70}}}},
+	})
+	client := newTestTahomaClient(t, fake, nil)
+	ctx := context.Background()
+
+	res, err := client.DoCommand(ctx, map[string]interface{}{"command": "list_devices"})
+	test.That(t, err, test.ShouldBeNil)
+	devices := res["devices"].([]interface{})
+	test.That(t, len(devices), test.ShouldEqual, 2)
+	test.That(t, devices[1].(map[string]interface{})["deviceURL"], test.ShouldEqual, right)
+
+	res, err = client.DoCommand(ctx, map[string]interface{}{
+		"command":  "exec",
+		"device":   "Left",
+		"commands": []interface{}{map[string]interface{}{"name": "setClosure", "parameters": []interface{}{40.0}}},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["state"], test.ShouldEqual, "COMPLETED")
+	test.That(t, res["exec_id"], test.ShouldNotBeEmpty)
+	test.That(t, fake.Closure(left), test.ShouldEqual, 40)
+
+	// By URL; the gateway fails the execution.
+	fake.FailNext(right, "WHILEEXEC_BLOCKED_BY_HAZARD")
+	res, err = client.DoCommand(ctx, map[string]interface{}{
+		"command":  "exec",
+		"device":   right,
+		"commands": []interface{}{map[string]interface{}{"name": "up"}},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["state"], test.ShouldEqual, "FAILED")
+	test.That(t, res["failure"], test.ShouldEqual, "WHILEEXEC_BLOCKED_BY_HAZARD")
+
+	// A command the device doesn't have is never sent.
+	_, err = client.DoCommand(ctx, map[string]interface{}{
+		"command":  "exec",
+		"device":   right,
+		"commands": []interface{}{map[string]interface{}{"name": "setOrientation", "parameters": []interface{}{10.0}}},
+	})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "doesn't support setOrientation")
+
+	_, err = client.DoCommand(ctx, map[string]interface{}{"command": "exec", "device": "Left"})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = client.DoCommand(ctx, map[string]interface{}{
+		"command":  "exec",
+		"device":   "Middle",
+		"commands": []interface{}{map[string]interface{}{"name": "up"}},
+	})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	res, err = client.DoCommand(ctx, map[string]interface{}{"command": "list_scenarios"})
+	test.That(t, err, test.ShouldBeNil)
+	scenarios := res["scenarios"].([]interface{})
+	test.That(t, len(scenarios), test.ShouldEqual, 1)
+	test.That(t, scenarios[0].(map[string]interface{})["label"], test.ShouldEqual, "Night")
+
+	res, err = client.DoCommand(ctx, map[string]interface{}{"command": "run_scenario", "scenario": "Night"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["state"], test.ShouldEqual, "COMPLETED")
+	test.That(t, fake.Closure(left), test.ShouldEqual, 100)
+	test.That(t, fake.Closure(right), test.ShouldEqual, 70)
+
+	_, err = client.DoCommand(ctx, map[string]interface{}{"command": "run_scenario", "scenario": "Morning"})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = client.DoCommand(ctx, map[string]interface{}{"command": "bogus"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestTahomaDeviceDefinitions(t *testing.T) {
+	fake := newTestFakeTahoma(t)
+	fake.AddShade("Left", true)
+	fake.AddShade("Right", false)
+	client := newTestTahomaClient(t, fake, nil)
+
+	left, err := client.FindDevice("Left")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, left.ControllableName, test.ShouldEqual, "io:ExteriorVenetianBlindIOComponent")
+	test.That(t, left.Definition.UIClass, test.ShouldEqual, "ExteriorVenetianBlind")
+	test.That(t, len(left.States), test.ShouldBeGreaterThan, 0)
+	def, ok := left.CommandDefinition("setClosure")
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, def.Nparams, test.ShouldEqual, 1)
+
+	test.That(t, left.ValidateCommand(Command{Name: "tiltPositive", Parameters: []interface{}{8, 1}}), test.ShouldBeNil)
+	test.That(t, left.ValidateCommand(Command{Name: "setClosure", Parameters: []interface{}{1, 2}}), test.ShouldNotBeNil)
+	test.That(t, left.ValidateCommand(Command{Name: "beep"}), test.ShouldNotBeNil)
+
+	right, err := client.FindDevice("Right")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, right.ValidateCommand(Command{Name: "tiltPositive"}), test.ShouldNotBeNil)
+
+	// Without a definition there's nothing to check against.
+	test.That(t, Device{Label: "x"}.ValidateCommand(Command{Name: "beep"}), test.ShouldBeNil)
+
+	// Positions are checked against the devices when the component starts.
+	conf := &TahomaConfig{
+		TahomaGatewayConfig: testTahomaGatewayConfig(fake),
+		Positions: []TahomaPosition{
+			{Name: "tilted", Devices: []string{"Left", "Right"}, Steps: []TahomaStep{{Command: "tilt", Parameters: []interface{}{8, 1}}}},
+		},
+	}
+	_, err = NewTahomaClient(conf, toggleswitch.Named("shades"), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "Right")
+}